@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const thumbnailWidth = 320
+
+type apiCamera struct {
+	ID        int    `json:"id"`
+	Recording bool   `json:"recording"`
+	Paused    bool   `json:"paused,omitempty"`
+	File      string `json:"file,omitempty"`
+	Color     string `json:"color"`
+
+	Quality *QualityReport `json:"quality,omitempty"`
+
+	FPS       float64 `json:"fps"`
+	TargetFPS float64 `json:"target_fps"`
+}
+
+type apiStatus struct {
+	SessionID string       `json:"session_id"`
+	Version   string       `json:"version"`
+	Cameras   []apiCamera  `json:"cameras"`
+	Power     *PowerStatus `json:"power,omitempty"`
+	Privacy   bool         `json:"privacy"`
+}
+
+type apiPTZMove struct {
+	Pan      float64 `json:"pan"`
+	Tilt     float64 `json:"tilt"`
+	Zoom     float64 `json:"zoom"`
+	Duration string  `json:"duration,omitempty"`
+}
+
+type apiMarker struct {
+	Camera *int   `json:"camera,omitempty"`
+	Note   string `json:"note"`
+}
+
+func (s *Server) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/status", s.handleStatus)
+	mux.HandleFunc("GET /api/v1/events", s.handleEvents)
+	mux.HandleFunc("GET /api/v1/thumbnail/{file}", s.handleThumbnail)
+	mux.HandleFunc("POST /api/v1/record/start", s.handleCommand(cmdRecordStart))
+	mux.HandleFunc("POST /api/v1/record/start/{cam}", s.handleCommand(cmdRecordStart))
+	mux.HandleFunc("POST /api/v1/record/stop", s.handleCommand(cmdRecordStop))
+	mux.HandleFunc("POST /api/v1/record/stop/{cam}", s.handleCommand(cmdRecordStop))
+	mux.HandleFunc("POST /api/v1/record/pause", s.handleCommand(cmdRecordPause))
+	mux.HandleFunc("POST /api/v1/record/pause/{cam}", s.handleCommand(cmdRecordPause))
+	mux.HandleFunc("POST /api/v1/record/resume", s.handleCommand(cmdRecordResume))
+	mux.HandleFunc("POST /api/v1/record/resume/{cam}", s.handleCommand(cmdRecordResume))
+	mux.HandleFunc("POST /api/v1/privacy", s.handleCommand(cmdPrivacy))
+	mux.HandleFunc("POST /api/v1/privacy/off", s.handleCommand(cmdPrivacyOff))
+	mux.HandleFunc("POST /api/v1/snapshot", s.handleCommand(cmdSnapshot))
+	mux.HandleFunc("POST /api/v1/marker", s.handleMarker)
+	mux.HandleFunc("POST /api/v1/clock", s.handleClock)
+	mux.HandleFunc("GET /api/v1/ptz/{cam}/presets", s.handlePTZPresets)
+	mux.HandleFunc("POST /api/v1/ptz/{cam}/preset/{preset}", s.handlePTZGoto)
+	mux.HandleFunc("POST /api/v1/ptz/{cam}/move", s.handlePTZMove)
+	mux.HandleFunc("POST /api/v1/ptz/{cam}/stop", s.handlePTZStop)
+	mux.HandleFunc("POST /api/v1/ptz/{cam}/track/{state}", s.handlePTZTrack)
+	mux.HandleFunc("POST /api/v1/token", s.handleLogin)
+	mux.HandleFunc("DELETE /api/v1/token", s.handleLogout)
+	mux.HandleFunc("DELETE /api/v1/users/{user}/tokens", s.handleRevokeUser)
+}
+
+// authorize requires a bearer token, as header or access_token query parameter, on every route except
+// the health probes and token issuance. Reading needs the viewer role, changing anything the operator
+// role and managing users the admin role. Without --api-token or --users everything is open.
+func authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authEnabled() || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" ||
+			r.Method == http.MethodPost && r.URL.Path == "/api/v1/token" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p, ok := accounts.lookup(bearerToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mCamRecorder"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		if need := requiredRole(r); p.Role < need {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": fmt.Sprintf("requires the %s role", need)})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return r.URL.Query().Get("access_token")
+}
+
+func requiredRole(r *http.Request) Role {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/api/v1/users/"):
+		return roleAdmin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead || r.URL.Path == "/api/v1/token":
+		return roleViewer
+	default:
+		return roleOperator
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	status := apiStatus{SessionID: s.manifest.SessionID, Version: version, Cameras: []apiCamera{}, Power: powerStatus.Load(), Privacy: privacy.Load()}
+	for _, cam := range s.cameras.Load() {
+		c := apiCamera{ID: cam.ID, Recording: cam.Recording(), Paused: cam.Paused(), Color: colorHex(cam.Color), Quality: cam.quality.Report(),
+			FPS: math.Round(cam.measuredFPS()*100) / 100, TargetFPS: cam.FPS}
+		if c.Recording {
+			cam.mu.Lock()
+			c.File = filepath.Base(cam.Filename)
+			cam.mu.Unlock()
+		}
+		status.Cameras = append(status.Cameras, c)
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleThumbnail serves GET /api/v1/thumbnail/{cam}.jpg, scaled down to a preview size unless width is given.
+func (s *Server) handleThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("width") == "" {
+		q := r.URL.Query()
+		q.Set("width", fmt.Sprint(thumbnailWidth))
+		r.URL.RawQuery = q.Encode()
+	}
+	s.handleSnapshot(w, r)
+}
+
+// handleCommand queues a command for all cameras, or for the one named by the optional {cam} path segment.
+func (s *Server) handleCommand(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c := Command{Name: name, CamID: allCameras, Source: "api"}
+		if v := r.PathValue("cam"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || s.camera(id) == nil {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("camera %s not found", v)})
+				return
+			}
+			c.CamID = id
+		}
+		sendCommand(c)
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+	}
+}
+
+func (s *Server) handleMarker(w http.ResponseWriter, r *http.Request) {
+	var req apiMarker
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid marker: %v", err)})
+		return
+	}
+	c := Command{Name: cmdMarker, CamID: allCameras, Arg: req.Note, Source: "api"}
+	if req.Camera != nil {
+		if s.camera(*req.Camera) == nil {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("camera %d not found", *req.Camera)})
+			return
+		}
+		c.CamID = *req.Camera
+	}
+	sendCommand(c)
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "accepted"})
+}
+
+// ptz returns the PTZ controller of the {cam} path segment, or writes a 404.
+func (s *Server) ptz(w http.ResponseWriter, r *http.Request) *PTZ {
+	id, err := strconv.Atoi(r.PathValue("cam"))
+	if err != nil || s.camera(id) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("camera %s not found", r.PathValue("cam"))})
+		return nil
+	}
+	if s.camera(id).PTZ == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("camera %d has no PTZ", id)})
+		return nil
+	}
+	return s.camera(id).PTZ
+}
+
+func writePTZResult(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handlePTZPresets(w http.ResponseWriter, r *http.Request) {
+	ptz := s.ptz(w, r)
+	if ptz == nil {
+		return
+	}
+	presets, err := ptz.Presets()
+	if err != nil {
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, presets)
+}
+
+func (s *Server) handlePTZGoto(w http.ResponseWriter, r *http.Request) {
+	if ptz := s.ptz(w, r); ptz != nil {
+		writePTZResult(w, ptz.GotoPreset(r.PathValue("preset")))
+	}
+}
+
+// handlePTZMove starts a continuous move, body {"pan": 0.5, "tilt": 0, "zoom": 0, "duration": "1s"} with
+// velocities in [-1, 1]; without a duration the camera moves until stopped.
+func (s *Server) handlePTZMove(w http.ResponseWriter, r *http.Request) {
+	ptz := s.ptz(w, r)
+	if ptz == nil {
+		return
+	}
+	var req apiPTZMove
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid move: %v", err)})
+		return
+	}
+	var d time.Duration
+	if req.Duration != "" {
+		var err error
+		if d, err = time.ParseDuration(req.Duration); err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid duration %q", req.Duration)})
+			return
+		}
+	}
+	for _, v := range []float64{req.Pan, req.Tilt, req.Zoom} {
+		if v < -1 || v > 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "pan, tilt and zoom must be between -1 and 1"})
+			return
+		}
+	}
+	ptz.manual()
+	writePTZResult(w, ptz.Move(req.Pan, req.Tilt, req.Zoom, d))
+}
+
+func (s *Server) handlePTZStop(w http.ResponseWriter, r *http.Request) {
+	if ptz := s.ptz(w, r); ptz != nil {
+		ptz.manual()
+		writePTZResult(w, ptz.Stop())
+	}
+}
+
+// handlePTZTrack turns follow mode on or off.
+func (s *Server) handlePTZTrack(w http.ResponseWriter, r *http.Request) {
+	ptz := s.ptz(w, r)
+	if ptz == nil {
+		return
+	}
+	switch r.PathValue("state") {
+	case "on":
+		ptz.SetTracking(true)
+	case "off":
+		ptz.SetTracking(false)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "state must be on or off"})
+		return
+	}
+	writePTZResult(w, nil)
+}
+
+// handleLogin serves POST /api/v1/token, exchanging HTTP basic credentials for a bearer token.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if len(accounts.users) == 0 {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no users configured"})
+		return
+	}
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mCamRecorder"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "basic credentials required"})
+		return
+	}
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	if wait, ok := loginThrottle.Allow(addr, time.Now()); !ok {
+		logger.Warn(fmt.Sprintf("Throttled login for %q from %s.", name, r.RemoteAddr))
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too many login attempts, try again later"})
+		return
+	}
+	token, issued, err := accounts.login(name, password)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed login for %q from %s.", name, r.RemoteAddr))
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		return
+	}
+	logger.Info(fmt.Sprintf("Issued a %s token to %s.", issued.Role, issued.Name))
+	writeJSON(w, http.StatusOK, map[string]any{"token": token, "user": issued.Name, "role": issued.Role.String(), "expires_at": issued.expires})
+}
+
+// handleLogout serves DELETE /api/v1/token, revoking the token the request was made with.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	accounts.revoke(bearerToken(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRevokeUser serves DELETE /api/v1/users/{user}/tokens, signing a user out everywhere.
+func (s *Server) handleRevokeUser(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("user")
+	n := accounts.revokeUser(name)
+	logger.Info(fmt.Sprintf("%s revoked %d token(s) of %s.", principalFrom(r.Context()).Name, n, name))
+	writeJSON(w, http.StatusOK, map[string]int{"revoked": n})
+}
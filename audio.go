@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	audioSampleRate   = 48000
+	audioChannels     = 2
+	audioRestartDelay = 2 * time.Second
+	audioChunkSize    = 4096
+	audioQueuedChunks = 64
+	audioDisabled     = "none"
+)
+
+// audioFormats are the ffmpeg input devices accepted by --audio.
+var audioFormats = []string{"alsa", "pulse", "avfoundation", "dshow"}
+
+// parseAudioSpec splits "format:device", e.g. "alsa:hw:1,0" or "pulse:default".
+func parseAudioSpec(spec string) (format, device string, err error) {
+	format, device, ok := strings.Cut(spec, ":")
+	if !ok || device == "" {
+		return "", "", fmt.Errorf("invalid audio device %q, expected format:device, e.g. alsa:hw:1,0", spec)
+	}
+	if !slices.Contains(audioFormats, format) {
+		return "", "", fmt.Errorf("unsupported audio format %q, expected one of %s", format, strings.Join(audioFormats, ", "))
+	}
+	return format, device, nil
+}
+
+func validateAudio(spec string) error {
+	if spec == "" || spec == audioDisabled {
+		return nil
+	}
+	_, _, err := parseAudioSpec(spec)
+	return err
+}
+
+// audioEnabled reports whether any camera records audio.
+func audioEnabled() bool {
+	enabled := config.Audio != "" && config.Audio != audioDisabled
+	for _, c := range config.Cameras {
+		enabled = enabled || (c.Audio != "" && c.Audio != audioDisabled)
+	}
+	return enabled
+}
+
+// AudioSource captures one input device as raw PCM through ffmpeg and copies it to every recording
+// subscribed to it, so a single microphone can be shared by several cameras.
+type AudioSource struct {
+	spec   string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu   sync.Mutex
+	subs map[*audioSubscription]struct{}
+}
+
+// audioSubscription feeds one recording through a pipe. Chunks are dropped if the recording falls behind.
+type audioSubscription struct {
+	w      *os.File
+	chunks chan []byte
+}
+
+var (
+	audioSourcesMu sync.Mutex
+	audioSources   = map[string]*AudioSource{}
+)
+
+// audioSource returns the running source for spec, starting it on first use.
+func audioSource(spec string) *AudioSource {
+	audioSourcesMu.Lock()
+	defer audioSourcesMu.Unlock()
+	if s, ok := audioSources[spec]; ok {
+		return s
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &AudioSource{spec: spec, cancel: cancel, done: make(chan struct{}), subs: map[*audioSubscription]struct{}{}}
+	audioSources[spec] = s
+	go s.run(ctx)
+	return s
+}
+
+// closeAudioSources stops all capture processes once the recordings using them are finalized.
+func closeAudioSources() {
+	audioSourcesMu.Lock()
+	defer audioSourcesMu.Unlock()
+	for spec, s := range audioSources {
+		s.cancel()
+		<-s.done
+		delete(audioSources, spec)
+	}
+}
+
+func (s *AudioSource) run(ctx context.Context) {
+	defer close(s.done)
+	format, device, _ := parseAudioSpec(s.spec)
+	for {
+		cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error", "-nostdin",
+			"-f", format, "-i", device,
+			"-f", "s16le", "-ar", fmt.Sprint(audioSampleRate), "-ac", fmt.Sprint(audioChannels), "pipe:1")
+		cmd.Stderr = os.Stderr
+		out, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err == nil {
+			logger.Info(fmt.Sprintf("Capturing audio from %s.", s.spec))
+			s.fanOut(out)
+			err = cmd.Wait()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Error(fmt.Sprintf("Audio capture from %s stopped (%v), restarting in %v.", s.spec, err, audioRestartDelay))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(audioRestartDelay):
+		}
+	}
+}
+
+func (s *AudioSource) fanOut(r io.Reader) {
+	for {
+		buf := make([]byte, audioChunkSize)
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			for sub := range s.subs {
+				select {
+				case sub.chunks <- buf[:n]:
+				default:
+				}
+			}
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// subscribe returns the read end of a pipe that receives the source's PCM from now on.
+func (s *AudioSource) subscribe() (*os.File, *audioSubscription, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	sub := &audioSubscription{w: w, chunks: make(chan []byte, audioQueuedChunks)}
+	go func() {
+		defer sub.w.Close()
+		for chunk := range sub.chunks {
+			if _, err := sub.w.Write(chunk); err != nil {
+				break
+			}
+		}
+		for range sub.chunks {
+		}
+	}()
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	return r, sub, nil
+}
+
+// unsubscribe stops feeding sub and closes its pipe, ending the recording's audio stream.
+func (s *AudioSource) unsubscribe(sub *audioSubscription) {
+	s.mu.Lock()
+	delete(s.subs, sub)
+	s.mu.Unlock()
+	close(sub.chunks)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const backendAuto = "auto"
+
+// captureBackends are the OpenCV capture APIs --backend and the camera-settings backend key choose from.
+var captureBackends = map[string]gocv.VideoCaptureAPI{
+	backendAuto:    gocv.VideoCaptureAny,
+	"v4l2":         gocv.VideoCaptureV4L2,
+	"dshow":        gocv.VideoCaptureDshow,
+	"avfoundation": gocv.VideoCaptureAVFoundation,
+	"gstreamer":    gocv.VideoCaptureGstreamer,
+	"ffmpeg":       gocv.VideoCaptureFFmpeg,
+}
+
+func validateBackend(s string) error {
+	if _, ok := captureBackends[s]; !ok {
+		return fmt.Errorf("backend must be one of %s", strings.Join(slices.Sorted(maps.Keys(captureBackends)), ", "))
+	}
+	return nil
+}
+
+// openDevice opens a device index or stream URL with the backend. Devices default to --backend, streams
+// to whichever backend OpenCV picks for the URL.
+func openDevice(target any, backend string) (*gocv.VideoCapture, error) {
+	if _, ok := target.(int); ok {
+		backend = cmp.Or(backend, config.Backend)
+	}
+	api := captureBackends[backend]
+	if api == gocv.VideoCaptureAny {
+		return gocv.OpenVideoCapture(target)
+	}
+	return gocv.OpenVideoCaptureWithAPI(target, api)
+}
+
+// fixedMode reports whether the camera delivers a mode of its own that is recorded as it arrives, as
+// network streams and GStreamer pipelines do.
+func (c CameraConfig) fixedMode() bool {
+	return c.Source != "" || c.Pipeline != ""
+}
+
+// pipelineCameraSettings lists the camera-settings entries with a GStreamer pipeline whose ID is not
+// one of the local cameras, so they are opened without a device behind the ID.
+func pipelineCameraSettings(localIDs []int) []CameraConfig {
+	var settings []CameraConfig
+	for _, c := range config.Cameras {
+		if c.Pipeline == "" || c.Serial != "" || c.USBPort != "" || slices.Contains(localIDs, c.ID) {
+			continue
+		}
+		settings = append(settings, cameraSettings(c.ID))
+	}
+	return settings
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gocv.io/x/gocv"
+)
+
+// bundleProxyCRF is the x264 quality of the proxies; reviewers need to see what happened, not every detail.
+const bundleProxyCRF = 28
+
+var bundlePage = template.Must(template.New("bundle").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Session {{.SessionID}}</title>
+<style>body{background:#111;color:#ddd;font-family:sans-serif;margin:16px}a{color:#9cf}
+.files{display:flex;flex-wrap:wrap;gap:12px}.file{width:480px}video{width:100%;background:#000}
+table{border-collapse:collapse}td,th{padding:2px 8px;text-align:left}tr.marker{cursor:pointer}tr.marker:hover{background:#333}</style></head>
+<body><h2>Session {{.SessionID}}</h2>
+<p>Recorded {{.Started}}{{if .Ended}} to {{.Ended}}{{end}} with mCamRecorder {{.Version}}. <a href="{{.Manifest}}">Manifest</a></p>
+{{if .Markers}}<h3>Markers</h3>
+<p>Click a marker to show every camera at that moment.</p>
+<table><tr><th>Time</th><th>Camera</th><th>Source</th><th>Note</th></tr>
+{{range .Markers}}<tr class="marker" data-time="{{.At}}"><td>{{.Time}}</td><td>{{.Camera}}</td><td>{{.Source}}</td><td>{{.Note}}</td></tr>
+{{end}}</table>{{end}}
+{{range .Cameras}}<h3>{{.Label}}</h3>
+<div class="files">{{range .Files}}<div class="file">
+<video controls preload="none"{{if .Thumb}} poster="{{.Thumb}}"{{end}} src="{{.Video}}" data-start="{{.Start}}"></video>
+<div>{{.Name}}{{if .Start}} · {{.Started}}{{end}} · <a href="{{.Video}}" download>download</a></div>
+</div>{{end}}</div>{{end}}
+<script>
+document.querySelectorAll("tr.marker").forEach(function (row) {
+  row.addEventListener("click", function () {
+    var t = Number(row.dataset.time);
+    document.querySelectorAll("video").forEach(function (v) {
+      var start = Number(v.dataset.start);
+      if (!start) return;
+      var seek = function () {
+        var at = (t - start) / 1000;
+        if (at >= 0 && at <= v.duration) { v.currentTime = at; } else { v.pause(); }
+      };
+      if (v.readyState > 0) { seek(); } else { v.preload = "metadata"; v.addEventListener("loadedmetadata", seek, {once: true}); v.load(); }
+    });
+  });
+});
+</script>
+</body></html>`))
+
+type bundleFile struct {
+	Name, Video, Thumb, Started string
+	// Start is when the first frame was captured, in Unix milliseconds, for seeking to markers.
+	Start int64
+}
+
+type bundleCamera struct {
+	Label string
+	Files []bundleFile
+}
+
+type bundleMarker struct {
+	Time, Source, Note, Camera string
+	At                         int64
+}
+
+func bundleCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "bundle",
+		Usage:     "Package a session's recordings, manifest, markers, thumbnails and an offline HTML viewer into one zip for reviewers",
+		ArgsUsage: "<session-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "out", Usage: "Zip file to write (default <output-dir>/session_<id>_review.zip)"},
+			&cli.IntFlag{Name: "proxy-width", Usage: "Re-encode the recordings with ffmpeg into H.264 proxies this wide, which every browser plays, instead of including the originals (originals if zero)", Validator: func(n int) error {
+				if n < 0 || n%2 != 0 {
+					return errors.New("proxy width must be an even number of pixels")
+				}
+				return nil
+			}},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := setup(cmd); err != nil {
+				return err
+			}
+			if cmd.Args().Len() != 1 {
+				return errors.New("bundle takes the session ID, e.g. bundle 1714557600")
+			}
+			sessionID := cmd.Args().First()
+			out := cmp.Or(cmd.String("out"), filepath.Join(config.OutputDir, fmt.Sprintf("session_%s_review.zip", sessionID)))
+			return bundleSession(ctx, sessionID, out, cmd.Int("proxy-width"))
+		},
+	}
+}
+
+// bundleSession writes the review zip of a session: index.html, the manifest, and per recording the
+// video or its proxy under videos/, a thumbnail under thumbs/ and its timestamp sidecars.
+func bundleSession(ctx context.Context, sessionID, out string, proxyWidth int) error {
+	m, err := readManifest(config.OutputDir, sessionID)
+	if err != nil {
+		return fmt.Errorf("could not open session %s: %w", sessionID, err)
+	}
+	if proxyWidth > 0 {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			return errors.New("ffmpeg is required for proxies but was not found in PATH")
+		}
+	}
+	starts := map[string]time.Time{}
+	if m.Offsets != nil {
+		for _, f := range m.Offsets.Files {
+			starts[f.File] = f.FirstFrame
+		}
+	}
+
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	zw := zip.NewWriter(f)
+
+	page := struct {
+		SessionID, Version, Started, Ended, Manifest string
+		Cameras                                      []bundleCamera
+		Markers                                      []bundleMarker
+	}{SessionID: m.SessionID, Version: m.Version, Started: m.StartedAt.Format(time.DateTime), Manifest: filepath.Base(m.path)}
+	if m.EndedAt != nil {
+		page.Ended = m.EndedAt.Format(time.DateTime)
+	}
+	for _, mk := range m.Markers {
+		cam := "all"
+		if mk.CamID != allCameras {
+			cam = strconv.Itoa(mk.CamID)
+		}
+		page.Markers = append(page.Markers, bundleMarker{Time: mk.Time.Format(time.DateTime), Source: mk.Source, Note: mk.Note,
+			Camera: cam, At: mk.Time.UnixMilli()})
+	}
+
+	written := 0
+	for _, cam := range m.Cameras {
+		bc := bundleCamera{Label: cmp.Or(cam.Label, fmt.Sprintf("Cam %d", cam.ID))}
+		for _, file := range cam.Files {
+			src := m.absPath(file)
+			bf, err := bundleRecording(ctx, zw, src, bundleName(cam.ID, file), cam.FPS, proxyWidth)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Cam %d: leaving %s out of the bundle: %v.", cam.ID, file, err))
+				continue
+			}
+			if start := starts[file]; !start.IsZero() {
+				bf.Start, bf.Started = start.UnixMilli(), start.Format(time.DateTime)
+			}
+			bc.Files = append(bc.Files, bf)
+			written++
+		}
+		page.Cameras = append(page.Cameras, bc)
+	}
+	if written == 0 {
+		_ = zw.Close()
+		_ = f.Close()
+		return errors.New("the session has no recordings to bundle")
+	}
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = bundleWrite(zw, page.Manifest, bytes.NewReader(manifest), zip.Deflate)
+	}
+	if err == nil {
+		var html bytes.Buffer
+		if err = bundlePage.Execute(&html, page); err == nil {
+			err = bundleWrite(zw, "index.html", &html, zip.Deflate)
+		}
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", out, err)
+	}
+	if err = os.Rename(tmp, out); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("Saved review bundle of session %s with %d recording(s): %s.", sessionID, written, out))
+	return nil
+}
+
+// bundleName is the path of a manifest file in the bundle: its path relative to the manifest, which
+// keeps the files of a --name-template such as cam{cam_id}/{index} apart, or for a file outside the
+// session directory, e.g. on the fallback disk, its name under one directory per camera.
+func bundleName(camID int, file string) string {
+	if filepath.IsAbs(file) {
+		return path.Join(fmt.Sprintf("cam%d", camID), filepath.Base(file))
+	}
+	return filepath.ToSlash(file)
+}
+
+// bundleRecording adds one recording, or its proxy, with its thumbnail and sidecars to the zip under
+// name, a slash separated path.
+func bundleRecording(ctx context.Context, zw *zip.Writer, src, name string, fps float64, proxyWidth int) (bundleFile, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return bundleFile{}, err
+	}
+	if fi.IsDir() && proxyWidth == 0 {
+		return bundleFile{}, errors.New("png sequences are only bundled as proxies, see --proxy-width")
+	}
+	base := strings.TrimSuffix(name, path.Ext(name))
+	bf := bundleFile{Name: name, Video: path.Join("videos", name)}
+
+	video := src
+	if proxyWidth > 0 {
+		tmp, err := os.MkdirTemp("", "mcam-bundle")
+		if err != nil {
+			return bundleFile{}, err
+		}
+		defer os.RemoveAll(tmp)
+		video = filepath.Join(tmp, path.Base(base)+".mp4")
+		if err := encodeProxy(ctx, src, video, fps, proxyWidth, fi.IsDir()); err != nil {
+			return bundleFile{}, err
+		}
+		bf.Video = path.Join("videos", base+".mp4")
+	}
+	in, err := os.Open(video)
+	if err != nil {
+		return bundleFile{}, err
+	}
+	defer in.Close()
+	// Video is compressed already, so it is stored as is.
+	if err := bundleWrite(zw, bf.Video, in, zip.Store); err != nil {
+		return bundleFile{}, err
+	}
+
+	if thumb, err := videoThumbnail(video); err == nil {
+		bf.Thumb = path.Join("thumbs", base+".jpg")
+		if err := bundleWrite(zw, bf.Thumb, bytes.NewReader(thumb), zip.Store); err != nil {
+			return bundleFile{}, err
+		}
+	}
+	srcBase := strings.TrimSuffix(src, filepath.Ext(src))
+	sidecars := map[string]string{}
+	for _, sidecar := range []string{".timestamps.csv", ".srt", ".index.csv"} {
+		sidecars[base+sidecar] = srcBase + sidecar
+	}
+	if fi.IsDir() {
+		sidecars[base+".index.csv"] = filepath.Join(src, "index.csv")
+	}
+	for name, file := range sidecars {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		if err := bundleWrite(zw, path.Join("videos", name), bytes.NewReader(data), zip.Deflate); err != nil {
+			return bundleFile{}, err
+		}
+	}
+	return bf, nil
+}
+
+func bundleWrite(zw *zip.Writer, name string, r io.Reader, method uint16) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// encodeProxy re-encodes src, a video or a --lossless png directory, into a small H.264 mp4 at dst.
+func encodeProxy(ctx context.Context, src, dst string, fps float64, width int, pngSequence bool) error {
+	input := []string{"-i", src}
+	if pngSequence {
+		input = []string{"-framerate", strconv.FormatFloat(cmp.Or(fps, 30), 'f', -1, 64), "-i", filepath.Join(src, "frame_%06d.png")}
+	}
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y"}, input...)
+	args = append(args, "-map", "0:v:0", "-map", "0:a:0?", "-vf", fmt.Sprintf("scale='min(%d,iw)':-2", width),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", strconv.Itoa(bundleProxyCRF), "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-movflags", "+faststart", dst)
+	if out, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// videoThumbnail is a JPEG of the middle frame of a video, thumbnailWidth wide.
+func videoThumbnail(file string) ([]byte, error) {
+	video, err := gocv.VideoCaptureFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer video.Close()
+	if frames := video.Get(gocv.VideoCaptureFrameCount); frames > 1 {
+		video.Set(gocv.VideoCapturePosFrames, frames/2)
+	}
+	frame := gocv.NewMat()
+	defer frame.Close()
+	if !video.Read(&frame) || frame.Empty() {
+		return nil, errors.New("no frames")
+	}
+	thumb := gocv.NewMat()
+	defer thumb.Close()
+	size := image.Pt(thumbnailWidth, max(1, frame.Rows()*thumbnailWidth/max(1, frame.Cols())))
+	if err := gocv.Resize(frame, &thumb, size, 0, 0, gocv.InterpolationArea); err != nil {
+		return nil, err
+	}
+	buf, err := gocv.IMEncode(gocv.JPEGFileExt, thumb)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Close()
+	return bytes.Clone(buf.GetBytes()), nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// do runs fn on the camera's capture goroutine between two frames. All camera state
+// except the latest-frame slot is owned by that goroutine.
+func (c *Camera) do(fn func()) {
+	select {
+	case c.ctrl <- fn:
+	case <-c.done:
+	}
+}
+
+// start runs the camera on its own goroutine until ctx is cancelled or the camera is removed.
+func (c *Camera) start(ctx context.Context, gov *Governor) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	go c.run(ctx, gov)
+}
+
+// run captures, processes and records frames at the camera's own rate until ctx is cancelled.
+func (c *Camera) run(ctx context.Context, gov *Governor) {
+	defer close(c.done)
+	for {
+		for pending := true; pending; {
+			select {
+			case fn := <-c.ctrl:
+				fn()
+			default:
+				pending = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if !c.captureFrame(gov) {
+			c.showPlaceholder()
+			c.onReadFailure(time.Now())
+			c.reconnect()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(float64(time.Second) / c.FPS)):
+			}
+		}
+	}
+}
+
+func (c *Camera) captureFrame(gov *Governor) bool {
+	span := telemetry.startFrame(c.ID)
+	defer span.End()
+
+	if c.offline {
+		return false
+	}
+	endStage := span.stage("capture")
+	readStart := time.Now()
+	ok := c.read()
+	readAt := time.Now()
+	endStage()
+	if c.FrameLog != nil {
+		c.FrameLog.Record(readAt, readAt.Sub(readStart), c.Capture.Get(gocv.VideoCapturePosMsec), !ok || c.Frame.Empty())
+	}
+	if !ok || c.Frame.Empty() {
+		telemetry.add(metricFramesDropped, c.ID, 1)
+		c.framesDropped.Add(1)
+		return false
+	}
+	telemetry.add(metricFramesCaptured, c.ID, 1)
+	c.framesCaptured.Add(1)
+	c.onReadSuccess(readAt)
+	c.lastFrameAt.Store(readAt.UnixNano())
+	c.checkFrameRate(readAt)
+	if privacy.Load() {
+		c.showPrivacy()
+		return true
+	}
+
+	if config.QualityAlert > 0 {
+		c.checkQuality(c.Frame, readAt)
+	}
+	if config.Tamper {
+		c.detectTamper(c.Frame, readAt)
+	}
+	c.autoSnapshot(readAt)
+
+	endStage = span.stage("process")
+	// queued is the frame handed to the write queue; it goes back to the pool through shared once both
+	// the queue and this function are done with it.
+	var queued gocv.Mat
+	var shared func(gocv.Mat)
+	release := func(mat *gocv.Mat) {
+		if shared != nil && mat.Ptr() == queued.Ptr() {
+			shared(*mat)
+			return
+		}
+		c.frames.Release(*mat)
+	}
+	transformed := c.frames.Acquire()
+	defer release(&transformed)
+	c.transformInto(&transformed, c.Frame, c.Rotation, c.Mirror)
+	// display is what the viewer, streams and API show; it only differs from the written frame in the
+	// overlay, see --overlay-target. A write queue may still be encoding the frame while the preview's
+	// overlay is drawn, so that goes on a copy.
+	display := transformed
+	if config.EnableOverlay && (config.OverlayTarget == overlayTargetFile || config.OverlayTarget == overlayTargetPreview && config.WriteQueue > 0) {
+		display = c.frames.Copy(transformed)
+		defer c.frames.Release(display)
+	}
+	if config.EnableOverlay && config.OverlayTarget != overlayTargetPreview {
+		c.addOverlay(&transformed)
+	}
+	// recorded is what goes into the files, transformed scaled to --record-size.
+	recorded := transformed
+	if c.scalesRecording() {
+		recorded = c.frames.Acquire()
+		defer release(&recorded)
+		c.scaleForRecording(&recorded, transformed)
+	}
+	endStage()
+
+	c.followOutputDir()
+	if c.Writer == nil && c.Recording() && readAt.After(c.writerRetryAt) {
+		c.rolloverWriter()
+	}
+	if c.Writer != nil && !c.Paused() && !gov.SkipRecord(c.ID) && c.lapseSample(readAt) {
+		endStage = span.stage("write")
+		if c.ROI.Empty() {
+			share := c.frames.Share()
+			if c.writeFrame(recorded, readAt, share) {
+				queued, shared = recorded, share
+			}
+		} else {
+			encoded := degradePeriphery(recorded, c.ROI, c.ROIBlur)
+			if !c.writeFrame(encoded, readAt, closeMat) {
+				_ = encoded.Close()
+			}
+		}
+		endStage()
+		switch {
+		case c.writeFailures.Load() >= maxWriteFailures:
+			c.rolloverWriter()
+		case config.MaxFrames > 0 && c.framesWritten.Load()+c.framesQueued() >= config.MaxFrames:
+			logger.Info(fmt.Sprintf("Cam %d has written %d frames.", c.ID, config.MaxFrames))
+			c.stopRecording()
+		case segmenting() && c.segmentDue(readAt):
+			c.rotateSegment()
+		}
+	}
+	if armed() && scheduleOpen.Load() && !c.Paused() {
+		c.writeTimelapse(recorded)
+	}
+	for _, sink := range c.Sinks {
+		sink.Push(transformed)
+	}
+	if c.Clips != nil {
+		c.Clips.Push(recorded, readAt)
+	}
+	if c.Motion != nil && armed() && scheduleOpen.Load() {
+		c.detectMotion(transformed, recorded, readAt)
+	}
+	if config.SceneChange != sceneOff && armed() && !c.Paused() {
+		c.detectScene(transformed, readAt)
+	}
+	if config.EnableOverlay && config.OverlayTarget == overlayTargetPreview {
+		c.addOverlay(&display)
+	}
+	if c.Paused() {
+		drawPaused(&display)
+	}
+	c.setLatest(display)
+	gov.Observe(time.Since(readAt))
+	return true
+}
+
+// previewFrame returns a copy of the latest frame, or the placeholder if there is none yet.
+func (c *Camera) previewFrame() gocv.Mat {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.latest.Empty() {
+		return c.placeholderFrame()
+	}
+	return c.latest.Clone()
+}
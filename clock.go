@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	clockSystem = "system"
+	clockNTP    = "ntp"
+	clockGPS    = "gps"
+	clockAPI    = "api"
+
+	defaultNTPServer = "pool.ntp.org"
+	ntpPollInterval  = time.Minute
+	ntpTimeout       = 5 * time.Second
+	// ntpEpochOffset is the number of seconds from the NTP epoch, 1900, to the Unix epoch.
+	ntpEpochOffset = 2208988800
+)
+
+var errOverlayClock = errors.New("overlay clock must be system, ntp, ntp:<server>, gps or api")
+
+// clockOffset is what --overlay-clock says the local clock is behind by, in nanoseconds.
+var clockOffset atomic.Int64
+
+func validateOverlayClock(s string) error {
+	switch s {
+	case clockSystem, clockNTP, clockGPS, clockAPI:
+		return nil
+	}
+	if server, ok := strings.CutPrefix(s, clockNTP+":"); ok && server != "" {
+		return nil
+	}
+	return errOverlayClock
+}
+
+// clockNow is the time burnt into the overlay, the local clock corrected by --overlay-clock.
+func clockNow() time.Time {
+	return time.Now().Add(time.Duration(clockOffset.Load()))
+}
+
+// setClock corrects the overlay clock so that the local time at maps to ref.
+func setClock(ref, at time.Time, source string) {
+	offset := ref.Sub(at)
+	if old := time.Duration(clockOffset.Swap(int64(offset))); (old - offset).Abs() > time.Second {
+		logger.Info(fmt.Sprintf("Overlay clock set from %s, %v from the system clock.", source, offset.Round(time.Millisecond)))
+	}
+}
+
+// runNTPClock keeps the overlay clock on an NTP server until ctx is cancelled.
+func runNTPClock(ctx context.Context, server string) {
+	ticker := time.NewTicker(ntpPollInterval)
+	defer ticker.Stop()
+	failing := false
+	for {
+		offset, err := queryNTP(server)
+		if err != nil {
+			if !failing {
+				logger.Error(fmt.Sprintf("Failed to query NTP server %s: %v.", server, err))
+			}
+		} else {
+			now := time.Now()
+			setClock(now.Add(offset), now, server)
+		}
+		failing = err != nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queryNTP asks an SNTP server how far the local clock is behind it.
+func queryNTP(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, ntpTimeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ntpTimeout))
+
+	req := make([]byte, 48)
+	// Leap indicator 0, version 4, client mode.
+	req[0] = 0x23
+	sent := time.Now()
+	binary.BigEndian.PutUint64(req[40:], ntpTime(sent))
+	if _, err = conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < 48 || resp[0]&0x07 != 4 || resp[1] == 0 {
+		return 0, errors.New("invalid or unsynchronised NTP reply")
+	}
+	serverReceived := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	serverSent := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+	return (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+
+func ntpTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+func fromNTPTime(v uint64) time.Time {
+	secs := int64(v>>32) - ntpEpochOffset
+	nanos := int64((v & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(secs, nanos)
+}
+
+// startClock starts following the --overlay-clock source; gps and api are set as fixes and requests arrive.
+func startClock(ctx context.Context) {
+	switch {
+	case strings.HasPrefix(config.OverlayClock, clockNTP):
+		server := defaultNTPServer
+		if s, ok := strings.CutPrefix(config.OverlayClock, clockNTP+":"); ok {
+			server = s
+		}
+		go runNTPClock(ctx, server)
+	case config.OverlayClock == clockGPS && config.GPS == "":
+		logger.Warn("--overlay-clock gps needs --gps, the overlay uses the system clock.")
+	case config.OverlayClock == clockAPI && config.Serve == "":
+		logger.Warn("--overlay-clock api needs --serve, the overlay uses the system clock.")
+	}
+}
+
+type apiClock struct {
+	Time time.Time `json:"time"`
+}
+
+// handleClock sets the overlay clock from a controller's master clock with --overlay-clock api.
+func (s *Server) handleClock(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if config.OverlayClock != clockAPI {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "the overlay clock is not set over the API, see --overlay-clock"})
+		return
+	}
+	var req apiClock
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid clock: %v", err)})
+		return
+	}
+	if req.Time.IsZero() {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid clock: time is required"})
+		return
+	}
+	setClock(req.Time, at, "the API")
+	writeJSON(w, http.StatusOK, map[string]any{"offset_ms": float64(clockOffset.Load()) / 1e6})
+}
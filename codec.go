@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// knownFormats are the codec/container pairs offered when the requested one is not supported.
+var knownFormats = [][2]string{
+	{"mp4v", "mp4"}, {"avc1", "mp4"}, {"H264", "mp4"}, {"H264", "mkv"},
+	{"MJPG", "avi"}, {"MJPG", "mkv"}, {"XVID", "avi"}, {"XVID", "mkv"},
+	{"FFV1", "mkv"}, {"VP80", "webm"}, {"VP90", "webm"},
+}
+
+// writerSupported reports whether the local OpenCV build can write codec into a container file.
+func writerSupported(codec, container string) bool {
+	dir, err := os.MkdirTemp("", "mcam-probe-")
+	if err != nil {
+		return false
+	}
+	defer os.RemoveAll(dir)
+	writer, err := gocv.VideoWriterFile(filepath.Join(dir, "probe."+container), codec, 30, 64, 64, true)
+	if err != nil {
+		return false
+	}
+	defer writer.Close()
+	return writer.IsOpened()
+}
+
+func supportedFormats() []string {
+	var supported []string
+	for _, f := range knownFormats {
+		if writerSupported(f[0], f[1]) {
+			supported = append(supported, f[0]+"/"+f[1])
+		}
+	}
+	return supported
+}
+
+// checkWriterFormats verifies the configured codec and per-camera codecs against the container.
+// An unsupported global codec falls back to the first supported known pair. The ffmpeg writer is not checked.
+func checkWriterFormats() error {
+	if config.Writer == writerFFmpeg {
+		return nil
+	}
+	codecs := []string{config.Codec}
+	for _, c := range config.Cameras {
+		if c.Codec != "" && !strings.EqualFold(c.Codec, config.Codec) {
+			codecs = append(codecs, c.Codec)
+		}
+	}
+
+	var unsupported []string
+	for _, codec := range codecs {
+		if !writerSupported(codec, config.Container) {
+			unsupported = append(unsupported, codec)
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+
+	supported := supportedFormats()
+	if len(supported) == 0 {
+		return errors.New("this OpenCV build cannot write any known codec/container combination")
+	}
+	if unsupported[0] != config.Codec {
+		return fmt.Errorf("codec %s is not supported in .%s files by this OpenCV build, supported: %s",
+			strings.Join(unsupported, ", "), config.Container, strings.Join(supported, ", "))
+	}
+	codec, container, _ := strings.Cut(supported[0], "/")
+	logger.Warn(fmt.Sprintf("Codec %s is not supported in .%s files by this OpenCV build, falling back to %s/%s. Supported: %s.",
+		config.Codec, config.Container, codec, container, strings.Join(supported, ", ")))
+	config.Codec, config.Container = codec, container
+	return checkWriterFormats()
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gocv.io/x/gocv"
+)
+
+const (
+	// snapshotWarmup is how long the snapshot command lets auto exposure settle before keeping a frame.
+	snapshotWarmup = time.Second
+	snapshotFrames = 30
+)
+
+// setup applies the config file and flags shared by every subcommand.
+func setup(cmd *cli.Command) error {
+	if err := loadConfigFile(cmd); err != nil {
+		return err
+	}
+	parseConfig(cmd)
+	if remoteStorage() && cmd.IsSet("writer") && cmd.String("writer") != writerFFmpeg {
+		return fmt.Errorf("--storage streams recordings through ffmpeg and cannot be used with --writer %s", cmd.String("writer"))
+	}
+	if config.Intermediate != "" && cmd.IsSet("writer") && cmd.String("writer") != writerFFmpeg {
+		return fmt.Errorf("--intermediate is encoded by ffmpeg and cannot be used with --writer %s", cmd.String("writer"))
+	}
+	if config.Intermediate != "" && (config.Lossless != "" || slices.ContainsFunc(config.Cameras, func(c CameraConfig) bool { return c.Lossless != "" })) {
+		return errors.New("--intermediate cannot be used with --lossless recordings")
+	}
+	if config.ViewerOnly {
+		viewerOnly()
+	}
+	if err := loadUsers(config.Users); err != nil {
+		return err
+	}
+	if config.PipeStdout != "" {
+		// stdout carries video, keep everything else on stderr.
+		cmd.Root().Writer = os.Stderr
+		signal.Ignore(syscall.SIGPIPE)
+	}
+	return nil
+}
+
+func commands() []*cli.Command {
+	return []*cli.Command{
+		{
+			Name:  "list",
+			Usage: "List the cameras with the mode each one opens in and the modes it supports, then exit",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "json", Usage: "Print the cameras as JSON"},
+			},
+			Action: func(_ context.Context, cmd *cli.Command) error {
+				if err := setup(cmd); err != nil {
+					return err
+				}
+				return listCameras(cmd.Root().Writer, cmd.Bool("json"))
+			},
+		},
+		{
+			Name:  "record",
+			Usage: "Record every camera until ESC, a stop command or --duration",
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				if err := setup(cmd); err != nil {
+					return err
+				}
+				if config.Supervise && !supervised() {
+					return runSupervisor(ctx)
+				}
+				startCapture()
+				return nil
+			},
+		},
+		{
+			Name:  "preview",
+			Usage: "Show and stream the cameras without writing any files",
+			Action: func(_ context.Context, cmd *cli.Command) error {
+				if err := setup(cmd); err != nil {
+					return err
+				}
+				previewOnly()
+				startCapture()
+				return nil
+			},
+		},
+		{
+			Name:  "snapshot",
+			Usage: "Save one still from each camera into --snapshot-dir and exit",
+			Action: func(_ context.Context, cmd *cli.Command) error {
+				if err := setup(cmd); err != nil {
+					return err
+				}
+				previewOnly()
+				return snapshotCameras()
+			},
+		},
+		syncCommand(),
+		contactSheetCommand(),
+		watchCommand(),
+		fitCommand(),
+		bundleCommand(),
+		simulateCommand(),
+		sweepCommand(),
+	}
+}
+
+// previewOnly turns off everything that writes files.
+func previewOnly() {
+	config.Preview = true
+	config.MotionTrigger = false
+	config.EventClips = false
+	config.TimelapseInterval = 0
+	config.SnapshotInterval = 0
+	config.RecordGrid = false
+	config.Timestamps = ""
+	config.FrameLog = false
+	config.StartDelay = 0
+}
+
+// viewerOnly leaves only the preview window: no files, server, control inputs or local cameras, which
+// belong to the recorder being watched.
+func viewerOnly() {
+	previewOnly()
+	config.Headless = false
+	config.Hotplug = false
+	config.Serve = ""
+	config.ControlDir = ""
+	config.FIFOs = nil
+	config.PipeStdout = ""
+	config.Quorum = ""
+}
+
+// cameraSettingsToOpen lists the local cameras from --cameras, or the indexes below --max-cam that open,
+// followed by the --source cameras.
+func cameraSettingsToOpen() []CameraConfig {
+	var ids []int
+	if config.Devices != "" {
+		ids, _ = parseCameraList(config.Devices)
+	} else {
+		ids = detectVideoDevices(config.MaxCam)
+	}
+	var settings []CameraConfig
+	for _, id := range ids {
+		settings = append(settings, cameraSettings(id))
+	}
+	settings = append(settings, pipelineCameraSettings(ids)...)
+	return append(settings, networkCameraSettings(ids)...)
+}
+
+type deviceInfo struct {
+	ID      int            `json:"id"`
+	Device  string         `json:"device"`
+	Name    string         `json:"name,omitempty"`
+	USB     string         `json:"usb,omitempty"`
+	Serial  string         `json:"serial,omitempty"`
+	USBPort string         `json:"usb_port,omitempty"`
+	Mode    string         `json:"mode"`
+	FourCC  string         `json:"fourcc,omitempty"`
+	Formats []deviceFormat `json:"formats,omitempty"`
+}
+
+// deviceFormat is a pixel format a camera offers with its frame sizes and rates.
+type deviceFormat struct {
+	FourCC      string      `json:"fourcc"`
+	Description string      `json:"description,omitempty"`
+	Sizes       []frameSize `json:"sizes"`
+}
+
+type frameSize struct {
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	FPS    []float64 `json:"fps,omitempty"`
+}
+
+// describeCamera opens a camera in the requested mode to report the mode it actually delivers, and
+// lists the modes a local camera supports.
+func describeCamera(s CameraConfig) deviceInfo {
+	info := deviceInfo{ID: s.ID, Device: fmt.Sprintf("/dev/video%d", s.ID), Name: videoDeviceName(s.ID), Mode: "could not open"}
+	if s.Pipeline != "" {
+		info.Device, info.Name = "GStreamer pipeline", "pipeline"
+	} else if s.Source != "" {
+		info.Device, info.Name = redactURL(s.Source), "network"
+	} else if d, ok := usbDeviceForCamera(s.ID); ok {
+		info.USB = fmt.Sprintf("bus %s port %s, %.0f Mbps", d.Bus, d.Path, d.SpeedMbps)
+		info.Serial, info.USBPort = d.Serial, d.Path
+	}
+	capture, err := openCapture(s)
+	if err != nil || !capture.IsOpened() {
+		if capture != nil {
+			_ = capture.Close()
+		}
+		return info
+	}
+	if !s.fixedMode() {
+		if config.InputFourCC != "" {
+			capture.Set(gocv.VideoCaptureFOURCC, capture.ToCodec(config.InputFourCC))
+		}
+		capture.Set(gocv.VideoCaptureFrameWidth, s.Width)
+		capture.Set(gocv.VideoCaptureFrameHeight, s.Height)
+		capture.Set(gocv.VideoCaptureFPS, s.FPS)
+	}
+	info.Mode = fmt.Sprintf("%.0fx%.0f @ %.2f fps", capture.Get(gocv.VideoCaptureFrameWidth), capture.Get(gocv.VideoCaptureFrameHeight), capture.Get(gocv.VideoCaptureFPS))
+	info.FourCC = capture.CodecString()
+	_ = capture.Close()
+
+	if !s.fixedMode() {
+		if info.Formats, err = probeFormats(s.ID); err != nil {
+			logger.Warn(fmt.Sprintf("Could not list the modes of cam %d: %v.", s.ID, err))
+		}
+	}
+	return info
+}
+
+func listCameras(w io.Writer, asJSON bool) error {
+	settings := cameraSettingsToOpen()
+	if len(settings) == 0 {
+		return errors.New("no cameras found")
+	}
+	devices := make([]deviceInfo, 0, len(settings))
+	for _, s := range settings {
+		devices = append(devices, describeCamera(s))
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(devices)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDEVICE\tNAME\tMODE\tFOURCC\tUSB\tSERIAL")
+	for _, d := range devices {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", d.ID, d.Device, d.Name, d.Mode, d.FourCC, d.USB, d.Serial)
+		for _, f := range d.Formats {
+			for _, s := range f.Sizes {
+				rates := make([]string, 0, len(s.FPS))
+				for _, fps := range s.FPS {
+					rates = append(rates, strconv.FormatFloat(fps, 'f', -1, 64))
+				}
+				fmt.Fprintf(tw, "\t\t\t%dx%d @ %s fps\t%s\t\t\n", s.Width, s.Height, cmp.Or(strings.Join(rates, ", "), "?"), f.FourCC)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// snapshotCameras saves one frame from every camera, after letting it settle for snapshotWarmup.
+func snapshotCameras() error {
+	settings := cameraSettingsToOpen()
+	if len(settings) == 0 {
+		return errors.New("no cameras found")
+	}
+	saved := 0
+	for _, s := range settings {
+		cam, err := openCamera(s)
+		if err != nil {
+			logger.Error(err.Error())
+			continue
+		}
+		still := gocv.NewMat()
+		deadline := time.Now().Add(snapshotWarmup)
+		for range snapshotFrames {
+			if cam.Capture.Read(&cam.Frame) && !cam.Frame.Empty() {
+				_ = cam.Frame.CopyTo(&still)
+				if time.Now().After(deadline) {
+					break
+				}
+			}
+		}
+		if still.Empty() {
+			logger.Error(fmt.Sprintf("Cam %d delivered no frame.", cam.ID))
+			_ = still.Close()
+			cam.Close()
+			continue
+		}
+		frame := cam.renderSnapshot(&still)
+		_ = still.Close()
+		saveSnapshot(frame, cam, time.Now(), "")
+		_ = frame.Close()
+		cam.Close()
+		saved++
+	}
+	if saved == 0 {
+		return errors.New("no snapshot taken")
+	}
+	return nil
+}
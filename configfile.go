@@ -0,0 +1,297 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
+)
+
+// CameraConfig overrides the global capture settings for one camera; zero values keep the global setting.
+type CameraConfig struct {
+	ID       int     `yaml:"id"`
+	Width    float64 `yaml:"width"`
+	Height   float64 `yaml:"height"`
+	FPS      float64 `yaml:"fps"`
+	Rotation int     `yaml:"rotation"`
+	Mirror   bool    `yaml:"mirror"`
+	Codec    string  `yaml:"codec"`
+	Encoder  string  `yaml:"encoder"`
+	HWDevice int     `yaml:"hw-device"`
+	Name     string  `yaml:"name"`
+	Label    string  `yaml:"label"`
+	Serial   string  `yaml:"serial"`
+	USBPort  string  `yaml:"usb-port"`
+	ROI      string  `yaml:"roi"`
+	ROIBlur  int     `yaml:"roi-blur"`
+	Audio    string  `yaml:"audio"`
+	Color    string  `yaml:"color"`
+	ONVIF    string  `yaml:"onvif"`
+	Backend  string  `yaml:"backend"`
+	Pipeline string  `yaml:"pipeline"`
+	Lens     *Lens   `yaml:"lens"`
+	Pose     *Pose   `yaml:"pose"`
+	Source   string  `yaml:"-"`
+	// RecordSize is the WxH the camera's files are scaled down to, see --record-size.
+	RecordSize string `yaml:"record-size"`
+	Zones      []Zone `yaml:"zones"`
+	// Lossless records the camera as png, ffv1 or huffyuv, see --lossless.
+	Lossless string `yaml:"lossless"`
+	// FileIndex is the number of files the camera already has in a resumed session.
+	FileIndex int `yaml:"-"`
+}
+
+// parseCamMode parses a --cam value "id:WxH[@fps]" or "id:@fps".
+func parseCamMode(spec string) (CameraConfig, error) {
+	var c CameraConfig
+	id, mode, ok := strings.Cut(spec, ":")
+	n, err := strconv.Atoi(id)
+	if !ok || err != nil || n < 0 {
+		return c, fmt.Errorf("invalid camera mode %q, expected id:WxH@fps, e.g. 0:1920x1080@30", spec)
+	}
+	c.ID = n
+	size, fps, hasFPS := strings.Cut(mode, "@")
+	if hasFPS {
+		if c.FPS, err = strconv.ParseFloat(fps, 64); err != nil || c.FPS <= 0 {
+			return c, fmt.Errorf("invalid frame rate %q in %q", fps, spec)
+		}
+	}
+	if size != "" {
+		w, h, ok := strings.Cut(size, "x")
+		width, werr := strconv.Atoi(w)
+		height, herr := strconv.Atoi(h)
+		if !ok || werr != nil || herr != nil || width <= 0 || height <= 0 {
+			return c, fmt.Errorf("invalid resolution %q in %q", size, spec)
+		}
+		c.Width, c.Height = float64(width), float64(height)
+	} else if !hasFPS {
+		return c, fmt.Errorf("invalid camera mode %q, expected id:WxH@fps, e.g. 0:1920x1080@30", spec)
+	}
+	return c, nil
+}
+
+// applyCamModes merges --cam values into the per-camera settings, taking precedence over the config file.
+func applyCamModes(specs []string) {
+	for _, spec := range specs {
+		mode, _ := parseCamMode(spec)
+		i := slices.IndexFunc(config.Cameras, func(c CameraConfig) bool { return c.ID == mode.ID })
+		if i < 0 {
+			config.Cameras = append(config.Cameras, mode)
+			continue
+		}
+		if mode.Width > 0 {
+			config.Cameras[i].Width, config.Cameras[i].Height = mode.Width, mode.Height
+		}
+		if mode.FPS > 0 {
+			config.Cameras[i].FPS = mode.FPS
+		}
+	}
+}
+
+// matches reports whether the entry configures /dev/video<id>. Entries with a USB serial number or port
+// follow the camera to whatever index it gets after a reboot or replug; the others match by index.
+func (c CameraConfig) matches(id int) bool {
+	if c.Serial == "" && c.USBPort == "" {
+		return c.ID == id
+	}
+	d, ok := usbDeviceForCamera(id)
+	return ok && (c.Serial == "" || c.Serial == d.Serial) && (c.USBPort == "" || c.USBPort == d.Path)
+}
+
+// ref names the entry in errors.
+func (c CameraConfig) ref() string {
+	switch {
+	case c.Serial != "":
+		return fmt.Sprintf("camera with serial %s", c.Serial)
+	case c.USBPort != "":
+		return fmt.Sprintf("camera on USB port %s", c.USBPort)
+	}
+	return fmt.Sprintf("camera %d", c.ID)
+}
+
+// cameraSettings merges the per-camera overrides for id with the global settings.
+func cameraSettings(id int) CameraConfig {
+	s := CameraConfig{ID: id, Width: config.Width, Height: config.Height, FPS: config.FPS, Codec: config.Codec, Encoder: config.Encoder, Audio: config.Audio, RecordSize: config.RecordSize, Lossless: config.Lossless}
+	for _, o := range config.Cameras {
+		if !o.matches(id) {
+			continue
+		}
+		if o.Width > 0 {
+			s.Width = o.Width
+		}
+		if o.Height > 0 {
+			s.Height = o.Height
+		}
+		if o.FPS > 0 {
+			s.FPS = o.FPS
+		}
+		if o.Codec != "" {
+			s.Codec = o.Codec
+		}
+		if o.Encoder != "" {
+			s.Encoder = o.Encoder
+		}
+		if o.Audio != "" {
+			s.Audio = o.Audio
+		}
+		if o.RecordSize != "" {
+			s.RecordSize = o.RecordSize
+		}
+		if o.Lossless != "" {
+			s.Lossless = o.Lossless
+		}
+		s.Color = o.Color
+		s.HWDevice = o.HWDevice
+		s.ONVIF = o.ONVIF
+		s.Backend, s.Pipeline = o.Backend, o.Pipeline
+		s.Lens, s.Pose = o.Lens, o.Pose
+		s.Zones = o.Zones
+		s.ROI, s.ROIBlur = o.ROI, o.ROIBlur
+		s.Rotation, s.Mirror, s.Name = o.Rotation, o.Mirror, cmp.Or(o.Label, o.Name)
+	}
+	if lapseFraction(s.FPS) < 1 {
+		// Sound cannot be sped up with the frames --timelapse keeps.
+		s.Audio = audioDisabled
+	}
+	return s
+}
+
+// loadConfigFile applies the file given by --config. Top-level keys are flag names and only fill in
+// flags that were not given on the command line; the camera-settings list holds per-camera overrides and
+// the layouts list custom view layouts.
+func loadConfigFile(cmd *cli.Command) error {
+	path := cmd.String("config")
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var values map[string]any
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	var file struct {
+		Cameras []CameraConfig `yaml:"camera-settings"`
+		Layouts []CustomLayout `yaml:"layouts"`
+	}
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: camera-settings: %w", path, err)
+	}
+	if err = validateCameraConfigs(file.Cameras); err != nil {
+		return fmt.Errorf("%s: camera-settings: %w", path, err)
+	}
+	config.Cameras = file.Cameras
+	delete(values, "camera-settings")
+	if err = validateLayouts(file.Layouts); err != nil {
+		return fmt.Errorf("%s: layouts: %w", path, err)
+	}
+	config.Layouts = file.Layouts
+	delete(values, "layouts")
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if key == "config" {
+			return fmt.Errorf("%s: config files cannot include other config files", path)
+		}
+		if cmd.IsSet(key) {
+			continue
+		}
+		items, ok := values[key].([]any)
+		if !ok {
+			items = []any{values[key]}
+		}
+		for _, item := range items {
+			if err = cmd.Set(key, fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateCameraConfigs(cameras []CameraConfig) error {
+	seen := map[string]bool{}
+	for _, c := range cameras {
+		if seen[c.ref()] {
+			return fmt.Errorf("%s is listed twice", c.ref())
+		}
+		seen[c.ref()] = true
+		if c.Width < 0 || c.Height < 0 || c.FPS < 0 {
+			return fmt.Errorf("%s: width, height and fps must be positive", c.ref())
+		}
+		if c.Rotation != 0 && c.Rotation != 180 {
+			return fmt.Errorf("%s: rotation must be 0 or 180", c.ref())
+		}
+		if c.Codec != "" && len(c.Codec) != 4 {
+			return fmt.Errorf("%s: codec must be a 4 character fourcc", c.ref())
+		}
+		if c.Encoder != "" {
+			if err := validateEncoder(c.Encoder); err != nil {
+				return fmt.Errorf("%s: %w", c.ref(), err)
+			}
+		}
+		if c.Color != "" {
+			if _, err := parseColor(c.Color); err != nil {
+				return fmt.Errorf("%s: %w", c.ref(), err)
+			}
+		}
+		if err := validateAudio(c.Audio); err != nil {
+			return fmt.Errorf("%s: %w", c.ref(), err)
+		}
+		if err := validateLossless(c.Lossless); err != nil {
+			return fmt.Errorf("%s: %w", c.ref(), err)
+		}
+		if c.ONVIF != "" {
+			if _, err := newONVIFClient(c.ONVIF); err != nil {
+				return fmt.Errorf("%s: %w", c.ref(), err)
+			}
+		}
+		if c.Backend != "" {
+			if err := validateBackend(c.Backend); err != nil {
+				return fmt.Errorf("%s: %w", c.ref(), err)
+			}
+		}
+		if err := c.Lens.validate(); err != nil {
+			return fmt.Errorf("%s: %w", c.ref(), err)
+		}
+		if c.Pipeline != "" && !strings.Contains(c.Pipeline, "appsink") {
+			return fmt.Errorf("%s: pipeline must end in an appsink, e.g. ... ! videoconvert ! appsink", c.ref())
+		}
+		if err := validateZones(c.Zones); err != nil {
+			return fmt.Errorf("%s: %w", c.ref(), err)
+		}
+		if c.RecordSize != "" {
+			if _, _, err := parseSize(c.RecordSize); err != nil {
+				return fmt.Errorf("%s: record-size: %w", c.ref(), err)
+			}
+		}
+		if c.ROI != "" {
+			if _, err := parseROI(c.ROI); err != nil {
+				return fmt.Errorf("%s: %w", c.ref(), err)
+			}
+		}
+		if c.ROIBlur < 0 || (c.ROIBlur > 0 && c.ROIBlur%2 == 0) {
+			return fmt.Errorf("%s: roi-blur must be a positive odd kernel size", c.ref())
+		}
+		if strings.ContainsAny(c.Name+c.Label, `/\`) {
+			return fmt.Errorf("%s: name and label must not contain path separators", c.ref())
+		}
+		// Either one names a directory in a --name-template such as {cam_label}/{index}.
+		if slices.Contains([]string{".", ".."}, c.Name) || slices.Contains([]string{".", ".."}, c.Label) {
+			return fmt.Errorf("%s: name and label must not be . or ..", c.ref())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gocv.io/x/gocv"
+)
+
+const (
+	contactTileWidth = 320
+	contactHeader    = 32
+	contactCaption   = 18
+)
+
+func contactSheetCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "contact-sheet",
+		Usage:     "Save a grid of frames sampled from each recording of a session next to the recording",
+		ArgsUsage: "<session-id>",
+		Flags: []cli.Flag{
+			&cli.DurationFlag{Name: "every", Usage: "Time between sampled frames", Value: time.Minute, Validator: func(d time.Duration) error {
+				if d <= 0 {
+					return errors.New("contact sheet interval must be greater than zero")
+				}
+				return nil
+			}},
+			&cli.IntFlag{Name: "columns", Usage: "Frames per row of the sheet", Value: 6, Validator: func(n int) error {
+				if n < 1 || n > 32 {
+					return errors.New("columns must be between 1 and 32")
+				}
+				return nil
+			}},
+		},
+		Action: func(_ context.Context, cmd *cli.Command) error {
+			if err := setup(cmd); err != nil {
+				return err
+			}
+			if cmd.Args().Len() != 1 {
+				return errors.New("contact-sheet takes the session ID, e.g. contact-sheet 1714557600")
+			}
+			return contactSheets(cmd.Args().First(), cmd.Duration("every"), cmd.Int("columns"))
+		},
+	}
+}
+
+// contactSheets writes <recording>_contact.jpg for every recording of a session.
+func contactSheets(sessionID string, every time.Duration, columns int) error {
+	m, err := readManifest(config.OutputDir, sessionID)
+	if err != nil {
+		return fmt.Errorf("could not open session %s: %w", sessionID, err)
+	}
+	// Frames are captioned with the time they were captured if the manifest has it, else their position.
+	starts := map[string]time.Time{}
+	if m.Offsets != nil {
+		for _, f := range m.Offsets.Files {
+			starts[f.File] = f.FirstFrame
+		}
+	}
+
+	written := 0
+	for _, cam := range m.Cameras {
+		label := cmp.Or(cam.Label, fmt.Sprintf("Cam %d", cam.ID))
+		for _, file := range cam.Files {
+			path := m.absPath(file)
+			out := strings.TrimSuffix(path, filepath.Ext(path)) + "_contact.jpg"
+			if err := writeContactSheet(path, out, label+" | "+file, starts[file], every, columns); err != nil {
+				logger.Warn(fmt.Sprintf("Cam %d: no contact sheet for %s: %v.", cam.ID, file, err))
+				continue
+			}
+			logger.Info(fmt.Sprintf("Saved contact sheet: %s.", out))
+			written++
+		}
+	}
+	if written == 0 {
+		return errors.New("no contact sheet written")
+	}
+	return nil
+}
+
+// writeContactSheet samples a frame of the recording every interval and saves them as a captioned grid.
+func writeContactSheet(path, out, title string, start time.Time, every time.Duration, columns int) error {
+	video, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		return err
+	}
+	defer video.Close()
+	fps := video.Get(gocv.VideoCaptureFPS)
+	if fps <= 0 {
+		return errors.New("unknown frame rate")
+	}
+	step := max(1, int(math.Round(every.Seconds()*fps)))
+
+	frame := gocv.NewMat()
+	defer frame.Close()
+	var tiles []gocv.Mat
+	defer func() {
+		for _, t := range tiles {
+			_ = t.Close()
+		}
+	}()
+	var size image.Point
+	for n := 0; video.Read(&frame) && !frame.Empty(); n += step {
+		if size.X == 0 {
+			size = image.Pt(contactTileWidth, max(1, frame.Rows()*contactTileWidth/max(1, frame.Cols())))
+		}
+		tile := gocv.NewMat()
+		_ = gocv.Resize(frame, &tile, size, 0, 0, gocv.InterpolationArea)
+		at := time.Duration(float64(n) / fps * float64(time.Second))
+		caption := fmt.Sprintf("%02d:%02d:%02d", int(at.Hours()), int(at.Minutes())%60, int(at.Seconds())%60)
+		if !start.IsZero() {
+			caption = start.Add(at).Format("2006-01-02 15:04:05")
+		}
+		_ = gocv.Rectangle(&tile, image.Rect(0, size.Y-contactCaption, size.X, size.Y), color.RGBA{}, -1)
+		_ = gocv.PutText(&tile, caption, image.Pt(4, size.Y-4), gocv.FontHersheyPlain, 1, color.RGBA{R: 255, G: 255, B: 255}, 1)
+		tiles = append(tiles, tile)
+		if step > 1 && video.Grab(step-1) != nil {
+			break
+		}
+	}
+	if len(tiles) == 0 {
+		return errors.New("no frames")
+	}
+
+	cols := min(columns, len(tiles))
+	rows := (len(tiles) + cols - 1) / cols
+	sheet := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(24, 24, 24, 0), contactHeader+rows*size.Y, cols*size.X, gocv.MatTypeCV8UC3)
+	defer sheet.Close()
+	_ = gocv.PutText(&sheet, title, image.Pt(8, contactHeader-10), gocv.FontHersheyPlain, 1.3, color.RGBA{R: 255, G: 255, B: 255}, 1)
+	for i, t := range tiles {
+		at := image.Pt(i%cols*size.X, contactHeader+i/cols*size.Y)
+		region := sheet.Region(image.Rectangle{Min: at, Max: at.Add(size)})
+		_ = t.CopyTo(&region)
+		_ = region.Close()
+	}
+	if !gocv.IMWrite(out, sheet) {
+		return errors.New("could not write " + out)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cmdStop     = "stop"
+	cmdSnapshot = "snapshot"
+	cmdMarker   = "marker"
+	cmdEvent    = "event"
+
+	cmdRecordStart  = "record-start"
+	cmdRecordStop   = "record-stop"
+	cmdRecordPause  = "record-pause"
+	cmdRecordResume = "record-resume"
+
+	cmdPrivacy    = "privacy"
+	cmdPrivacyOff = "privacy-off"
+)
+
+type Command struct {
+	Name   string
+	CamID  int
+	Arg    string
+	Source string
+}
+
+var commandCh = make(chan Command, 64)
+
+func sendCommand(c Command) {
+	select {
+	case commandCh <- c:
+	default:
+		logger.Error(fmt.Sprintf("Command queue full, dropped %q from %s.", c.Name, c.Source))
+	}
+}
+
+// parseCommand understands "stop", "privacy", "privacy-off", "marker[:note]" and "snapshot", "event", "record-start",
+// "record-stop", "record-pause", "record-resume" with an optional "-camN" suffix; for markers without an inline note the body
+// is used instead.
+func parseCommand(name, body string) (Command, error) {
+	c := Command{CamID: allCameras}
+	verb, arg, hasArg := strings.Cut(name, ":")
+	switch {
+	case verb == cmdMarker:
+		c.Name = cmdMarker
+		c.Arg = strings.TrimSpace(body)
+		if hasArg {
+			c.Arg = strings.TrimSpace(arg)
+		}
+		return c, nil
+	case hasArg:
+		return c, fmt.Errorf("unexpected argument for %q", verb)
+	}
+
+	verb, cam, hasCam := strings.Cut(verb, "-cam")
+	if hasCam {
+		id, err := strconv.Atoi(cam)
+		if err != nil {
+			return c, fmt.Errorf("invalid camera in %q", name)
+		}
+		c.CamID = id
+	}
+	switch verb {
+	case cmdStop, cmdPrivacy, cmdPrivacyOff:
+		if hasCam {
+			return c, fmt.Errorf("%q does not take a camera", verb)
+		}
+	case cmdSnapshot, cmdEvent, cmdRecordStart, cmdRecordStop, cmdRecordPause, cmdRecordResume:
+	default:
+		return c, fmt.Errorf("unknown command %q", name)
+	}
+	c.Name = verb
+	return c, nil
+}
+
+// watchControlDir polls dir for command files, runs them and deletes them. Files whose
+// name starts with a dot are ignored so writers can create them and rename atomically.
+func watchControlDir(ctx context.Context, dir string) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		logger.Error(fmt.Sprintf("Failed to create control directory: %v.", err))
+		return
+	}
+	logger.Info(fmt.Sprintf("Watching %s for control files.", dir))
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to read control directory: %v.", err))
+			continue
+		}
+		for _, e := range entries {
+			if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			body, err := readControlFile(path)
+			if rmErr := os.Remove(path); rmErr != nil {
+				logger.Error(fmt.Sprintf("Failed to remove control file %s: %v.", path, rmErr))
+			}
+			if err != nil {
+				logger.Error(fmt.Sprintf("Failed to read control file %s: %v.", path, err))
+				continue
+			}
+
+			c, err := parseCommand(e.Name(), body)
+			if err != nil {
+				logger.Error(fmt.Sprintf("Ignored control file %s: %v.", e.Name(), err))
+				continue
+			}
+			c.Source = "control-file"
+			sendCommand(c)
+		}
+	}
+}
+
+func readControlFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	body, err := io.ReadAll(io.LimitReader(f, 64*1024))
+	return string(body), err
+}
+
+// runCommands executes queued commands on the capture loop and reports whether recording should stop.
+func runCommands(cameras []*Camera, manifest *Manifest) bool {
+	stop := false
+	for {
+		select {
+		case c := <-commandCh:
+			logger.Info(fmt.Sprintf("Command %q for cam %d from %s.", c.Name, c.CamID, c.Source))
+			switch c.Name {
+			case cmdStop:
+				stop = true
+			case cmdSnapshot:
+				takeSnapshots(cameras, c.CamID)
+			case cmdEvent:
+				fireEvent(Event{CamID: c.CamID, Source: c.Source, Note: c.Arg})
+			case cmdMarker:
+				manifest.AddMarker(Marker{Time: time.Now(), CamID: c.CamID, Source: c.Source, Note: c.Arg})
+			case cmdRecordStart, cmdRecordStop:
+				for _, cam := range cameras {
+					if c.CamID != allCameras && cam.ID != c.CamID {
+						continue
+					}
+					if c.Name == cmdRecordStart {
+						cam.do(func() { cam.startRecording(manifest) })
+					} else {
+						cam.do(cam.stopRecording)
+					}
+				}
+			case cmdPrivacy, cmdPrivacyOff:
+				setPrivacy(cameras, c.Name == cmdPrivacy, c.Source, manifest)
+			case cmdRecordPause, cmdRecordResume:
+				setPaused(cameras, c.CamID, c.Name == cmdRecordPause, c.Source, manifest)
+			}
+		default:
+			return stop
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// startAt is when recording begins, in Unix nanoseconds, i.e. the session start plus --start-delay.
+var startAt atomic.Int64
+
+// armed reports whether the --start-delay countdown is over.
+func armed() bool {
+	return time.Now().UnixNano() >= startAt.Load()
+}
+
+// runCountdown starts recording on every continuously recording camera once the start delay has elapsed.
+func runCountdown(ctx context.Context, cameras []*Camera, manifest *Manifest) {
+	logger.Info(fmt.Sprintf("Recording starts in %v.", config.StartDelay))
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Until(time.Unix(0, startAt.Load()))):
+	}
+	for _, cam := range cameras {
+		if cam.Motion == nil {
+			cam.do(func() { cam.startRecording(manifest) })
+		}
+	}
+	logger.Info("Countdown finished, recording started.")
+}
+
+// drawCountdown shows the seconds left before recording starts in the middle of the preview.
+func drawCountdown(img *gocv.Mat) {
+	left := math.Ceil(time.Until(time.Unix(0, startAt.Load())).Seconds())
+	text := fmt.Sprintf("Recording in %.0fs", left)
+	scale := max(1, float64(img.Cols())/640) * 1.5
+	size := gocv.GetTextSize(text, gocv.FontHersheySimplex, scale, 3)
+	pt := image.Pt(max(0, (img.Cols()-size.X)/2), (img.Rows()+size.Y)/2)
+	if err := gocv.PutText(img, text, pt, gocv.FontHersheySimplex, scale, color.RGBA{R: 255, G: 200}, 3); err != nil {
+		logger.Error(fmt.Sprintf("Error drawing countdown: %v.", err))
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	decodeAuto = "auto"
+	decodeOn   = "on"
+	decodeOff  = "off"
+
+	// mjpegOffloadMin is how many MJPG cameras --decode-offload auto needs before it offloads.
+	mjpegOffloadMin = 4
+)
+
+func validateDecodeOffload(s string) error {
+	switch s {
+	case decodeAuto, decodeOn, decodeOff:
+		return nil
+	}
+	return errors.New("decode offload must be auto, on or off")
+}
+
+type decodeJob struct {
+	raw  gocv.Mat
+	dst  *gocv.Mat
+	done chan error
+}
+
+// DecodePool decodes the compressed frames of MJPG cameras on a fixed number of workers, so many
+// cameras don't each decode inside their reads and contend for the CPU.
+type DecodePool struct {
+	jobs chan decodeJob
+}
+
+var (
+	decoders     *DecodePool
+	decodersOnce sync.Once
+)
+
+// decodePool starts the --decode-workers workers the first time it is called.
+func decodePool() *DecodePool {
+	decodersOnce.Do(func() {
+		workers := config.DecodeWorkers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		decoders = &DecodePool{jobs: make(chan decodeJob)}
+		for range workers {
+			go decoders.work()
+		}
+		logger.Info(fmt.Sprintf("Decoding MJPG frames on %d worker(s).", workers))
+	})
+	return decoders
+}
+
+func (p *DecodePool) work() {
+	for job := range p.jobs {
+		buf, err := job.raw.DataPtrUint8()
+		if err == nil {
+			err = gocv.IMDecodeIntoMat(buf, gocv.IMReadColor, job.dst)
+		}
+		job.done <- err
+	}
+}
+
+// Decode decodes the JPEG in raw into dst on a worker and waits for it; raw must stay untouched until then.
+func (p *DecodePool) Decode(raw gocv.Mat, dst *gocv.Mat) error {
+	done := make(chan error, 1)
+	p.jobs <- decodeJob{raw: raw, dst: dst, done: done}
+	return <-done
+}
+
+// offloadDecoding switches the MJPG cameras to delivering their JPEGs undecoded for the decode workers,
+// with --decode-offload on or, by default, once there are mjpegOffloadMin of them.
+func offloadDecoding(cameras []*Camera) {
+	if config.DecodeOffload == decodeOff {
+		return
+	}
+	var mjpeg []*Camera
+	for _, cam := range cameras {
+		if cam.Source == "" && cam.Pipeline == "" && cam.Capture.CodecString() == "MJPG" {
+			mjpeg = append(mjpeg, cam)
+		}
+	}
+	if len(mjpeg) == 0 || config.DecodeOffload == decodeAuto && len(mjpeg) < mjpegOffloadMin {
+		return
+	}
+	for _, cam := range mjpeg {
+		if !rawCapture(cam.Capture) {
+			logger.Info(fmt.Sprintf("Cam %d cannot deliver undecoded MJPG, it keeps decoding in its reads.", cam.ID))
+			continue
+		}
+		cam.rawMJPEG = true
+		cam.raw = gocv.NewMat()
+	}
+}
+
+// rawCapture asks capture for its frames undecoded and reports whether the backend agreed.
+func rawCapture(capture *gocv.VideoCapture) bool {
+	capture.Set(gocv.VideoCaptureConvertRGB, 0)
+	return capture.Get(gocv.VideoCaptureConvertRGB) == 0
+}
+
+// read reads the next frame into c.Frame, handing undecoded MJPG to the decode workers.
+func (c *Camera) read() bool {
+	if !c.rawMJPEG {
+		return c.Capture.Read(&c.Frame)
+	}
+	if !c.Capture.Read(&c.raw) || c.raw.Empty() {
+		return false
+	}
+	if c.raw.Rows() > 1 {
+		// The backend decoded it after all.
+		return c.raw.CopyTo(&c.Frame) == nil
+	}
+	if err := decodePool().Decode(c.raw, &c.Frame); err != nil {
+		logger.Error(fmt.Sprintf("Failed to decode frame of cam %d: %v.", c.ID, err))
+		return false
+	}
+	return true
+}
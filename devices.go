@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// parseCameraList parses camera indexes and V4L2 device paths such as /dev/video2 or
+// /dev/v4l/by-id/... symlinks into capture indexes, keeping the given order.
+func parseCameraList(s string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		id, err := strconv.Atoi(part)
+		if err != nil {
+			id, err = deviceIndex(part)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(ids, id) {
+			return nil, fmt.Errorf("camera %q is listed twice", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func deviceIndex(path string) (int, error) {
+	if !strings.HasPrefix(path, "/dev/") {
+		return 0, fmt.Errorf("invalid camera %q, expected an index or a /dev/videoN path", path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := strings.CutPrefix(filepath.Base(resolved), "video")
+	id, err := strconv.Atoi(n)
+	if !ok || err != nil {
+		return 0, fmt.Errorf("%s is not a video device", path)
+	}
+	return id, nil
+}
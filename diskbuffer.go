@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	// diskChunkDuration is how much pre-roll each buffer file holds; whole files are dropped as they age out.
+	diskChunkDuration = time.Second
+	diskBufferQuality = 90
+)
+
+type diskChunk struct {
+	path  string
+	start time.Time
+	end   time.Time
+}
+
+// DiskBuffer keeps a camera's pre-roll on disk as JPEG frames, for pre-rolls too long to hold in memory.
+// With --buffer-encrypt each frame is sealed with AES-GCM under a key that only lives in memory, so the
+// buffer cannot be read once the process has exited.
+type DiskBuffer struct {
+	dir    string
+	aead   cipher.AEAD
+	chunks []diskChunk
+
+	file *os.File
+	w    *bufio.Writer
+}
+
+// newDiskBuffer starts an empty buffer in dir, discarding anything left there by an earlier run.
+func newDiskBuffer(dir string) (*DiskBuffer, error) {
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	b := &DiskBuffer{dir: dir}
+	if config.BufferEncrypt {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		if b.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Push appends a frame and drops the files that lie entirely before preRoll.
+func (b *DiskBuffer) Push(mat gocv.Mat, at time.Time, preRoll time.Duration) error {
+	if b.file == nil || at.Sub(b.chunks[len(b.chunks)-1].start) >= diskChunkDuration {
+		if err := b.rotate(at); err != nil {
+			return err
+		}
+	}
+	buf, err := gocv.IMEncodeWithParams(gocv.JPEGFileExt, mat, []int{gocv.IMWriteJpegQuality, diskBufferQuality})
+	if err != nil {
+		return err
+	}
+	data := buf.GetBytes()
+	if b.aead != nil {
+		nonce := make([]byte, b.aead.NonceSize())
+		if _, err = rand.Read(nonce); err != nil {
+			buf.Close()
+			return err
+		}
+		data = b.aead.Seal(nonce, nonce, data, nil)
+	}
+	var header [12]byte
+	binary.LittleEndian.PutUint64(header[:8], uint64(at.UnixNano()))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(data)))
+	if _, err = b.w.Write(header[:]); err == nil {
+		_, err = b.w.Write(data)
+	}
+	buf.Close()
+	if err != nil {
+		return err
+	}
+	b.chunks[len(b.chunks)-1].end = at
+
+	for len(b.chunks) > 1 && at.Sub(b.chunks[0].end) > preRoll {
+		_ = os.Remove(b.chunks[0].path)
+		b.chunks = b.chunks[1:]
+	}
+	return nil
+}
+
+func (b *DiskBuffer) rotate(at time.Time) error {
+	if err := b.closeFile(); err != nil {
+		return err
+	}
+	path := filepath.Join(b.dir, fmt.Sprintf("%d.buf", at.UnixNano()))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	b.file, b.w = f, bufio.NewWriter(f)
+	b.chunks = append(b.chunks, diskChunk{path: path, start: at, end: at})
+	return nil
+}
+
+func (b *DiskBuffer) closeFile() error {
+	if b.file == nil {
+		return nil
+	}
+	err := b.w.Flush()
+	if cErr := b.file.Close(); err == nil {
+		err = cErr
+	}
+	b.file, b.w = nil, nil
+	return err
+}
+
+// Replay hands fn the buffered frames from within preRoll of now, oldest first, and empties the buffer.
+func (b *DiskBuffer) Replay(now time.Time, preRoll time.Duration, fn func(mat gocv.Mat, at time.Time)) error {
+	err := b.closeFile()
+	from := now.Add(-preRoll)
+	for _, c := range b.chunks {
+		if err == nil && !c.end.Before(from) {
+			err = b.replayChunk(c.path, from, fn)
+		}
+		_ = os.Remove(c.path)
+	}
+	b.chunks = nil
+	return err
+}
+
+func (b *DiskBuffer) replayChunk(path string, from time.Time, fn func(mat gocv.Mat, at time.Time)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var header [12]byte
+	for {
+		if _, err = io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		at := time.Unix(0, int64(binary.LittleEndian.Uint64(header[:8])))
+		data := make([]byte, binary.LittleEndian.Uint32(header[8:]))
+		if _, err = io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if at.Before(from) {
+			continue
+		}
+		if b.aead != nil {
+			n := b.aead.NonceSize()
+			if len(data) < n {
+				return errors.New("truncated frame in pre-roll buffer")
+			}
+			if data, err = b.aead.Open(nil, data[:n], data[n:], nil); err != nil {
+				return err
+			}
+		}
+		mat, err := gocv.IMDecode(data, gocv.IMReadColor)
+		if err != nil {
+			return err
+		}
+		fn(mat, at)
+		_ = mat.Close()
+	}
+}
+
+// Close removes the buffer from disk.
+func (b *DiskBuffer) Close() {
+	_ = b.closeFile()
+	_ = os.RemoveAll(b.dir)
+}
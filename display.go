@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	slowDisplayAuto = "auto"
+	slowDisplayOn   = "on"
+	slowDisplayOff  = "off"
+
+	// slowDisplayAfter is how long the viewer loop must overrun its frame interval before auto switches
+	// to the slow display mode.
+	slowDisplayAfter = 3 * time.Second
+)
+
+var slowDisplayModes = []string{slowDisplayAuto, slowDisplayOn, slowDisplayOff}
+
+func validateSlowDisplay(s string) error {
+	if !slices.Contains(slowDisplayModes, s) {
+		return fmt.Errorf("slow display must be one of %s", strings.Join(slowDisplayModes, ", "))
+	}
+	return nil
+}
+
+// remoteDisplay reports whether the window goes to another host, e.g. X11 forwarded over SSH.
+func remoteDisplay() bool {
+	host, _, ok := strings.Cut(os.Getenv("DISPLAY"), ":")
+	return ok && host != "" && !strings.HasPrefix(host, "/")
+}
+
+// DisplayThrottle shows the preview less often and smaller on a slow display, such as VNC or
+// forwarded X11, where showing every frame at full size holds up the viewer loop.
+type DisplayThrottle struct {
+	slow     bool
+	lastShow time.Time
+	overrun  time.Time
+}
+
+func newDisplayThrottle() *DisplayThrottle {
+	d := &DisplayThrottle{slow: config.SlowDisplay == slowDisplayOn}
+	if config.SlowDisplay == slowDisplayAuto && remoteDisplay() {
+		d.enable(fmt.Sprintf("DISPLAY %s is remote", os.Getenv("DISPLAY")))
+	}
+	return d
+}
+
+func (d *DisplayThrottle) enable(reason string) {
+	d.slow = true
+	logger.Info(fmt.Sprintf("Slow display (%s): preview at %.0f fps and %.0f%% size.", reason, config.SlowDisplayFPS, config.SlowDisplayScale*100))
+}
+
+// Due reports whether the preview should be composed and shown in the iteration starting at now.
+func (d *DisplayThrottle) Due(now time.Time) bool {
+	if !d.slow {
+		return true
+	}
+	if now.Sub(d.lastShow) < time.Duration(float64(time.Second)/config.SlowDisplayFPS) {
+		return false
+	}
+	d.lastShow = now
+	return true
+}
+
+// Observe feeds the length of a viewer loop iteration; with auto a loop that keeps overrunning its
+// interval switches to the slow mode.
+func (d *DisplayThrottle) Observe(now time.Time, elapsed, interval time.Duration) {
+	if d.slow || config.SlowDisplay != slowDisplayAuto {
+		return
+	}
+	if elapsed <= interval*3/2 {
+		d.overrun = time.Time{}
+		return
+	}
+	if d.overrun.IsZero() {
+		d.overrun = now
+	} else if now.Sub(d.overrun) >= slowDisplayAfter {
+		d.enable("the viewer cannot keep up")
+	}
+}
+
+// Fit returns the preview to show, scaled down in the slow mode; the caller closes it if scaled.
+func (d *DisplayThrottle) Fit(mat gocv.Mat) (shown gocv.Mat, scaled bool) {
+	if !d.slow || config.SlowDisplayScale >= 1 || mat.Empty() {
+		return mat, false
+	}
+	small := gocv.NewMat()
+	size := image.Pt(max(1, int(float64(mat.Cols())*config.SlowDisplayScale)), max(1, int(float64(mat.Rows())*config.SlowDisplayScale)))
+	if err := gocv.Resize(mat, &small, size, 0, 0, gocv.InterpolationArea); err != nil {
+		logger.Error(fmt.Sprintf("Failed to scale preview: %v.", err))
+		_ = small.Close()
+		return mat, false
+	}
+	return small, true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const encoderSoftware = "software"
+
+// encoderAcceleration maps --encoder names to OpenCV's VideoAccelerationType.
+var encoderAcceleration = map[string]int{
+	encoderSoftware: 0,
+	"hardware":      1,
+	"d3d11":         2,
+	"vaapi":         3,
+	"mfx":           4,
+}
+
+func encoderNames() []string {
+	names := make([]string, 0, len(encoderAcceleration))
+	for name := range encoderAcceleration {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func validateEncoder(name string) error {
+	if _, ok := encoderAcceleration[name]; !ok {
+		return fmt.Errorf("unknown encoder %q, expected one of %s", name, strings.Join(encoderNames(), ", "))
+	}
+	return nil
+}
+
+// openVideoWriter opens a writer with the requested encoder. Hardware encoder sessions are a limited
+// resource, so if one cannot be opened the camera falls back to software encoding.
+func openVideoWriter(filename, codec, encoder string, hwDevice int, fps float64, width, height int) (*gocv.VideoWriter, error) {
+	if accel := encoderAcceleration[encoder]; accel != 0 {
+		writer, err := gocv.VideoWriterFileWithAPIParams(filename, gocv.VideoCaptureFFmpeg, codec, fps, width, height, []gocv.VideoWriterProperty{
+			gocv.VideoWriterHwAcceleration, gocv.VideoWriterProperty(accel),
+			gocv.VideoWriterHwDevice, gocv.VideoWriterProperty(hwDevice),
+		})
+		if err == nil && writer.IsOpened() {
+			return writer, nil
+		}
+		if writer != nil {
+			_ = writer.Close()
+		}
+		logger.Warn(fmt.Sprintf("No %s encoder session available for %s (%v), falling back to software encoding.", encoder, filename, err))
+	}
+
+	writer, err := gocv.VideoWriterFile(filename, codec, fps, width, height, true)
+	if err != nil {
+		return nil, err
+	}
+	if !writer.IsOpened() {
+		_ = writer.Close()
+		return nil, fmt.Errorf("%s could not be opened", filename)
+	}
+	return writer, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// codecBytesPerPixel approximates the encoded size of one frame per pixel at the default quality of each codec.
+var codecBytesPerPixel = map[string]float64{
+	"MJPG": 0.2,
+	"mp4v": 0.05,
+	"XVID": 0.05,
+	"avc1": 0.02,
+	"H264": 0.02,
+	"X264": 0.02,
+	"hvc1": 0.012,
+	"HEVC": 0.012,
+	"VP80": 0.03,
+	"VP90": 0.015,
+	"FFV1": 0.8,
+}
+
+// losslessBytesPerPixel approximates the size of one frame per pixel of each --lossless format.
+var losslessBytesPerPixel = map[string]float64{
+	losslessFFV1:    codecBytesPerPixel["FFV1"],
+	losslessHuffYUV: 1.6,
+	losslessPNG:     1.5,
+}
+
+const defaultBytesPerPixel = 0.05
+
+var errInsufficientStorage = errors.New("the session does not fit into the free space of the output directory")
+
+// bitrateBytes converts a --bitrate value such as 4M into bytes per second.
+func bitrateBytes(s string) float64 {
+	mult := 1.0
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		mult, s = 1e3, s[:len(s)-1]
+	case "m":
+		mult, s = 1e6, s[:len(s)-1]
+	case "g":
+		mult, s = 1e9, s[:len(s)-1]
+	}
+	v, _ := strconv.ParseFloat(s, 64)
+	return v * mult / 8
+}
+
+// estimateBytesPerHour estimates the recorded size of one camera per hour.
+func estimateBytesPerHour(s CameraConfig) float64 {
+	if bpp, ok := losslessBytesPerPixel[s.Lossless]; ok {
+		return s.Width * s.Height * bpp * s.FPS * 3600
+	}
+	if ic, ok := intermediateCodecs[config.Intermediate]; ok {
+		return s.Width * s.Height * ic.bytesPerPixel * s.FPS * 3600
+	}
+	if config.Bitrate != "" && (config.Writer == writerFFmpeg || (s.Audio != "" && s.Audio != audioDisabled)) {
+		return bitrateBytes(config.Bitrate) * 3600
+	}
+	bpp, ok := codecBytesPerPixel[s.Codec]
+	if !ok {
+		bpp = defaultBytesPerPixel
+	}
+	return s.Width * s.Height * bpp * s.FPS * 3600
+}
+
+// checkStorageEstimate reports the expected data rate against the free space of the output directory. If a
+// --duration session will not fit it asks for confirmation on a terminal, or fails with --strict.
+func checkStorageEstimate(settings []CameraConfig) error {
+	var perHour float64
+	for _, s := range settings {
+		perHour += estimateBytesPerHour(s) * lapseFraction(s.FPS)
+	}
+	if perHour == 0 {
+		return nil
+	}
+	free, err := freeSpace(config.OutputDir)
+	if err != nil {
+		logger.Info(fmt.Sprintf("Estimated %.1f GB/hour for %d camera(s).", perHour/1e9, len(settings)))
+		return nil
+	}
+	logger.Info(fmt.Sprintf("Estimated %.1f GB/hour for %d camera(s), %.1f GB free in %s (about %v).",
+		perHour/1e9, len(settings), float64(free)/1e9, config.OutputDir, time.Duration(float64(free)/perHour*float64(time.Hour)).Round(time.Minute)))
+	if config.Duration <= 0 {
+		return nil
+	}
+	needed := perHour * config.Duration.Hours()
+	if needed <= float64(free) {
+		return nil
+	}
+	logger.Warn(fmt.Sprintf("A %v session needs about %.1f GB but only %.1f GB are free.", config.Duration, needed/1e9, float64(free)/1e9))
+	if config.Strict {
+		return errInsufficientStorage
+	}
+	if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	fmt.Fprint(os.Stderr, "Record anyway? [y/N] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return errInsufficientStorage
+	}
+	return nil
+}
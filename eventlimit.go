@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errEventRateLimit = errors.New("event rate limit must be a count per duration, e.g. 10/1h")
+
+func parseEventRateLimit(s string) (int, time.Duration, error) {
+	count, per, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 1 {
+		return 0, 0, errEventRateLimit
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return 0, 0, errEventRateLimit
+	}
+	return n, d, nil
+}
+
+func validateEventRateLimit(s string) error {
+	_, _, err := parseEventRateLimit(s)
+	return err
+}
+
+type eventKey struct {
+	camID  int
+	source string
+}
+
+type eventHistory struct {
+	last   time.Time
+	recent []time.Time
+	merged int
+}
+
+// EventLimiter merges bursts of events from the same camera and source within --event-cooldown into
+// one and caps them at --event-rate-limit, so a windy day does not raise thousands of clips and alerts.
+type EventLimiter struct {
+	mu      sync.Mutex
+	history map[eventKey]*eventHistory
+}
+
+var eventLimiter = &EventLimiter{history: map[eventKey]*eventHistory{}}
+
+// Allow reports whether an event from source for camID at may go ahead and, if so, how many events
+// were held back since the last one that did.
+func (l *EventLimiter) Allow(camID int, source string, at time.Time) (merged int, ok bool) {
+	limit, per, _ := parseEventRateLimit(config.EventRateLimit)
+	if config.EventCooldown <= 0 && limit == 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := eventKey{camID: camID, source: source}
+	h := l.history[key]
+	if h == nil {
+		h = &eventHistory{}
+		l.history[key] = h
+	}
+	if !h.last.IsZero() && at.Sub(h.last) < config.EventCooldown {
+		h.merged++
+		return 0, false
+	}
+	if limit > 0 {
+		keep := h.recent[:0]
+		for _, t := range h.recent {
+			if at.Sub(t) < per {
+				keep = append(keep, t)
+			}
+		}
+		h.recent = keep
+		if len(h.recent) >= limit {
+			if h.merged == 0 {
+				logger.Warn(fmt.Sprintf("Cam %d %s events exceed %s, holding them back.", camID, source, config.EventRateLimit))
+			}
+			h.merged++
+			return 0, false
+		}
+		h.recent = append(h.recent, at)
+	}
+	h.last = at
+	merged, h.merged = h.merged, 0
+	return merged, true
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const allCameras = -1
+
+type Event struct {
+	Time   time.Time `json:"time"`
+	CamID  int       `json:"camera"`
+	Source string    `json:"source"`
+	Note   string    `json:"note,omitempty"`
+	// Merged is how many events --event-cooldown and --event-rate-limit held back since the last one.
+	Merged int `json:"merged,omitempty"`
+}
+
+var eventCh = make(chan Event, 64)
+
+func fireEvent(ev Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	merged, ok := eventLimiter.Allow(ev.CamID, ev.Source, ev.Time)
+	if !ok {
+		return
+	}
+	ev.Merged = merged
+	queueEvent(ev)
+}
+
+// queueEvent hands ev to the dispatcher without rate limiting it again.
+func queueEvent(ev Event) {
+	select {
+	case eventCh <- ev:
+	default:
+		logger.Error(fmt.Sprintf("Event queue full, dropped %s event for cam %d.", ev.Source, ev.CamID))
+	}
+}
+
+func dispatchEvents(cameras []*Camera) {
+	for {
+		select {
+		case ev := <-eventCh:
+			logger.Info(fmt.Sprintf("Event from %s for cam %d: %s.", ev.Source, ev.CamID, ev.Note))
+			for _, cam := range cameras {
+				if cam.Clips != nil && (ev.CamID == allCameras || ev.CamID == cam.ID) {
+					cam.do(func() { cam.Clips.Trigger(ev) })
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+type bufferedFrame struct {
+	mat gocv.Mat
+	at  time.Time
+}
+
+type ClipMeta struct {
+	Event       Event     `json:"event"`
+	File        string    `json:"file"`
+	StartedAt   time.Time `json:"started_at"`
+	EndedAt     time.Time `json:"ended_at"`
+	Frames      int       `json:"frames"`
+	PreRollSec  float64   `json:"pre_roll_sec"`
+	PostRollSec float64   `json:"post_roll_sec"`
+}
+
+// ClipRecorder keeps a rolling pre-roll buffer for one camera and cuts standalone
+// clips into the events directory when an event fires.
+type ClipRecorder struct {
+	camID    int
+	codec    string
+	fps      float64
+	width    int
+	height   int
+	preRoll  time.Duration
+	postRoll time.Duration
+
+	// name makes this a motion recorder writing the files it names, relative to the output directory.
+	name   func(at time.Time) string
+	onOpen func(filename string)
+	// open opens the writer of a clip in place of newFrameWriter with the recorder's codec.
+	open func(filename string) (FrameWriter, error)
+	// lossless is the --lossless format of the clips, which get a frame index.
+	lossless string
+	index    *FrameIndex
+
+	buffer []bufferedFrame
+	frames *FramePool
+	disk   *DiskBuffer
+	dir    string
+	writer FrameWriter
+	until  time.Time
+	meta   ClipMeta
+}
+
+func newClipRecorder(camID int, codec string, fps float64, width, height int) *ClipRecorder {
+	return &ClipRecorder{
+		camID:    camID,
+		codec:    codec,
+		fps:      fps,
+		width:    width,
+		height:   height,
+		preRoll:  config.EventPreRoll,
+		postRoll: config.EventPostRoll,
+		frames:   newFramePool(framePoolSize),
+	}
+}
+
+func (r *ClipRecorder) Push(mat gocv.Mat, at time.Time) {
+	if r.writer != nil {
+		r.write(mat, at)
+		if at.After(r.until) {
+			r.finish()
+		}
+		return
+	}
+
+	if r.disk != nil {
+		if err := r.disk.Push(mat, at, r.preRoll); err != nil {
+			logger.Error(fmt.Sprintf("Failed to buffer pre-roll for cam %d: %v.", r.camID, err))
+		}
+		return
+	}
+	r.buffer = append(r.buffer, bufferedFrame{mat: r.frames.Copy(mat), at: at})
+	drop := 0
+	for drop < len(r.buffer) && at.Sub(r.buffer[drop].at) > r.preRoll {
+		r.frames.Release(r.buffer[drop].mat)
+		drop++
+	}
+	r.buffer = r.buffer[drop:]
+}
+
+func (r *ClipRecorder) Trigger(ev Event) {
+	if r.writer != nil {
+		r.until = ev.Time.Add(r.postRoll)
+		logger.Info(fmt.Sprintf("Cam %d event clip extended until %s.", r.camID, r.until.Format(time.TimeOnly)))
+		return
+	}
+
+	filename := filepath.Join(activeOutputDir(), "events", fmt.Sprintf("event_%d_cam%d.%s", ev.Time.Unix(), r.camID, config.Container))
+	if r.name != nil {
+		filename = uniquePath(filepath.Join(activeOutputDir(), r.name(ev.Time)))
+	}
+	dir := filepath.Dir(filename)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		logger.Error(fmt.Sprintf("Failed to create directory for cam %d clips: %v.", r.camID, err))
+		return
+	}
+	var writer FrameWriter
+	var err error
+	if r.open != nil {
+		writer, err = r.open(filename)
+	} else {
+		writer, err = newFrameWriter(filename, r.codec, r.fps, r.width, r.height)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to open event clip for cam %d: %v.", r.camID, err))
+		return
+	}
+	if r.lossless != "" {
+		if r.index, err = newFrameIndex(filename, r.lossless, sessionStart); err != nil {
+			logger.Error(fmt.Sprintf("Failed to create frame index for cam %d: %v.", r.camID, err))
+		}
+	}
+
+	r.writer = writer
+	r.dir = dir
+	if r.onOpen != nil {
+		r.onOpen(filename)
+	}
+	r.until = ev.Time.Add(r.postRoll)
+	r.meta = ClipMeta{
+		Event:       ev,
+		File:        filepath.Base(filename),
+		StartedAt:   ev.Time,
+		PreRollSec:  r.preRoll.Seconds(),
+		PostRollSec: r.postRoll.Seconds(),
+	}
+	if len(r.buffer) > 0 {
+		r.meta.StartedAt = r.buffer[0].at
+	}
+	if r.disk != nil {
+		first := true
+		err := r.disk.Replay(ev.Time, r.preRoll, func(mat gocv.Mat, at time.Time) {
+			if first {
+				r.meta.StartedAt, first = at, false
+			}
+			r.write(mat, at)
+		})
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to read pre-roll for cam %d: %v.", r.camID, err))
+		}
+	}
+	for _, f := range r.buffer {
+		r.write(f.mat, f.at)
+		r.frames.Release(f.mat)
+	}
+	r.buffer = r.buffer[:0]
+	logger.Info(fmt.Sprintf("Cam %d %s event, cutting clip %s.", r.camID, ev.Source, filename))
+}
+
+func (r *ClipRecorder) write(mat gocv.Mat, at time.Time) {
+	if err := r.writer.Write(mat); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write event clip for cam %d: %v.", r.camID, err))
+		return
+	}
+	r.index.Record(at)
+	r.meta.Frames++
+	r.meta.EndedAt = at
+}
+
+func (r *ClipRecorder) finish() {
+	if err := r.writer.Close(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to close event clip for cam %d: %v.", r.camID, err))
+	}
+	r.writer = nil
+	r.index.Close()
+	r.index = nil
+
+	metaFile := filepath.Join(r.dir, strings.TrimSuffix(r.meta.File, filepath.Ext(r.meta.File))+".json")
+	data, err := json.MarshalIndent(r.meta, "", "  ")
+	if err == nil {
+		err = os.WriteFile(metaFile, data, 0o644)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to write event metadata for cam %d: %v.", r.camID, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("Cam %d event clip finished: %d frames.", r.camID, r.meta.Frames))
+	storeSidecars(filepath.Join(r.dir, r.meta.File))
+}
+
+// bufferOnDisk keeps the pre-roll in a DiskBuffer under --buffer-dir instead of memory.
+func (r *ClipRecorder) bufferOnDisk(kind string) {
+	if config.BufferDir == "" {
+		return
+	}
+	dir := filepath.Join(config.BufferDir, fmt.Sprintf("cam%d_%s", r.camID, kind))
+	disk, err := newDiskBuffer(dir)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Cam %d keeps its %s pre-roll in memory, could not use %s: %v.", r.camID, kind, dir, err))
+		return
+	}
+	r.disk = disk
+}
+
+func (r *ClipRecorder) Close() {
+	if r.writer != nil {
+		r.finish()
+	}
+	if r.disk != nil {
+		r.disk.Close()
+	}
+	for _, f := range r.buffer {
+		r.frames.Release(f.mat)
+	}
+	r.buffer = nil
+	r.frames.Close()
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	writerOpenCV = "opencv"
+	writerFFmpeg = "ffmpeg"
+)
+
+var bitrateRe = regexp.MustCompile(`^\d+(\.\d+)?[kKmMgG]?$`)
+
+// intermediateCodec is an editing codec written by ffmpeg in place of the --codec fourcc.
+type intermediateCodec struct {
+	encoder string
+	profile string
+	pixFmt  string
+	// bytesPerPixel approximates the size of one frame per pixel, for the storage estimate.
+	bytesPerPixel float64
+}
+
+// intermediateCodecs are the --intermediate choices: Apple ProRes and Avid DNxHR, which unlike DNxHD
+// accepts any resolution and frame rate.
+var intermediateCodecs = map[string]intermediateCodec{
+	"prores-proxy": {"prores_ks", "0", "yuv422p10le", 0.09},
+	"prores-lt":    {"prores_ks", "1", "yuv422p10le", 0.2},
+	"prores":       {"prores_ks", "2", "yuv422p10le", 0.3},
+	"prores-hq":    {"prores_ks", "3", "yuv422p10le", 0.44},
+	"prores-4444":  {"prores_ks", "4", "yuv444p10le", 0.66},
+	"dnxhr-lb":     {"dnxhd", "dnxhr_lb", "yuv422p", 0.09},
+	"dnxhr-sq":     {"dnxhd", "dnxhr_sq", "yuv422p", 0.29},
+	"dnxhr-hq":     {"dnxhd", "dnxhr_hq", "yuv422p", 0.44},
+	"dnxhr-hqx":    {"dnxhd", "dnxhr_hqx", "yuv422p10le", 0.44},
+	"dnxhr-444":    {"dnxhd", "dnxhr_444", "yuv444p10le", 0.88},
+}
+
+// intermediateContainers are the containers editing software reads ProRes and DNxHR from.
+var intermediateContainers = []string{"mov", "mxf"}
+
+func validateWriter(s string) error {
+	if s != writerOpenCV && s != writerFFmpeg {
+		return fmt.Errorf("writer must be %s or %s", writerOpenCV, writerFFmpeg)
+	}
+	return nil
+}
+
+func validateBitrate(s string) error {
+	if !bitrateRe.MatchString(s) {
+		return fmt.Errorf("invalid bitrate %q, expected e.g. 4M or 800k", s)
+	}
+	return nil
+}
+
+func validateIntermediate(s string) error {
+	if _, ok := intermediateCodecs[s]; !ok {
+		names := slices.Sorted(maps.Keys(intermediateCodecs))
+		return fmt.Errorf("intermediate codec must be one of %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// checkFFmpeg makes sure ffmpeg is available when recordings are written through it.
+func checkFFmpeg() error {
+	if config.Intermediate != "" && !slices.Contains(intermediateContainers, config.Container) {
+		return fmt.Errorf("--intermediate files must be written to a %s container", strings.Join(intermediateContainers, " or "))
+	}
+	if config.Writer != writerFFmpeg && !audioEnabled() && !remoteStorage() {
+		return nil
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return errors.New("ffmpeg is required by --writer ffmpeg, --audio and --storage but was not found in PATH")
+	}
+	return nil
+}
+
+// newFrameWriter opens a video-only writer with the --writer backend.
+func newFrameWriter(filename, codec string, fps float64, width, height int) (FrameWriter, error) {
+	if config.Writer == writerFFmpeg {
+		return newFFmpegWriter(filename, codec, fps, width, height, nil)
+	}
+	writer, err := gocv.VideoWriterFile(filename, codec, fps, width, height, true)
+	if err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// ffmpegVideoCodecs maps recording fourccs to the ffmpeg encoder producing them.
+var ffmpegVideoCodecs = map[string]string{
+	"avc1": "libx264",
+	"H264": "libx264",
+	"X264": "libx264",
+	"hvc1": "libx265",
+	"HEVC": "libx265",
+	"mp4v": "mpeg4",
+	"XVID": "mpeg4",
+	"MJPG": "mjpeg",
+	"VP80": "libvpx",
+	"VP90": "libvpx-vp9",
+}
+
+// ffmpegAudioCodec picks an audio codec the container can hold.
+func ffmpegAudioCodec(container string) string {
+	if config.Intermediate != "" {
+		// Editing software expects uncompressed audio next to intermediates.
+		return "pcm_s16le"
+	}
+	switch container {
+	case "avi":
+		return "pcm_s16le"
+	case "webm":
+		return "libopus"
+	}
+	return "aac"
+}
+
+// FFmpegWriter pipes raw BGR frames to an ffmpeg process, which encodes them with any encoder and container
+// ffmpeg supports and, if an audio source is given, muxes the source's PCM into the same file. With a
+// remote --storage ffmpeg writes to its stdout instead, which is streamed into the storage.
+type FFmpegWriter struct {
+	filename string
+	cmd      *exec.Cmd
+	video    io.WriteCloser
+	stderr   bytes.Buffer
+	audio    *AudioSource
+	sub      *audioSubscription
+	// out and streamed are the storage object and the result of copying ffmpeg's output into it.
+	out      *countingWriter
+	streamed chan error
+}
+
+func newFFmpegWriter(filename, codec string, fps float64, width, height int, audio *AudioSource) (*FFmpegWriter, error) {
+	encoder, ok := ffmpegVideoCodecs[codec]
+	if !ok {
+		encoder = strings.ToLower(codec)
+	}
+	if config.FFmpegCodec != "" {
+		encoder = config.FFmpegCodec
+	}
+	var encode []string
+	if ic, ok := intermediateCodecs[config.Intermediate]; ok {
+		// Intermediates have fixed data rates per profile, so --crf and --bitrate do not apply.
+		encode = append(encode, "-c:v", ic.encoder, "-profile:v", ic.profile, "-pix_fmt", ic.pixFmt)
+		if ic.encoder == "prores_ks" {
+			encode = append(encode, "-vendor", "apl0")
+		}
+	} else {
+		encode = append(encode, "-c:v", encoder)
+		if config.CRF >= 0 {
+			encode = append(encode, "-crf", fmt.Sprint(config.CRF))
+		}
+		if config.Bitrate != "" {
+			encode = append(encode, "-b:v", config.Bitrate)
+		}
+		if encoder != "mjpeg" {
+			encode = append(encode, "-pix_fmt", "yuv420p")
+		}
+	}
+	return startFFmpegWriter(filename, encode, fps, width, height, audio)
+}
+
+// newLosslessFFmpegWriter writes a --lossless ffv1 recording through ffmpeg. The encoder is fixed, so
+// --ffmpeg-codec, --intermediate, --crf and --bitrate do not apply, and the frames keep their colours.
+func newLosslessFFmpegWriter(filename string, fps float64, width, height int) (*FFmpegWriter, error) {
+	return startFFmpegWriter(filename, []string{"-c:v", "ffv1", "-pix_fmt", "bgr0"}, fps, width, height, nil)
+}
+
+// startFFmpegWriter starts ffmpeg encoding the frames with the encode arguments into filename.
+func startFFmpegWriter(filename string, encode []string, fps float64, width, height int, audio *AudioSource) (*FFmpegWriter, error) {
+	args := []string{"-hide_banner", "-loglevel", "error", "-y",
+		"-f", "rawvideo", "-pix_fmt", "bgr24", "-s", fmt.Sprintf("%dx%d", width, height), "-framerate", fmt.Sprint(fps), "-i", "pipe:0"}
+	if audio != nil {
+		args = append(args, "-f", "s16le", "-ar", fmt.Sprint(audioSampleRate), "-ac", fmt.Sprint(audioChannels), "-i", "pipe:3",
+			"-map", "0:v", "-map", "1:a", "-c:a", ffmpegAudioCodec(strings.TrimPrefix(filepath.Ext(filename), ".")), "-shortest")
+	}
+	args = append(args, encode...)
+	output := filename
+	if remoteStorage() {
+		args = append(args, streamingFormats[strings.TrimPrefix(filepath.Ext(filename), ".")]...)
+		output = "pipe:1"
+	}
+	args = append(args, output)
+
+	w := &FFmpegWriter{filename: filename, cmd: exec.Command("ffmpeg", args...), audio: audio}
+	w.cmd.Stderr = &w.stderr
+	video, err := w.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	w.video = video
+	var stdout io.Reader
+	if output != filename {
+		if stdout, err = w.cmd.StdoutPipe(); err != nil {
+			return nil, err
+		}
+	}
+
+	var audioPipe *os.File
+	if audio != nil {
+		if audioPipe, w.sub, err = audio.subscribe(); err != nil {
+			return nil, err
+		}
+		w.cmd.ExtraFiles = []*os.File{audioPipe}
+	}
+	if stdout != nil {
+		dst, err := createOutput(filename)
+		if err != nil {
+			if audioPipe != nil {
+				_ = audioPipe.Close()
+				audio.unsubscribe(w.sub)
+			}
+			return nil, fmt.Errorf("could not create %s in %s: %w", filename, storage, err)
+		}
+		w.out = &countingWriter{WriteCloser: dst}
+	}
+	err = w.cmd.Start()
+	if audioPipe != nil {
+		_ = audioPipe.Close()
+	}
+	if err != nil {
+		if w.sub != nil {
+			audio.unsubscribe(w.sub)
+		}
+		if w.out != nil {
+			_ = w.out.Close()
+		}
+		return nil, fmt.Errorf("could not start ffmpeg for %s: %w", filename, err)
+	}
+	if w.out != nil {
+		w.streamed = make(chan error, 1)
+		go func() {
+			_, err := io.Copy(w.out, stdout)
+			if err != nil {
+				// ffmpeg would block on its full stdout; stopping it fails the next frame instead.
+				_ = w.cmd.Process.Kill()
+			}
+			w.streamed <- err
+		}()
+	}
+	return w, nil
+}
+
+func (w *FFmpegWriter) Write(img gocv.Mat) error {
+	if _, err := w.video.Write(img.ToBytes()); err != nil {
+		return fmt.Errorf("ffmpeg stopped: %w", err)
+	}
+	return nil
+}
+
+// Size is the bytes streamed to the storage so far, or the size of the local file, for --segment-size.
+func (w *FFmpegWriter) Size() int64 {
+	if w.out != nil {
+		return w.out.n.Load()
+	}
+	fi, err := os.Stat(w.filename)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// Close ends the video and audio streams and waits for ffmpeg to finalize the file, and for a remote
+// storage to complete the object.
+func (w *FFmpegWriter) Close() error {
+	err := w.video.Close()
+	if w.sub != nil {
+		w.audio.unsubscribe(w.sub)
+	}
+	if w.out != nil {
+		if streamErr := <-w.streamed; streamErr != nil {
+			err = cmp.Or(err, fmt.Errorf("could not stream %s to %s: %w", w.filename, storage, streamErr))
+		}
+	}
+	waitErr := w.cmd.Wait()
+	if w.out != nil {
+		if closeErr := w.out.Close(); closeErr != nil {
+			err = cmp.Or(err, fmt.Errorf("could not store %s in %s: %w", w.filename, storage, closeErr))
+		}
+	}
+	if waitErr != nil {
+		return fmt.Errorf("ffmpeg failed for %s: %w %s", w.filename, waitErr, strings.TrimSpace(w.stderr.String()))
+	}
+	return err
+}
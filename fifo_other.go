@@ -0,0 +1,16 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+func makeFifo(string) error {
+	return errors.New("named pipes are not supported on this platform")
+}
+
+func openFifo(string) (io.WriteCloser, error) {
+	return nil, errors.New("named pipes are not supported on this platform")
+}
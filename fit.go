@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+	"gocv.io/x/gocv"
+)
+
+const (
+	fitAudioBitrate = 128_000
+	fitMinBitrate   = 100_000
+	// fitMargin leaves room for container overhead and the encoder missing its target bitrate.
+	fitMargin = 0.95
+)
+
+// fitFile is one recording of a session being re-encoded by fit.
+type fitFile struct {
+	src     string
+	dst     string
+	seconds float64
+	// pixelRate is the pixels per second the file shows; bitrates are shared out in proportion to it.
+	pixelRate float64
+	audio     bool
+}
+
+func fitCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "fit",
+		Usage:     "Re-encode the recordings of a session into another directory so that together they fit a size",
+		ArgsUsage: "<session-id>",
+		Flags: []cli.Flag{
+			&cli.Float64Flag{Name: "size", Usage: "Total size in GB the recordings must fit, e.g. 32 for a 32GB card", Required: true, Validator: func(f float64) error {
+				if f <= 0 {
+					return errors.New("size must be greater than zero")
+				}
+				return nil
+			}},
+			&cli.StringFlag{Name: "to", Usage: "Directory the re-encoded session is written to, keeping its file names", Required: true},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := setup(cmd); err != nil {
+				return err
+			}
+			if cmd.Args().Len() != 1 {
+				return errors.New("fit takes the session ID, e.g. fit 1714557600 --size 32 --to /media/card")
+			}
+			return fitSession(ctx, cmd.Args().First(), cmd.Float64("size")*1e9, cmd.String("to"))
+		},
+	}
+}
+
+// fitSession re-encodes every recording of a session with two-pass ffmpeg at bitrates that share size
+// out by resolution, frame rate and duration, then copies the sidecars and manifest alongside.
+func fitSession(ctx context.Context, sessionID string, size float64, dir string) error {
+	m, err := readManifest(config.OutputDir, sessionID)
+	if err != nil {
+		return fmt.Errorf("could not open session %s: %w", sessionID, err)
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return errors.New("ffmpeg is required to re-encode but was not found in PATH")
+	}
+	src, _ := filepath.Abs(filepath.Dir(m.path))
+	if dst, _ := filepath.Abs(dir); dst == src {
+		return errors.New("the re-encoded session must go to another directory than the original")
+	}
+
+	var files []fitFile
+	var pixels, audioBits float64
+	// skipped are the files left out, which the re-encoded session's manifest does not list.
+	skipped := map[string]bool{}
+	for i := range m.Cameras {
+		cam := &m.Cameras[i]
+		var kept []string
+		for _, file := range cam.Files {
+			src := m.absPath(file)
+			seconds, err := videoDuration(src)
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Skipping %s: %v.", file, err))
+				skipped[file] = true
+				continue
+			}
+			// Files recorded outside the session directory, e.g. after a failover, are placed next to the manifest.
+			name := file
+			if filepath.IsAbs(file) {
+				name = filepath.Base(file)
+			}
+			kept = append(kept, name)
+			f := fitFile{src: src, dst: filepath.Join(dir, filepath.FromSlash(name)), seconds: seconds,
+				pixelRate: float64(cam.Width*cam.Height) * cam.FPS, audio: cam.Audio != ""}
+			pixels += f.pixelRate * f.seconds
+			if f.audio {
+				audioBits += fitAudioBitrate * f.seconds
+			}
+			files = append(files, f)
+		}
+		cam.Files = kept
+	}
+	if len(files) == 0 {
+		return errors.New("the session has no recordings to re-encode")
+	}
+	videoBits := size*8*fitMargin - audioBits
+	if videoBits <= 0 || pixels <= 0 {
+		return fmt.Errorf("%.1f GB is too small for %d recording(s)", size/1e9, len(files))
+	}
+	logger.Info(fmt.Sprintf("Re-encoding %d recording(s) to fit %.1f GB.", len(files), size/1e9))
+
+	for _, f := range files {
+		bitrate := max(fitMinBitrate, int64(videoBits/pixels*f.pixelRate))
+		logger.Info(fmt.Sprintf("Encoding %s at %d kbit/s.", f.dst, bitrate/1000))
+		if err := fitEncode(ctx, f, bitrate); err != nil {
+			return fmt.Errorf("could not re-encode %s: %w", f.src, err)
+		}
+		srcBase, dstBase := strings.TrimSuffix(f.src, filepath.Ext(f.src)), strings.TrimSuffix(f.dst, filepath.Ext(f.dst))
+		for _, sidecar := range []string{".timestamps.csv", ".srt"} {
+			if err := copyFile(srcBase+sidecar, dstBase+sidecar); err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Warn(fmt.Sprintf("Could not copy %s: %v.", srcBase+sidecar, err))
+			}
+		}
+	}
+
+	if m.Offsets != nil {
+		m.Offsets.Files = slices.DeleteFunc(m.Offsets.Files, func(f FileOffset) bool { return skipped[f.File] })
+		for i, f := range m.Offsets.Files {
+			if filepath.IsAbs(f.File) {
+				m.Offsets.Files[i].File = filepath.Base(f.File)
+			}
+		}
+	}
+	m.path = filepath.Join(dir, filepath.Base(m.path))
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeAtomic(m.path, data); err != nil {
+		return err
+	}
+
+	var total int64
+	for _, f := range files {
+		if fi, err := os.Stat(f.dst); err == nil {
+			total += fi.Size()
+		}
+	}
+	logger.Info(fmt.Sprintf("Session %s re-encoded into %s, %.2f GB.", sessionID, dir, float64(total)/1e9))
+	return nil
+}
+
+func videoDuration(path string) (float64, error) {
+	video, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer video.Close()
+	fps, frames := video.Get(gocv.VideoCaptureFPS), video.Get(gocv.VideoCaptureFrameCount)
+	if fps <= 0 || frames <= 0 {
+		return 0, errors.New("unknown duration")
+	}
+	return frames / fps, nil
+}
+
+// fitEncode encodes one file in two passes with --ffmpeg-codec, libx264 by default.
+func fitEncode(ctx context.Context, f fitFile, bitrate int64) error {
+	if err := os.MkdirAll(filepath.Dir(f.dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp("", "mcam-fit")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	common := []string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y", "-i", f.src, "-map", "0:v:0",
+		"-c:v", cmp.Or(config.FFmpegCodec, "libx264"), "-b:v", strconv.FormatInt(bitrate, 10), "-pix_fmt", "yuv420p",
+		"-passlogfile", filepath.Join(tmp, "pass")}
+	first := append(slices.Clone(common), "-pass", "1", "-an", "-f", "null", "-")
+	second := append(slices.Clone(common), "-pass", "2")
+	if f.audio {
+		second = append(second, "-map", "0:a:0?", "-c:a", ffmpegAudioCodec(strings.TrimPrefix(filepath.Ext(f.dst), ".")),
+			"-b:a", strconv.Itoa(fitAudioBitrate))
+	}
+	second = append(second, f.dst)
+	for _, args := range [][]string{first, second} {
+		if out, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("ffmpeg: %w: %s", err, bytes.TrimSpace(out))
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// fpsSlow is the fraction of its target frame rate below which a camera counts as running slow.
+	fpsSlow = 0.8
+	// fpsSlowAfter is how long a camera must stay slow, or back at speed, before it is logged.
+	fpsSlowAfter = 5 * time.Second
+)
+
+// FPSMeter measures the rate frames arrive at over the last second. It is ticked by the camera
+// goroutine; the rate can be read from any goroutine.
+type FPSMeter struct {
+	times   []time.Time
+	started time.Time
+	fps     atomic.Uint64
+
+	slow  bool
+	since time.Time
+}
+
+func (m *FPSMeter) Tick(at time.Time) {
+	if m.started.IsZero() {
+		m.started = at
+	}
+	cut := at.Add(-time.Second)
+	i := 0
+	for i < len(m.times) && m.times[i].Before(cut) {
+		i++
+	}
+	m.times = append(m.times[i:], at)
+	fps := 0.0
+	if n := len(m.times); n > 1 {
+		fps = float64(n-1) / at.Sub(m.times[0]).Seconds()
+	}
+	m.fps.Store(math.Float64bits(fps))
+}
+
+// measuredFPS is the camera's frame rate over the last second, 0 if it delivered no frames in it.
+func (c *Camera) measuredFPS() float64 {
+	if last := c.lastFrameAt.Load(); last == 0 || time.Since(time.Unix(0, last)) > time.Second {
+		return 0
+	}
+	return math.Float64frombits(c.rate.fps.Load())
+}
+
+// checkFrameRate logs when the camera falls below fpsSlow of its target frame rate, and when it recovers.
+func (c *Camera) checkFrameRate(at time.Time) {
+	m := &c.rate
+	m.Tick(at)
+	if at.Sub(m.started) < time.Second {
+		return
+	}
+	fps := math.Float64frombits(m.fps.Load())
+	if slow := fps < c.FPS*fpsSlow; slow == m.slow {
+		m.since = time.Time{}
+		return
+	}
+	if m.since.IsZero() {
+		m.since = at
+	}
+	if at.Sub(m.since) < fpsSlowAfter {
+		return
+	}
+	m.slow, m.since = !m.slow, time.Time{}
+	if m.slow {
+		logger.Warn(fmt.Sprintf("Cam %d is running at %.1f fps, below its target of %.0f fps.", c.ID, fps, c.FPS))
+	} else {
+		logger.Info(fmt.Sprintf("Cam %d is back to %.1f fps.", c.ID, fps))
+	}
+}
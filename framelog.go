@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+var frameLogHeader = []string{"frame", "mono_ns", "wall_time", "capture_latency_ms", "device_ts_ms", "dropped", "duplicated"}
+
+// FrameLog writes one CSV row per capture attempt so recordings can be correlated with external sensor logs.
+type FrameLog struct {
+	file     *os.File
+	w        *csv.Writer
+	start    time.Time
+	n        int
+	lastDevT float64
+	gps      bool
+}
+
+func newFrameLog(filename string, start time.Time, gps bool) (*FrameLog, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	l := &FrameLog{file: f, w: csv.NewWriter(f), start: start, gps: gps}
+	header := frameLogHeader
+	if gps {
+		header = append(header[:len(header):len(header)], "lat", "lon", "speed_kmh")
+	}
+	if err = l.w.Write(header); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record logs a capture attempt. deviceTs is the backend's frame timestamp; a repeated
+// non-zero value means the device handed out the previous frame again.
+func (l *FrameLog) Record(at time.Time, latency time.Duration, deviceTs float64, dropped bool) {
+	duplicated := !dropped && deviceTs > 0 && deviceTs == l.lastDevT
+	if !dropped {
+		l.lastDevT = deviceTs
+	}
+	row := []string{
+		strconv.Itoa(l.n),
+		strconv.FormatInt(int64(at.Sub(l.start)), 10),
+		at.Format(time.RFC3339Nano),
+		strconv.FormatFloat(float64(latency.Microseconds())/1000, 'f', 3, 64),
+		strconv.FormatFloat(deviceTs, 'f', 3, 64),
+		strconv.FormatBool(dropped),
+		strconv.FormatBool(duplicated),
+	}
+	if l.gps {
+		if fix, ok := currentFix(); ok {
+			row = append(row, strconv.FormatFloat(fix.Lat, 'f', 7, 64), strconv.FormatFloat(fix.Lon, 'f', 7, 64), strconv.FormatFloat(fix.SpeedKmh, 'f', 2, 64))
+		} else {
+			row = append(row, "", "", "")
+		}
+	}
+	l.n++
+	if err := l.w.Write(row); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write frame log %s: %v.", l.file.Name(), err))
+	}
+	if l.n%30 == 0 {
+		l.w.Flush()
+	}
+}
+
+func (l *FrameLog) Close() error {
+	l.w.Flush()
+	if err := l.w.Error(); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
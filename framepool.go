@@ -0,0 +1,80 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"gocv.io/x/gocv"
+)
+
+// framePoolSize is how many scratch Mats a camera keeps: the transformed frame, the displayed copy and
+// the frame scaled to --record-size. Cameras keep one more for every --write-queue slot, as queued
+// frames are pooled ones handed over.
+const framePoolSize = 3
+
+// FramePool keeps scratch Mats for reuse so the per-frame paths don't allocate native memory for every
+// frame. A Mat belongs to whoever acquired it until it is released; writing into a reused Mat of the
+// same size and type keeps its buffer.
+type FramePool struct {
+	mu   sync.Mutex
+	free []gocv.Mat
+	max  int
+}
+
+func newFramePool(max int) *FramePool {
+	return &FramePool{max: max}
+}
+
+// Acquire hands out a free Mat, or a new one when none is left.
+func (p *FramePool) Acquire() gocv.Mat {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n := len(p.free); n > 0 {
+		mat := p.free[n-1]
+		p.free = p.free[:n-1]
+		return mat
+	}
+	return gocv.NewMat()
+}
+
+// Release returns mat to the pool, closing it when the pool already holds max Mats. mat must not be
+// used after.
+func (p *FramePool) Release(mat gocv.Mat) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) >= p.max {
+		_ = mat.Close()
+		return
+	}
+	p.free = append(p.free, mat)
+}
+
+// Share returns a release func for a Mat with two owners that are done with it at different times,
+// such as the capture loop and a write queue; the second call returns the Mat to the pool.
+func (p *FramePool) Share() func(gocv.Mat) {
+	var owners atomic.Int32
+	owners.Store(2)
+	return func(mat gocv.Mat) {
+		if owners.Add(-1) == 0 {
+			p.Release(mat)
+		}
+	}
+}
+
+// Copy acquires a Mat holding a copy of mat.
+func (p *FramePool) Copy(mat gocv.Mat) gocv.Mat {
+	dst := p.Acquire()
+	if err := mat.CopyTo(&dst); err != nil {
+		logger.Error(err.Error())
+	}
+	return dst
+}
+
+func (p *FramePool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, mat := range p.free {
+		_ = mat.Close()
+	}
+	p.free = nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// Gap policies decide what a recording gets while its camera delivers no frames.
+const (
+	gapContinue    = "continue"
+	gapPlaceholder = "placeholder"
+	gapPause       = "pause"
+	gapSplit       = "split"
+)
+
+var gapPolicies = []string{gapContinue, gapPlaceholder, gapPause, gapSplit}
+
+type Gap struct {
+	CamID  int       `json:"camera"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Policy string    `json:"policy"`
+}
+
+// gapThreshold is how long a camera may go without frames before it counts as an outage.
+func (c *Camera) gapThreshold() time.Duration {
+	return max(time.Second, 3*time.Duration(float64(time.Second)/c.FPS))
+}
+
+// onReadFailure starts an outage once reads have failed for longer than the gap threshold and
+// applies the gap policy to the recording.
+func (c *Camera) onReadFailure(now time.Time) {
+	if c.gapStart.IsZero() {
+		last := time.Unix(0, c.lastFrameAt.Load())
+		if c.lastFrameAt.Load() == 0 {
+			last = sessionStart
+		}
+		if now.Sub(last) < c.gapThreshold() {
+			return
+		}
+		c.gapStart = last
+		logger.Warn(fmt.Sprintf("Cam %d lost since %s, gap policy %s.", c.ID, last.Format(time.TimeOnly), config.GapPolicy))
+		if config.GapPolicy == gapPause && c.Writer != nil {
+			c.closeWriter()
+			c.gapPaused = true
+			logger.Info(fmt.Sprintf("Cam %d recording paused, finalized %s.", c.ID, c.Filename))
+		}
+	}
+
+	if config.GapPolicy == gapPlaceholder && c.Writer != nil && !c.Paused() {
+		c.fillPlaceholder(now)
+	}
+}
+
+// fillPlaceholder writes placeholder frames up to now so the file keeps real-time continuity.
+func (c *Camera) fillPlaceholder(now time.Time) {
+	interval := time.Duration(float64(time.Second) / c.FPS)
+	last := c.gapFilled
+	if last.IsZero() {
+		last = time.Unix(0, c.lastWriteAt.Load())
+		if c.lastWriteAt.Load() == 0 || now.Sub(last) > time.Hour {
+			last = now.Add(-interval)
+		}
+	}
+	mat := c.placeholderFrame()
+	defer mat.Close()
+	if c.scalesRecording() {
+		// The writer was opened at the record size, which a frame of the capture size would not match.
+		scaled := gocv.NewMat()
+		defer scaled.Close()
+		c.scaleForRecording(&scaled, mat)
+		mat = scaled
+	}
+	for ; !last.Add(interval).After(now); last = last.Add(interval) {
+		c.writeFrame(mat, last.Add(interval), nil)
+		if c.writeFailures.Load() > 0 {
+			break
+		}
+	}
+	c.gapFilled = last
+}
+
+// onReadSuccess ends an outage, reopening or splitting the recording as the gap policy requires. A camera
+// that had to be reopened always continues in a new segment.
+func (c *Camera) onReadSuccess(at time.Time) {
+	reopened := c.reopened
+	c.reopened = false
+	if c.gapStart.IsZero() {
+		if reopened && c.Writer != nil {
+			c.rotateSegment()
+		}
+		return
+	}
+	gap := Gap{CamID: c.ID, Start: c.gapStart, End: at, Policy: config.GapPolicy}
+	c.gapStart, c.gapFilled = time.Time{}, time.Time{}
+	logger.Info(fmt.Sprintf("Cam %d recovered after %v.", c.ID, at.Sub(gap.Start).Round(time.Millisecond)))
+
+	switch {
+	case config.GapPolicy == gapPause && c.gapPaused:
+		c.gapPaused = false
+		c.startRecording(c.manifest)
+	case (config.GapPolicy == gapSplit || reopened) && c.Writer != nil:
+		c.rotateSegment()
+	}
+	if c.manifest != nil {
+		c.manifest.AddGap(gap)
+	}
+}
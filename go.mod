@@ -5,3 +5,5 @@ go 1.24
 require gocv.io/x/gocv v0.41.0
 
 require github.com/urfave/cli/v3 v3.3.2
+
+require gopkg.in/yaml.v3 v3.0.1
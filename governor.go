@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	overloadRatio  = 1.1
+	recoverRatio   = 0.9
+	overloadWindow = 2 * time.Second
+	recoverWindow  = 5 * time.Second
+)
+
+// Governor watches how long the camera goroutines take to process a frame compared to the
+// frame budget. Under sustained overload it raises its level: level 1 only updates the preview
+// every other iteration, each further level skips every other recorded frame of one more camera,
+// starting with the lowest priority. A nil *Governor never drops anything.
+type Governor struct {
+	mu       sync.Mutex
+	budget   time.Duration
+	priority []int
+	level    int
+	load     float64
+	since    time.Time
+
+	previewTick    uint64
+	recordTick     map[int]uint64
+	droppedPreview int
+	droppedRecord  map[int]int
+}
+
+// parsePriority parses a comma separated list of camera IDs, most important first.
+func parsePriority(s string) ([]int, error) {
+	var ids []int
+	for _, part := range strings.Split(s, ",") {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid camera id %q", part)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func newGovernor(fps float64, cameras []*Camera) *Governor {
+	priority, _ := parsePriority(config.RecordPriority)
+	for _, cam := range cameras {
+		known := false
+		for _, id := range priority {
+			known = known || id == cam.ID
+		}
+		if !known {
+			priority = append(priority, cam.ID)
+		}
+	}
+	return &Governor{
+		budget:        time.Duration(float64(time.Second) / fps),
+		priority:      priority,
+		load:          1,
+		recordTick:    map[int]uint64{},
+		droppedRecord: map[int]int{},
+	}
+}
+
+// Observe feeds the time a camera spent processing its last frame into the governor.
+func (g *Governor) Observe(elapsed time.Duration) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.load = 0.9*g.load + 0.1*(float64(elapsed)/float64(g.budget))
+
+	now := time.Now()
+	switch {
+	case g.load > overloadRatio && g.level < len(g.priority)+1:
+		if g.since.IsZero() {
+			g.since = now
+		} else if now.Sub(g.since) >= overloadWindow {
+			g.setLevel(g.level + 1)
+			g.since = time.Time{}
+		}
+	case g.load < recoverRatio && g.level > 0:
+		if g.since.IsZero() {
+			g.since = now
+		} else if now.Sub(g.since) >= recoverWindow {
+			g.setLevel(g.level - 1)
+			g.since = time.Time{}
+		}
+	default:
+		g.since = time.Time{}
+	}
+}
+
+func (g *Governor) setLevel(level int) {
+	direction := "Overloaded"
+	if level < g.level {
+		direction = "Load recovered"
+	}
+	g.level = level
+	switch {
+	case level == 0:
+		logger.Info(fmt.Sprintf("%s (%.0f%% of frame budget): dropping nothing.", direction, g.load*100))
+	case level == 1:
+		logger.Warn(fmt.Sprintf("%s (%.0f%% of frame budget): halving preview updates.", direction, g.load*100))
+	default:
+		logger.Warn(fmt.Sprintf("%s (%.0f%% of frame budget): halving preview and recorded frames of cam(s) %v.", direction, g.load*100, g.sacrificed()))
+	}
+}
+
+// sacrificed returns the cameras whose recorded frames are thinned at the current level.
+func (g *Governor) sacrificed() []int {
+	n := min(max(g.level-1, 0), len(g.priority))
+	return g.priority[len(g.priority)-n:]
+}
+
+func (g *Governor) SkipPreview() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.previewTick++
+	if g.level < 1 || g.previewTick%2 == 0 {
+		return false
+	}
+	g.droppedPreview++
+	return true
+}
+
+func (g *Governor) SkipRecord(camID int) bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.recordTick[camID]++
+	if g.level < 2 || g.recordTick[camID]%2 == 0 {
+		return false
+	}
+	for _, id := range g.sacrificed() {
+		if id == camID {
+			g.droppedRecord[camID]++
+			return true
+		}
+	}
+	return false
+}
+
+// Shed is the number of frames of a camera kept out of its recording.
+func (g *Governor) Shed(camID int) int64 {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return int64(g.droppedRecord[camID])
+}
+
+func (g *Governor) Report() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	logger.Info(fmt.Sprintf("Load governor dropped %d preview update(s).", g.droppedPreview))
+	for _, id := range g.priority {
+		if n := g.droppedRecord[id]; n > 0 {
+			logger.Info(fmt.Sprintf("Load governor dropped %d recorded frame(s) of cam %d.", n, id))
+		}
+	}
+}
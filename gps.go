@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	knotsToKmh = 1.852
+	// gpsFixMaxAge after which the last fix is no longer stamped.
+	gpsFixMaxAge = 5 * time.Second
+)
+
+type GPSFix struct {
+	Time       time.Time `json:"time"`
+	Lat        float64   `json:"lat"`
+	Lon        float64   `json:"lon"`
+	SpeedKmh   float64   `json:"speed_kmh"`
+	Course     float64   `json:"course"`
+	Altitude   float64   `json:"altitude"`
+	Satellites int       `json:"satellites,omitempty"`
+}
+
+var gpsState struct {
+	mu         sync.RWMutex
+	fix        GPSFix
+	receivedAt time.Time
+	altitude   float64
+	satellites int
+}
+
+// currentFix returns the latest position if it is recent enough to stamp onto frames.
+func currentFix() (GPSFix, bool) {
+	gpsState.mu.RLock()
+	defer gpsState.mu.RUnlock()
+	if gpsState.receivedAt.IsZero() || time.Since(gpsState.receivedAt) > gpsFixMaxAge {
+		return GPSFix{}, false
+	}
+	return gpsState.fix, true
+}
+
+func gpsOverlayText() string {
+	fix, ok := currentFix()
+	if !ok {
+		return "GPS no fix"
+	}
+	return fmt.Sprintf("GPS %.5f, %.5f | %.1f km/h", fix.Lat, fix.Lon, fix.SpeedKmh)
+}
+
+// parseNMEA decodes RMC sentences into a fix; GGA sentences only update altitude and satellite count.
+func parseNMEA(line string) (GPSFix, bool, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "$") {
+		return GPSFix{}, false, nil
+	}
+	body, sum, hasSum := strings.Cut(line[1:], "*")
+	if hasSum {
+		var want byte
+		for i := 0; i < len(body); i++ {
+			want ^= body[i]
+		}
+		got, err := strconv.ParseUint(sum, 16, 8)
+		if err != nil || byte(got) != want {
+			return GPSFix{}, false, fmt.Errorf("bad NMEA checksum in %q", line)
+		}
+	}
+	f := strings.Split(body, ",")
+	if len(f[0]) < 5 {
+		return GPSFix{}, false, nil
+	}
+
+	switch f[0][2:] {
+	case "GGA":
+		if len(f) < 10 || f[6] == "0" {
+			return GPSFix{}, false, nil
+		}
+		gpsState.mu.Lock()
+		gpsState.satellites, _ = strconv.Atoi(f[7])
+		gpsState.altitude, _ = strconv.ParseFloat(f[9], 64)
+		gpsState.mu.Unlock()
+	case "RMC":
+		if len(f) < 10 || f[2] != "A" {
+			return GPSFix{}, false, nil
+		}
+		lat, err1 := nmeaCoord(f[3], f[4])
+		lon, err2 := nmeaCoord(f[5], f[6])
+		if err := errors.Join(err1, err2); err != nil {
+			return GPSFix{}, false, err
+		}
+		knots, _ := strconv.ParseFloat(f[7], 64)
+		course, _ := strconv.ParseFloat(f[8], 64)
+		at, err := time.Parse("020106150405", f[9]+f[1])
+		if err != nil {
+			at = time.Now().UTC()
+		}
+		return GPSFix{Time: at, Lat: lat, Lon: lon, SpeedKmh: knots * knotsToKmh, Course: course}, true, nil
+	}
+	return GPSFix{}, false, nil
+}
+
+// nmeaCoord converts NMEA (d)ddmm.mmmm plus hemisphere into signed decimal degrees.
+func nmeaCoord(v, hemi string) (float64, error) {
+	dot := strings.IndexByte(v, '.')
+	if dot < 0 {
+		dot = len(v)
+	}
+	if dot < 2 {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", v)
+	}
+	deg, err1 := strconv.ParseFloat(v[:dot-2], 64)
+	mins, err2 := strconv.ParseFloat(v[dot-2:], 64)
+	if err := errors.Join(err1, err2); err != nil {
+		return 0, fmt.Errorf("invalid NMEA coordinate %q", v)
+	}
+	deg += mins / 60
+	if hemi == "S" || hemi == "W" {
+		deg = -deg
+	}
+	return deg, nil
+}
+
+// parseGPSD decodes a gpsd TPV report.
+func parseGPSD(line string) (GPSFix, bool, error) {
+	var tpv struct {
+		Class string    `json:"class"`
+		Mode  int       `json:"mode"`
+		Time  time.Time `json:"time"`
+		Lat   float64   `json:"lat"`
+		Lon   float64   `json:"lon"`
+		Alt   float64   `json:"altMSL"`
+		Speed float64   `json:"speed"`
+		Track float64   `json:"track"`
+	}
+	if err := json.Unmarshal([]byte(line), &tpv); err != nil {
+		return GPSFix{}, false, err
+	}
+	if tpv.Class != "TPV" || tpv.Mode < 2 {
+		return GPSFix{}, false, nil
+	}
+	return GPSFix{Time: tpv.Time, Lat: tpv.Lat, Lon: tpv.Lon, SpeedKmh: tpv.Speed * 3.6, Course: tpv.Track, Altitude: tpv.Alt}, true, nil
+}
+
+// openGPS connects to gpsd://host[:port] or opens a serial NMEA device configured beforehand with stty.
+func openGPS(source string) (io.ReadCloser, func(string) (GPSFix, bool, error), error) {
+	if addr, ok := strings.CutPrefix(source, "gpsd://"); ok {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "2947")
+		}
+		conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err = io.WriteString(conn, `?WATCH={"enable":true,"json":true};`+"\n"); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+		return conn, parseGPSD, nil
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, parseNMEA, nil
+}
+
+// GPSTrack appends every fix to a CSV next to the session manifest.
+type GPSTrack struct {
+	file *os.File
+	w    *csv.Writer
+}
+
+func newGPSTrack(filename string) (*GPSTrack, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	t := &GPSTrack{file: f, w: csv.NewWriter(f)}
+	_ = t.w.Write([]string{"time", "lat", "lon", "speed_kmh", "course", "altitude", "satellites"})
+	return t, nil
+}
+
+func (t *GPSTrack) Record(fix GPSFix) {
+	_ = t.w.Write([]string{
+		fix.Time.Format(time.RFC3339Nano),
+		strconv.FormatFloat(fix.Lat, 'f', 7, 64),
+		strconv.FormatFloat(fix.Lon, 'f', 7, 64),
+		strconv.FormatFloat(fix.SpeedKmh, 'f', 2, 64),
+		strconv.FormatFloat(fix.Course, 'f', 1, 64),
+		strconv.FormatFloat(fix.Altitude, 'f', 1, 64),
+		strconv.Itoa(fix.Satellites),
+	})
+	t.w.Flush()
+}
+
+func (t *GPSTrack) Close() error {
+	t.w.Flush()
+	return t.file.Close()
+}
+
+// runGPS reads fixes from source until ctx is cancelled, reconnecting when the device or gpsd goes away.
+func runGPS(ctx context.Context, source string, manifest *Manifest, track *GPSTrack) {
+	for {
+		r, parse, err := openGPS(source)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to open GPS %s: %v.", source, err))
+		} else {
+			go func() {
+				<-ctx.Done()
+				_ = r.Close()
+			}()
+			scanner := bufio.NewScanner(r)
+			for scanner.Scan() {
+				fix, ok, err := parse(scanner.Text())
+				if err != nil || !ok {
+					continue
+				}
+				gpsState.mu.Lock()
+				if fix.Altitude == 0 {
+					fix.Altitude = gpsState.altitude
+				}
+				fix.Satellites = gpsState.satellites
+				gpsState.fix = fix
+				gpsState.receivedAt = time.Now()
+				gpsState.mu.Unlock()
+				if config.OverlayClock == clockGPS {
+					setClock(fix.Time, gpsState.receivedAt, "GPS")
+				}
+
+				manifest.SetLocation(fix)
+				if track != nil {
+					track.Record(fix)
+				}
+			}
+			_ = r.Close()
+			if ctx.Err() == nil {
+				logger.Error(fmt.Sprintf("GPS %s disconnected: %v.", source, scanner.Err()))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
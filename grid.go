@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// GridRecorder encodes the tiled view of all cameras into one file, so the session has a single synchronized overview.
+type GridRecorder struct {
+	Filename string
+	writer   FrameWriter
+	width    int
+	height   int
+	cameras  cameraList
+	done     chan struct{}
+}
+
+// gridSize is the size of the mosaic tileGrid builds for n cameras.
+func gridSize(n int) (int, int) {
+	cols, rows := gridDims(n)
+	width, height := gridTileSize(n)
+	return cols * width, rows * height
+}
+
+func newGridRecorder(cameras []*Camera, sessionID string) (*GridRecorder, error) {
+	width, height := gridSize(len(cameras))
+	filename := uniquePath(filepath.Join(activeOutputDir(), fmt.Sprintf("grid_%s.%s", sessionID, config.Container)))
+	writer, err := newFrameWriter(filename, config.Codec, config.FPS, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("could not open grid writer: %w", err)
+	}
+	g := &GridRecorder{Filename: filename, writer: writer, width: width, height: height, done: make(chan struct{})}
+	g.cameras.Store(cameras)
+	return g, nil
+}
+
+// setCameras changes the tiled cameras after a hot-plug change; the file keeps its size and
+// the mosaic is scaled to fit.
+func (g *GridRecorder) setCameras(cameras []*Camera) {
+	if g != nil {
+		g.cameras.Store(cameras)
+	}
+}
+
+// run writes the grid at --fps until ctx is done. Frames are repeated when composing falls behind, so the
+// file's timeline matches wall-clock time like the per-camera files.
+func (g *GridRecorder) run(ctx context.Context) {
+	defer close(g.done)
+	interval := time.Duration(float64(time.Second) / config.FPS)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var start time.Time
+	written := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !armed() {
+				continue
+			}
+			if start.IsZero() {
+				start = now
+			}
+			due := int(now.Sub(start)/interval) + 1
+			if privacy.Load() || !scheduleOpen.Load() {
+				written = due
+				continue
+			}
+			frame := g.compose(g.cameras.Load())
+			for ; written < due; written++ {
+				if err := g.writer.Write(frame); err != nil {
+					logger.Error(fmt.Sprintf("Failed to write grid: %v.", err))
+					written = due
+					break
+				}
+			}
+			_ = frame.Close()
+		}
+	}
+}
+
+// compose renders the layout chosen with the v hotkey, scaled to the file's size.
+func (g *GridRecorder) compose(cameras []*Camera) gocv.Mat {
+	grid := composeLayout(cameras, int(viewLayout.Load()))
+	frame := fitTile(grid, g.width, g.height)
+	_ = grid.Close()
+	return frame
+}
+
+// Close waits for run to return and finalizes the file.
+func (g *GridRecorder) Close() {
+	<-g.done
+	if err := g.writer.Close(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to finalize grid %s: %v.", g.Filename, err))
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const statusInterval = 30 * time.Second
+
+var (
+	errDurationReached  = errors.New("recording duration reached")
+	errMaxFramesReached = errors.New("maximum frames written")
+	errMaxFramesStuck   = errors.New("no camera can reach the maximum frames")
+)
+
+// stopContext is cancelled on SIGINT/SIGTERM or, if duration is set, once it has elapsed.
+func stopContext(duration time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if duration <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeoutCause(ctx, duration, errDurationReached)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// watchMaxFrames cancels ctx once every continuously recording camera has written --max-frames frames.
+// Cameras that stop, pause, go offline or are blanked before then can no longer get there, so once
+// that has lasted stallTimeout they end the run too rather than leaving it waiting forever.
+func watchMaxFrames(ctx context.Context, cameras *cameraList, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	var stuckSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reached, pending, stuck := 0, 0, 0
+		for _, cam := range cameras.Load() {
+			switch {
+			case cam.Motion != nil:
+			case cam.framesWritten.Load() >= config.MaxFrames:
+				reached++
+			case cam.progressing():
+				pending++
+			default:
+				stuck++
+			}
+		}
+		if pending > 0 {
+			stuckSince = time.Time{}
+			continue
+		}
+		if stuck > 0 {
+			if stuckSince.IsZero() {
+				stuckSince = time.Now()
+			}
+			if time.Since(stuckSince) < stallTimeout {
+				continue
+			}
+		}
+		if reached > 0 {
+			cancel(errMaxFramesReached)
+		} else {
+			cancel(errMaxFramesStuck)
+		}
+		return
+	}
+}
+
+// progressing reports whether the camera is writing frames, or is still expected to once the
+// --start-delay is over or the --schedule opens.
+func (c *Camera) progressing() bool {
+	if time.Now().UnixNano() < startAt.Load() || config.Schedule != "" && !scheduleOpen.Load() {
+		return true
+	}
+	if !c.Recording() || c.Paused() || privacy.Load() {
+		return false
+	}
+	last := c.lastFrameAt.Load()
+	return last == 0 || time.Since(time.Unix(0, last)) < stallTimeout
+}
+
+func logStopReason(ctx context.Context) {
+	if errors.Is(context.Cause(ctx), errDurationReached) {
+		logger.Info(fmt.Sprintf("Recording duration of %v reached.", config.Duration))
+		return
+	}
+	if errors.Is(context.Cause(ctx), errMaxFramesReached) {
+		logger.Info(fmt.Sprintf("Every camera has written %d frames, or can no longer write more.", config.MaxFrames))
+		return
+	}
+	if errors.Is(context.Cause(ctx), errMaxFramesStuck) {
+		logger.Warn(fmt.Sprintf("No camera is recording continuously toward %d frames, stopping.", config.MaxFrames))
+		return
+	}
+	logger.Info("Interrupted, stopping.")
+}
+
+// runHeadless drives commands and events without a window until ctx is done or a stop command arrives.
+// It returns the cameras as changed by hot-plug.
+func runHeadless(ctx context.Context, cameras []*Camera, manifest *Manifest) []*Camera {
+	frameInterval := time.Duration(float64(time.Second) / config.FPS)
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	status := time.NewTicker(statusInterval)
+	defer status.Stop()
+
+	logger.Info("Recording headless. Press Ctrl+C to stop.")
+	captured := map[int]int64{}
+	written := map[int]int64{}
+	lastStatus := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			logStopReason(ctx)
+			return cameras
+		case now := <-status.C:
+			elapsed := now.Sub(lastStatus).Seconds()
+			lastStatus = now
+			for _, cam := range cameras {
+				c, w := cam.framesCaptured.Load(), cam.framesWritten.Load()
+				state := "paused"
+				if cam.Recording() {
+					state = "recording"
+				}
+				rate := float64(c-captured[cam.ID]) / elapsed
+				slow := ""
+				if rate < cam.FPS*fpsSlow {
+					slow = fmt.Sprintf(", below its %.0f fps target", cam.FPS)
+				}
+				logger.Info(fmt.Sprintf("Cam %d %s: %.1f fps captured%s, %.1f fps written, %d frames total.",
+					cam.ID, state, rate, slow, float64(w-written[cam.ID])/elapsed, w))
+				captured[cam.ID], written[cam.ID] = c, w
+			}
+		case now := <-ticker.C:
+			loopAt.Store(now.UnixNano())
+			cameras = applyCameraChanges(cameras)
+			if runCommands(cameras, manifest) {
+				logger.Info("Stop requested.")
+				return cameras
+			}
+			dispatchEvents(cameras)
+		}
+	}
+}
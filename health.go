@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// loopAt is the unix-nano time of the last capture loop iteration, used to detect a wedged process.
+var loopAt atomic.Int64
+
+type cameraHealth struct {
+	ID        int       `json:"id"`
+	LastFrame time.Time `json:"last_frame"`
+	LastWrite time.Time `json:"last_write"`
+	FramesOK  bool      `json:"frames_ok"`
+	WriterOK  bool      `json:"writer_ok"`
+}
+
+type healthReport struct {
+	Status   string         `json:"status"`
+	LastLoop time.Time      `json:"last_loop"`
+	Cameras  []cameraHealth `json:"cameras,omitempty"`
+}
+
+func fresh(at int64, now time.Time) bool {
+	return at != 0 && now.Sub(time.Unix(0, at)) <= config.HealthTimeout
+}
+
+// handleHealthz reports liveness: the capture loop is still iterating.
+func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+	report := healthReport{Status: "ok", LastLoop: time.Unix(0, loopAt.Load())}
+	if !fresh(loopAt.Load(), now) {
+		report.Status = "stalled"
+	}
+	writeHealth(w, report)
+}
+
+// handleReadyz reports readiness: every camera delivers frames and its writer is progressing.
+func (s *Server) handleReadyz(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now()
+	report := healthReport{Status: "ok", LastLoop: time.Unix(0, loopAt.Load())}
+	for _, cam := range s.cameras.Load() {
+		lastFrame, lastWrite := cam.lastFrameAt.Load(), cam.lastWriteAt.Load()
+		h := cameraHealth{
+			ID:        cam.ID,
+			LastFrame: time.Unix(0, lastFrame),
+			LastWrite: time.Unix(0, lastWrite),
+			FramesOK:  fresh(lastFrame, now),
+			WriterOK:  !cam.Recording() || fresh(lastWrite, now),
+		}
+		if !h.FramesOK || !h.WriterOK {
+			report.Status = "degraded"
+		}
+		report.Cameras = append(report.Cameras, h)
+	}
+	writeHealth(w, report)
+}
+
+func writeHealth(w http.ResponseWriter, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	hotplugInterval = 3 * time.Second
+	// hotplugStall is how long a local camera may deliver no frames before it counts as unplugged on
+	// platforms where device nodes cannot be listed.
+	hotplugStall = 10 * time.Second
+)
+
+// cameraChanges carries camera additions and removals to the UI or headless loop, which owns the
+// camera slice and applies them between frames.
+var cameraChanges = make(chan func([]*Camera) []*Camera, 16)
+
+func applyCameraChanges(cameras []*Camera) []*Camera {
+	for {
+		select {
+		case change := <-cameraChanges:
+			cameras = change(cameras)
+		default:
+			return cameras
+		}
+	}
+}
+
+// cameraList shares the current cameras with goroutines outside the loop that owns them. Stored
+// slices are never modified afterwards.
+type cameraList struct {
+	p atomic.Pointer[[]*Camera]
+}
+
+func (l *cameraList) Load() []*Camera {
+	if p := l.p.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+func (l *cameraList) Store(cameras []*Camera) {
+	l.p.Store(&cameras)
+}
+
+// Hotplug opens local cameras plugged in after startup and finalizes those that are unplugged.
+// On Linux the /dev/videoN nodes are listed; elsewhere unopened indexes are probed and a camera
+// that stops delivering frames for hotplugStall is treated as unplugged.
+type Hotplug struct {
+	ctx      context.Context
+	gov      *Governor
+	manifest *Manifest
+	publish  func([]*Camera)
+	done     chan struct{}
+
+	open     map[int]*Camera
+	failed   map[int]bool
+	reserved map[int]bool
+}
+
+// newHotplug starts from the cameras already open; cameras it adds run with ctx.
+func newHotplug(ctx context.Context, gov *Governor, manifest *Manifest, cameras []*Camera, publish func([]*Camera)) *Hotplug {
+	h := &Hotplug{ctx: ctx, gov: gov, manifest: manifest, publish: publish, done: make(chan struct{}),
+		open: map[int]*Camera{}, failed: map[int]bool{}, reserved: map[int]bool{}}
+	for _, cam := range cameras {
+		if cam.Source != "" {
+			h.reserved[cam.ID] = true
+		} else {
+			h.open[cam.ID] = cam
+		}
+	}
+	return h
+}
+
+func (h *Hotplug) watch(ctx context.Context) {
+	defer close(h.done)
+	ticker := time.NewTicker(hotplugInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.scan(ctx)
+		}
+	}
+}
+
+// Wait blocks until watch has returned, after which all its changes are queued.
+func (h *Hotplug) Wait() {
+	<-h.done
+}
+
+func (h *Hotplug) scan(ctx context.Context) {
+	present, listed := videoDevices()
+	now := time.Now()
+	for id, cam := range h.open {
+		if listed && slices.Contains(present, id) || !listed && !stalled(cam, now) {
+			continue
+		}
+		delete(h.open, id)
+		logger.Warn(fmt.Sprintf("Cam %d unplugged, finalizing its files.", id))
+		if !h.send(ctx, h.remove(cam)) {
+			return
+		}
+	}
+	for id := range h.failed {
+		if !slices.Contains(present, id) {
+			delete(h.failed, id)
+		}
+	}
+
+	candidates := present
+	if !listed {
+		candidates = nil
+		for id := range config.MaxCam {
+			candidates = append(candidates, id)
+		}
+	}
+	for _, id := range candidates {
+		if h.open[id] != nil || h.failed[id] || h.reserved[id] || !wantedDevice(id) {
+			continue
+		}
+		settings := cameraSettings(id)
+		settings.FileIndex = h.manifest.fileCount(id)
+		cam, err := openCamera(settings)
+		if err != nil {
+			// Nodes that are not capture devices, such as a camera's metadata node, are skipped until they go away.
+			h.failed[id] = listed
+			continue
+		}
+		h.open[id] = cam
+		logger.Info(fmt.Sprintf("Cam %d plugged in.", id))
+		if !h.send(ctx, h.add(cam)) {
+			cam.Close()
+			return
+		}
+	}
+}
+
+func (h *Hotplug) send(ctx context.Context, change func([]*Camera) []*Camera) bool {
+	select {
+	case cameraChanges <- change:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (h *Hotplug) add(cam *Camera) func([]*Camera) []*Camera {
+	return func(cameras []*Camera) []*Camera {
+		h.manifest.AddCamera(cam)
+		cam.manifest = h.manifest
+		attachSinks([]*Camera{cam})
+		cam.start(h.ctx, h.gov)
+		if (config.StartDelay > 0 || config.Schedule != "") && cam.Motion == nil && armed() && scheduleOpen.Load() {
+			cam.do(func() { cam.startRecording(h.manifest) })
+		}
+		if privacy.Load() {
+			cam.do(cam.stopRecording)
+		}
+		if cam.Filename != "" {
+			logger.Info(fmt.Sprintf("Opened cam %d will write to %s.", cam.ID, cam.Filename))
+		}
+		h.manifest.AddMarker(Marker{Time: time.Now(), CamID: cam.ID, Source: "hotplug", Note: "camera plugged in"})
+		publishStatus(StatusEvent{Type: statusCameraOpened, CamID: cam.ID, Note: "plugged in"})
+		cameras = append(cameras, cam)
+		h.publish(cameras)
+		return cameras
+	}
+}
+
+func (h *Hotplug) remove(cam *Camera) func([]*Camera) []*Camera {
+	return func(cameras []*Camera) []*Camera {
+		cameras = slices.DeleteFunc(slices.Clone(cameras), func(c *Camera) bool { return c == cam })
+		h.publish(cameras)
+		cam.cancel()
+		<-cam.done
+		cam.Close()
+		h.manifest.AddMarker(Marker{Time: time.Now(), CamID: cam.ID, Source: "hotplug", Note: "camera unplugged"})
+		publishStatus(StatusEvent{Type: statusCameraLost, CamID: cam.ID, Note: "unplugged"})
+		return cameras
+	}
+}
+
+// wantedDevice reports whether a device index may be recorded: it must be in --cameras if that is
+// set and otherwise below --max-cam.
+func wantedDevice(id int) bool {
+	if config.Devices == "" {
+		return id < config.MaxCam
+	}
+	ids, _ := parseCameraList(config.Devices)
+	return slices.Contains(ids, id)
+}
+
+func stalled(cam *Camera, now time.Time) bool {
+	last := cam.lastFrameAt.Load()
+	return last != 0 && now.Sub(time.Unix(0, last)) > hotplugStall
+}
@@ -0,0 +1,25 @@
+//go:build linux
+
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// videoDevices lists the indexes of the /dev/videoN nodes. A node disappears as soon as its camera
+// is unplugged, so the list is authoritative for removals too.
+func videoDevices() ([]int, bool) {
+	paths, err := filepath.Glob("/dev/video*")
+	if err != nil {
+		return nil, false
+	}
+	var ids []int
+	for _, p := range paths {
+		if id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(p), "video")); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids, true
+}
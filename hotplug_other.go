@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// videoDevices is only implemented on Linux; elsewhere hot-plug probes capture indexes instead.
+func videoDevices() ([]int, bool) {
+	return nil, false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// reservedKeys are taken by the built-in hotkeys and cannot select a custom layout.
+const reservedKeys = "0123456789vVsScCeEwWbBuUpPnNrRmMgGtTjJlLiIkKhH[]+=- "
+
+// CustomLayout is a layout from the config file's layouts list, placing cameras at fixed rectangles
+// of a canvas.
+type CustomLayout struct {
+	Name    string       `yaml:"name"`
+	Key     string       `yaml:"key"`
+	Width   int          `yaml:"width"`
+	Height  int          `yaml:"height"`
+	Cameras []LayoutCell `yaml:"cameras"`
+}
+
+type LayoutCell struct {
+	ID     int `yaml:"id"`
+	X      int `yaml:"x"`
+	Y      int `yaml:"y"`
+	Width  int `yaml:"width"`
+	Height int `yaml:"height"`
+}
+
+func validateLayouts(layouts []CustomLayout) error {
+	seen := map[string]bool{}
+	for _, l := range layouts {
+		if l.Name == "" {
+			return errors.New("every layout needs a name")
+		}
+		if seen[l.Name] || slices.Contains(layoutNames, l.Name) {
+			return fmt.Errorf("layout %s is defined twice", l.Name)
+		}
+		seen[l.Name] = true
+		if l.Key != "" && (len(l.Key) != 1 || strings.Contains(reservedKeys, l.Key)) {
+			return fmt.Errorf("layout %s: key must be a single character not used by another hotkey", l.Name)
+		}
+		if l.Width < 0 || l.Height < 0 {
+			return fmt.Errorf("layout %s: width and height must be positive", l.Name)
+		}
+		if len(l.Cameras) == 0 {
+			return fmt.Errorf("layout %s has no cameras", l.Name)
+		}
+		for _, c := range l.Cameras {
+			if c.X < 0 || c.Y < 0 || c.Width <= 0 || c.Height <= 0 {
+				return fmt.Errorf("layout %s: camera %d needs a positive width and height at x and y of 0 or more", l.Name, c.ID)
+			}
+		}
+	}
+	for i, l := range layouts {
+		if l.Key != "" && slices.ContainsFunc(layouts[i+1:], func(o CustomLayout) bool { return o.Key == l.Key }) {
+			return fmt.Errorf("layouts %s and another use the key %s", l.Name, l.Key)
+		}
+	}
+	return nil
+}
+
+// layoutForKey is the custom layout selected with key.
+func layoutForKey(key int) (int, bool) {
+	for i, l := range config.Layouts {
+		if l.Key != "" && int(l.Key[0]) == key {
+			return len(layoutNames) + i, true
+		}
+	}
+	return 0, false
+}
+
+// composeCustom draws the cameras of l at their rectangles; its canvas defaults to the smallest that
+// holds them all.
+func composeCustom(cameras []*Camera, l CustomLayout) gocv.Mat {
+	width, height := l.Width, l.Height
+	if width == 0 || height == 0 {
+		for _, c := range l.Cameras {
+			width, height = max(width, c.X+c.Width), max(height, c.Y+c.Height)
+		}
+	}
+	canvas := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), height, width, gocv.MatTypeCV8UC3)
+	bounds := image.Rect(0, 0, width, height)
+	for _, c := range l.Cameras {
+		i := slices.IndexFunc(cameras, func(cam *Camera) bool { return cam.ID == c.ID })
+		r := image.Rect(c.X, c.Y, c.X+c.Width, c.Y+c.Height).Intersect(bounds)
+		if i < 0 || r.Empty() {
+			continue
+		}
+		pasteTile(&canvas, cameras[i], r)
+	}
+	return canvas
+}
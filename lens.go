@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Lens describes a camera's optics for reconstruction tools downstream.
+type Lens struct {
+	Model       string  `yaml:"model" json:"model,omitempty"`
+	FocalLength float64 `yaml:"focal-length" json:"focal_length_mm,omitempty"`
+	HFOV        float64 `yaml:"hfov" json:"hfov_deg,omitempty"`
+	VFOV        float64 `yaml:"vfov" json:"vfov_deg,omitempty"`
+}
+
+// Pose is where a camera is mounted in the rig: position in metres and orientation in degrees.
+type Pose struct {
+	X     float64 `yaml:"x" json:"x"`
+	Y     float64 `yaml:"y" json:"y"`
+	Z     float64 `yaml:"z" json:"z"`
+	Yaw   float64 `yaml:"yaw" json:"yaw"`
+	Pitch float64 `yaml:"pitch" json:"pitch"`
+	Roll  float64 `yaml:"roll" json:"roll"`
+}
+
+func (l *Lens) validate() error {
+	if l == nil {
+		return nil
+	}
+	if l.FocalLength < 0 {
+		return errors.New("lens focal-length must not be negative")
+	}
+	if l.HFOV < 0 || l.HFOV >= 360 || l.VFOV < 0 || l.VFOV >= 360 {
+		return errors.New("lens hfov and vfov must be between 0 and 360 degrees")
+	}
+	return nil
+}
+
+// snapshotMeta is written next to a snapshot of a camera with a lens or pose.
+type snapshotMeta struct {
+	Camera int       `json:"camera"`
+	Label  string    `json:"label,omitempty"`
+	Time   time.Time `json:"time"`
+	Width  int       `json:"width"`
+	Height int       `json:"height"`
+	Lens   *Lens     `json:"lens,omitempty"`
+	Pose   *Pose     `json:"pose,omitempty"`
+}
+
+// writeSnapshotMeta saves the camera's geometry as <snapshot>.json.
+func (c *Camera) writeSnapshotMeta(filename string, width, height int, at time.Time) {
+	if c.Lens == nil && c.Pose == nil {
+		return
+	}
+	data, err := json.MarshalIndent(snapshotMeta{Camera: c.ID, Label: c.Name, Time: at, Width: width, Height: height, Lens: c.Lens, Pose: c.Pose}, "", "  ")
+	if err == nil {
+		err = writeAtomic(strings.TrimSuffix(filename, "."+config.SnapshotFormat)+".json", data)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to write metadata of %s: %v.", filename, err))
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	losslessPNG     = "png"
+	losslessFFV1    = "ffv1"
+	losslessHuffYUV = "huffyuv"
+
+	// pngCompression trades a little file size for keeping up with the frame rate; PNG stays lossless at every level.
+	pngCompression = 1
+)
+
+func validateLossless(s string) error {
+	if s != "" && s != losslessPNG && s != losslessFFV1 && s != losslessHuffYUV {
+		return errors.New("lossless must be png, ffv1 or huffyuv")
+	}
+	return nil
+}
+
+// losslessPath is where a --lossless recording planned at filename goes: a directory of frames for
+// png, an .mkv for ffv1 and an .avi for huffyuv.
+func losslessPath(filename, mode string) string {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	switch mode {
+	case losslessFFV1:
+		return base + ".mkv"
+	case losslessHuffYUV:
+		return base + ".avi"
+	}
+	return base
+}
+
+// pngFrameName is the file of frame n in a png sequence.
+func pngFrameName(n int) string {
+	return fmt.Sprintf("frame_%06d.png", n)
+}
+
+// openLosslessWriter opens a --lossless writer for filename, as returned by losslessPath.
+func openLosslessWriter(filename, mode string, fps float64, width, height int) (FrameWriter, error) {
+	switch mode {
+	case losslessFFV1:
+		if remoteStorage() {
+			return newLosslessFFmpegWriter(filename, fps, width, height)
+		}
+		return openVideoWriter(filename, "FFV1", encoderSoftware, 0, fps, width, height)
+	case losslessHuffYUV:
+		return openVideoWriter(filename, "HFYU", encoderSoftware, 0, fps, width, height)
+	}
+	if err := os.MkdirAll(filename, 0o755); err != nil {
+		return nil, err
+	}
+	return &PNGSequenceWriter{dir: filename}, nil
+}
+
+// PNGSequenceWriter writes each frame as a numbered PNG into a directory, or with a remote --storage
+// as an object of its own.
+type PNGSequenceWriter struct {
+	dir string
+	n   int
+	// size is the bytes written so far, for --segment-size; the directory itself has no useful size.
+	size atomic.Int64
+}
+
+func (w *PNGSequenceWriter) Write(img gocv.Mat) error {
+	name := filepath.Join(w.dir, pngFrameName(w.n))
+	buf, err := gocv.IMEncodeWithParams(gocv.PNGFileExt, img, []int{gocv.IMWritePngCompression, pngCompression})
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", name, err)
+	}
+	defer buf.Close()
+	data := buf.GetBytes()
+	if remoteStorage() {
+		err = withRetries(func() error {
+			f, err := createOutput(name)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(data); err != nil {
+				_ = f.Close()
+				return err
+			}
+			return f.Close()
+		})
+	} else {
+		err = os.WriteFile(name, data, 0o644)
+	}
+	if err != nil {
+		return err
+	}
+	w.size.Add(int64(len(data)))
+	w.n++
+	return nil
+}
+
+func (w *PNGSequenceWriter) Size() int64 {
+	return w.size.Load()
+}
+
+func (w *PNGSequenceWriter) Close() error {
+	return nil
+}
+
+// FrameIndex is the <file>.index.csv, or index.csv in a png directory, manifest of a --lossless recording, mapping every frame to its
+// capture time and, for a png sequence, its file.
+type FrameIndex struct {
+	file  *os.File
+	csv   *csv.Writer
+	png   bool
+	start time.Time
+	n     int
+}
+
+func newFrameIndex(filename, mode string, start time.Time) (*FrameIndex, error) {
+	path := strings.TrimSuffix(filename, filepath.Ext(filename)) + ".index.csv"
+	if mode == losslessPNG {
+		path = filepath.Join(filename, "index.csv")
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := &FrameIndex{file: f, csv: csv.NewWriter(f), png: mode == losslessPNG, start: start}
+	_ = idx.csv.Write([]string{"frame", "file", "wall_time", "mono_ns"})
+	return idx, nil
+}
+
+// Record adds the next written frame, captured at at. It is a no-op on a nil index.
+func (idx *FrameIndex) Record(at time.Time) {
+	if idx == nil {
+		return
+	}
+	file := ""
+	if idx.png {
+		file = pngFrameName(idx.n)
+	}
+	_ = idx.csv.Write([]string{
+		strconv.Itoa(idx.n),
+		file,
+		at.Format(time.RFC3339Nano),
+		strconv.FormatInt(int64(at.Sub(idx.start)), 10),
+	})
+	idx.n++
+}
+
+func (idx *FrameIndex) Close() {
+	if idx == nil {
+		return
+	}
+	idx.csv.Flush()
+	if err := idx.file.Close(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to close frame index %s: %v.", idx.file.Name(), err))
+	}
+}
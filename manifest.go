@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Marker struct {
+	Time   time.Time `json:"time"`
+	CamID  int       `json:"camera"`
+	Source string    `json:"source"`
+	Note   string    `json:"note,omitempty"`
+}
+
+type Failover struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"`
+}
+
+type CameraManifest struct {
+	ID        int      `json:"id"`
+	Source    string   `json:"source,omitempty"`
+	Label     string   `json:"label,omitempty"`
+	Serial    string   `json:"serial,omitempty"`
+	USBPort   string   `json:"usb_port,omitempty"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+	FPS       float64  `json:"fps"`
+	Audio     string   `json:"audio,omitempty"`
+	Files     []string `json:"files"`
+	Timelapse string   `json:"timelapse,omitempty"`
+	FrameLog  string   `json:"frame_log,omitempty"`
+	Lens      *Lens    `json:"lens,omitempty"`
+	Pose      *Pose    `json:"pose,omitempty"`
+
+	// RecordWidth and RecordHeight are the size of the files when --record-size scales them down.
+	RecordWidth  int `json:"record_width,omitempty"`
+	RecordHeight int `json:"record_height,omitempty"`
+}
+
+// Manifest describes one recording session and is rewritten in place whenever it changes.
+type Manifest struct {
+	mu   sync.Mutex
+	path string
+
+	SessionID string           `json:"session_id"`
+	Version   string           `json:"version"`
+	StartedAt time.Time        `json:"started_at"`
+	EndedAt   *time.Time       `json:"ended_at,omitempty"`
+	Resumed   []time.Time      `json:"resumed,omitempty"`
+	Cameras   []CameraManifest `json:"cameras"`
+	Markers   []Marker         `json:"markers"`
+	Failovers []Failover       `json:"failovers,omitempty"`
+	Gaps      []Gap            `json:"gaps,omitempty"`
+	Deleted   []string         `json:"deleted,omitempty"`
+	Offsets   *OffsetReport    `json:"offsets,omitempty"`
+
+	Grid          string  `json:"grid,omitempty"`
+	GPSTrack      string  `json:"gps_track,omitempty"`
+	StartLocation *GPSFix `json:"start_location,omitempty"`
+	EndLocation   *GPSFix `json:"end_location,omitempty"`
+
+	// Storage is the --storage the recordings were streamed to, without its password.
+	Storage string `json:"storage,omitempty"`
+}
+
+func newManifest(dir string, start time.Time) *Manifest {
+	id := strconv.FormatInt(start.Unix(), 10)
+	return &Manifest{
+		path:      filepath.Join(dir, fmt.Sprintf("session_%s.json", id)),
+		SessionID: id,
+		Version:   version,
+		StartedAt: start,
+		Cameras:   []CameraManifest{},
+		Markers:   []Marker{},
+	}
+}
+
+// readManifest reads the manifest of an earlier session in dir.
+func readManifest(dir, sessionID string) (*Manifest, error) {
+	path := filepath.Join(dir, fmt.Sprintf("session_%s.json", sessionID))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{path: path}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.SessionID != sessionID {
+		return nil, fmt.Errorf("%s belongs to session %s", path, m.SessionID)
+	}
+	return m, nil
+}
+
+// loadManifest reopens the manifest of an earlier session in dir so --resume can continue it.
+func loadManifest(dir, sessionID string) (*Manifest, error) {
+	m, err := readManifest(dir, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("could not resume session %s: %w", sessionID, err)
+	}
+	m.EndedAt = nil
+	m.Resumed = append(m.Resumed, time.Now())
+	if m.Cameras == nil {
+		m.Cameras = []CameraManifest{}
+	}
+	if m.Markers == nil {
+		m.Markers = []Marker{}
+	}
+	return m, nil
+}
+
+// fileCount is the number of recordings listed for a camera, so a resumed session continues their numbering.
+func (m *Manifest) fileCount(camID int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.Cameras {
+		if c.ID == camID {
+			return len(c.Files)
+		}
+	}
+	return 0
+}
+
+// AddCamera lists a camera and its first file. A camera plugged in again keeps its entry and only
+// adds the new file.
+func (m *Manifest) AddCamera(cam *Camera) {
+	m.mu.Lock()
+	for i := range m.Cameras {
+		if m.Cameras[i].ID == cam.ID {
+			if cam.Filename != "" {
+				m.Cameras[i].Files = append(m.Cameras[i].Files, m.relPath(cam.Filename))
+			}
+			m.mu.Unlock()
+			m.Save()
+			return
+		}
+	}
+	entry := CameraManifest{ID: cam.ID, Label: cam.Name, Width: cam.Width, Height: cam.Height, FPS: cam.FPS, Files: []string{},
+		Lens: cam.Lens, Pose: cam.Pose}
+	if cam.scalesRecording() {
+		entry.RecordWidth, entry.RecordHeight = cam.RecordWidth, cam.RecordHeight
+	}
+	if cam.Filename != "" {
+		entry.Files = append(entry.Files, m.relPath(cam.Filename))
+	}
+	if cam.Source != "" {
+		entry.Source = redactURL(cam.Source)
+	} else if d, ok := usbDeviceForCamera(cam.ID); ok {
+		entry.Serial, entry.USBPort = d.Serial, d.Path
+	}
+	if cam.Audio != audioDisabled {
+		entry.Audio = cam.Audio
+	}
+	if cam.Timelapse != nil {
+		entry.Timelapse = filepath.Base(cam.TimelapseFilename)
+	}
+	if cam.FrameLog != nil {
+		entry.FrameLog = filepath.Base(cam.FrameLog.file.Name())
+	}
+	m.Cameras = append(m.Cameras, entry)
+	m.mu.Unlock()
+	m.Save()
+}
+
+func (m *Manifest) AddFile(camID int, filename string) {
+	m.mu.Lock()
+	for i := range m.Cameras {
+		if m.Cameras[i].ID == camID {
+			m.Cameras[i].Files = append(m.Cameras[i].Files, m.relPath(filename))
+		}
+	}
+	m.mu.Unlock()
+	m.Save()
+}
+
+// relPath keeps files under the manifest's directory relative to it and others, e.g. on the fallback disk, as absolute paths.
+func (m *Manifest) relPath(filename string) string {
+	if rel, err := filepath.Rel(filepath.Dir(m.path), filename); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(rel)
+	}
+	if abs, err := filepath.Abs(filename); err == nil {
+		return abs
+	}
+	return filename
+}
+
+// absPath resolves a file listed in the manifest, reversing relPath.
+func (m *Manifest) absPath(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(filepath.Dir(m.path), filepath.FromSlash(file))
+}
+
+func (m *Manifest) AddGap(g Gap) {
+	m.mu.Lock()
+	m.Gaps = append(m.Gaps, g)
+	m.mu.Unlock()
+	m.Save()
+}
+
+func (m *Manifest) AddFailover(f Failover) {
+	m.mu.Lock()
+	m.Failovers = append(m.Failovers, f)
+	m.mu.Unlock()
+	m.Save()
+}
+
+// AddDeleted lists a recording removed by the retention policy.
+func (m *Manifest) AddDeleted(filename string) {
+	m.mu.Lock()
+	m.Deleted = append(m.Deleted, m.relPath(filename))
+	m.mu.Unlock()
+	m.Save()
+}
+
+// SetLocation tracks the first and latest GPS fix; only the first one is saved right away.
+func (m *Manifest) SetLocation(fix GPSFix) {
+	m.mu.Lock()
+	first := m.StartLocation == nil
+	if first {
+		m.StartLocation = &fix
+	}
+	m.EndLocation = &fix
+	m.mu.Unlock()
+	if first {
+		m.Save()
+	}
+}
+
+func (m *Manifest) AddMarker(mk Marker) {
+	m.mu.Lock()
+	m.Markers = append(m.Markers, mk)
+	m.mu.Unlock()
+	logger.Info(fmt.Sprintf("Marker from %s for cam %d: %s.", mk.Source, mk.CamID, mk.Note))
+	publishStatus(StatusEvent{Time: mk.Time, Type: statusMarker, CamID: mk.CamID, Source: mk.Source, Note: mk.Note})
+	m.Save()
+}
+
+// Close ends the session, adding the offsets between the cameras' recordings.
+func (m *Manifest) Close() {
+	m.mu.Lock()
+	now := time.Now()
+	m.EndedAt = &now
+	if m.Offsets != nil {
+		m.Offsets.compute()
+		m.Offsets.log()
+	}
+	m.mu.Unlock()
+	m.Save()
+}
+
+// Save writes the manifest atomically so a crash never leaves a truncated file behind.
+func (m *Manifest) Save() {
+	if config.Preview {
+		return
+	}
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m, "", "  ")
+	path := m.path
+	m.mu.Unlock()
+	if err == nil {
+		err = writeAtomic(path, data)
+		// After a failover the primary disk may be gone; keep the manifest with the recordings.
+		if dir := activeOutputDir(); err != nil && filepath.Dir(path) != filepath.Clean(dir) {
+			path = filepath.Join(dir, filepath.Base(path))
+			if err = writeAtomic(path, data); err == nil {
+				m.mu.Lock()
+				m.path = path
+				m.mu.Unlock()
+			}
+		}
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to write manifest %s: %v.", path, err))
+	}
+}
+
+func writeAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
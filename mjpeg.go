@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const mjpegBoundary = "frame"
+
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html><head><title>mCamRecorder</title>
+<style>body{background:#111;color:#ddd;font-family:sans-serif}img{max-width:100%}a{color:#9cf}</style></head>
+<body><h3>mCamRecorder {{.Version}} — session {{.SessionID}}</h3>
+<p><a href="/grid{{.Query}}">grid</a>{{range .Cameras}} · <a href="/cam/{{.ID}}{{$.Query}}" style="color:{{.Color}};border-bottom:3px solid {{.Color}}">cam {{.ID}}</a>{{end}}</p>
+<img src="/grid{{.Query}}" alt="grid">
+</body></html>`))
+
+func (s *Server) registerMJPEG(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /grid", s.handleGridStream)
+	mux.HandleFunc("GET /cam/{cam}", s.handleCameraStream)
+}
+
+// handleIndex serves a page showing the grid stream, keeping the access token for the stream URLs.
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Version, SessionID string
+		Query              template.URL
+		Cameras            []apiCamera
+	}{Version: version, SessionID: s.manifest.SessionID}
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		data.Query = template.URL("?access_token=" + template.URLQueryEscaper(token))
+	}
+	for _, cam := range s.cameras.Load() {
+		data.Cameras = append(data.Cameras, apiCamera{ID: cam.ID, Color: colorHex(cam.Color)})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = indexPage.Execute(w, data)
+}
+
+// handleCameraStream serves GET /cam/{cam}[?fps=N] as an MJPEG stream of one camera.
+func (s *Server) handleCameraStream(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("cam"))
+	cam := s.camera(id)
+	if err != nil || cam == nil {
+		http.Error(w, fmt.Sprintf("camera %s not found", r.PathValue("cam")), http.StatusNotFound)
+		return
+	}
+	s.streamMJPEG(w, r, cam.framesCaptured.Load, cam.previewFrame)
+}
+
+// handleGridStream serves GET /grid[?fps=N] as an MJPEG stream of all cameras tiled like the local window.
+func (s *Server) handleGridStream(w http.ResponseWriter, r *http.Request) {
+	s.streamMJPEG(w, r, func() int64 {
+		var seq int64
+		for _, cam := range s.cameras.Load() {
+			seq += cam.framesCaptured.Load()
+		}
+		return seq
+	}, func() gocv.Mat {
+		return composeLayout(s.cameras.Load(), layoutGrid)
+	})
+}
+
+// streamMJPEG pushes a new JPEG part of frame whenever seq reports a new sequence number, at most fps
+// times a second; the frame is only built once the sequence has moved on.
+func (s *Server) streamMJPEG(w http.ResponseWriter, r *http.Request, seq func() int64, frame func() gocv.Mat) {
+	fps := config.FPS
+	if v := r.URL.Query().Get("fps"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			http.Error(w, "fps must be a positive number", http.StatusBadRequest)
+			return
+		}
+		fps = min(f, config.FPS)
+	}
+
+	part := startMJPEG(w)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / fps))
+	defer ticker.Stop()
+
+	last := int64(-1)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+
+		n := seq()
+		if n == last {
+			continue
+		}
+		last = n
+		mat := frame()
+		buf, err := gocv.IMEncode(gocv.JPEGFileExt, mat)
+		_ = mat.Close()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to encode MJPEG frame: %v.", err))
+			return
+		}
+		err = part(buf.GetBytes())
+		buf.Close()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// startMJPEG writes the headers of a multipart/x-mixed-replace response and returns a function
+// that sends one JPEG as the next part and flushes it to the client.
+func startMJPEG(w http.ResponseWriter) func(jpeg []byte) error {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+	w.Header().Set("Cache-Control", "no-store")
+	return func(jpeg []byte) error {
+		_, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", mjpegBoundary, len(jpeg))
+		if err == nil {
+			_, err = w.Write(jpeg)
+		}
+		if err == nil {
+			_, err = w.Write([]byte("\r\n"))
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		return err
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	motionWidth = 160
+	// motionPixelDelta is the grey level change for a pixel to count as moving.
+	motionPixelDelta = 25
+)
+
+// MotionDetector compares consecutive downscaled grey frames and reports the fraction of changed pixels,
+// of the detection zones if there are any.
+type MotionDetector struct {
+	prev  gocv.Mat
+	zones []Zone
+	// mask is zoneMask of the zones at maskSize, the size of the downscaled frames.
+	mask     gocv.Mat
+	maskSize image.Point
+}
+
+func (d *MotionDetector) Detect(frame gocv.Mat) float64 {
+	small := gocv.NewMat()
+	height := max(1, frame.Rows()*motionWidth/max(1, frame.Cols()))
+	_ = gocv.Resize(frame, &small, image.Pt(motionWidth, height), 0, 0, gocv.InterpolationArea)
+	_ = gocv.CvtColor(small, &small, gocv.ColorBGRToGray)
+	_ = gocv.GaussianBlur(small, &small, image.Pt(5, 5), 0, 0, gocv.BorderDefault)
+	defer func() {
+		_ = d.prev.Close()
+		d.prev = small
+	}()
+	if d.prev.Empty() || d.prev.Rows() != small.Rows() {
+		return 0
+	}
+
+	diff := gocv.NewMat()
+	defer diff.Close()
+	_ = gocv.AbsDiff(d.prev, small, &diff)
+	gocv.Threshold(diff, &diff, motionPixelDelta, 255, gocv.ThresholdBinary)
+	if len(d.zones) == 0 {
+		return float64(gocv.CountNonZero(diff)) / float64(small.Rows()*small.Cols())
+	}
+	if size := image.Pt(small.Cols(), small.Rows()); d.maskSize != size {
+		_ = d.mask.Close()
+		d.mask, d.maskSize = zoneMask(d.zones, size.X, size.Y), size
+	}
+	area := gocv.CountNonZero(d.mask)
+	if area == 0 {
+		return 0
+	}
+	_ = gocv.BitwiseAnd(diff, d.mask, &diff)
+	return float64(gocv.CountNonZero(diff)) / float64(area)
+}
+
+func (d *MotionDetector) Close() {
+	_ = d.prev.Close()
+	_ = d.mask.Close()
+}
+
+// newMotionRecorder records into the output directory only while motion is detected, starting
+// with the buffered pre-roll and stopping after the post-roll without motion.
+func newMotionRecorder(c *Camera) *ClipRecorder {
+	r := newClipRecorder(c.ID, c.Codec, c.FPS, c.RecordWidth, c.RecordHeight)
+	r.preRoll = config.MotionPreRoll
+	r.postRoll = config.MotionPostRoll
+	r.name = func(at time.Time) string {
+		name := fmt.Sprintf("%s_%d_motion.%s", c.fileStem(), at.Unix(), config.Container)
+		if config.NameTemplate != "" {
+			name = c.recordingName(at, c.fileIndex+1)
+		}
+		if c.Lossless != "" {
+			name = losslessPath(name, c.Lossless)
+		}
+		return name
+	}
+	// Motion clips are the camera's recordings, written like the continuous ones.
+	r.open = c.newFileWriter
+	r.lossless = c.Lossless
+	r.bufferOnDisk("motion")
+	r.onOpen = func(filename string) {
+		c.fileIndex++
+		if c.manifest != nil {
+			c.manifest.AddFile(c.ID, filename)
+		}
+	}
+	return r
+}
+
+// detectMotion feeds the motion recorder and starts or extends its clip when enough pixels changed.
+func (c *Camera) detectMotion(mat, recorded gocv.Mat, at time.Time) {
+	c.Motion.Push(recorded, at)
+	changed := c.motion.Detect(mat)
+	if changed < config.MotionThreshold/100 {
+		return
+	}
+	if c.Motion.writer != nil {
+		c.Motion.until = at.Add(c.Motion.postRoll)
+		return
+	}
+	merged, ok := eventLimiter.Allow(c.ID, "motion", at)
+	if !ok {
+		return
+	}
+	note := fmt.Sprintf("%.1f%% of the frame changed", changed*100)
+	publishStatus(StatusEvent{Time: at, Type: statusMotion, CamID: c.ID, Note: note})
+	c.Motion.Trigger(Event{Time: at, CamID: c.ID, Source: "motion", Note: note, Merged: merged})
+}
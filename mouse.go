@@ -0,0 +1,77 @@
+package main
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// OpenCV's mouse events, which gocv does not name.
+const (
+	mouseLeftDown        = 1
+	mouseRightDown       = 2
+	mouseLeftDoubleClick = 7
+)
+
+type mouseClick struct {
+	event int
+	at    image.Point
+}
+
+// Mouse collects the clicks in the preview window for the preview loop, which handles them after
+// WaitKey like the hotkeys.
+type Mouse struct {
+	clicks chan mouseClick
+	// scale maps window coordinates back to the composed preview, which --slow-display may shrink.
+	scale float64
+}
+
+func newMouse(window *gocv.Window) *Mouse {
+	m := &Mouse{clicks: make(chan mouseClick, 16), scale: 1}
+	window.SetMouseHandler(func(event, x, y, _ int, _ interface{}) {
+		if event != mouseLeftDown && event != mouseRightDown && event != mouseLeftDoubleClick {
+			return
+		}
+		select {
+		case m.clicks <- mouseClick{event: event, at: image.Pt(x, y)}:
+		default:
+		}
+	}, nil)
+	return m
+}
+
+// Shown records the size of the composed preview and of the image shown for it.
+func (m *Mouse) Shown(composed, shown gocv.Mat) {
+	m.scale = 1
+	if shown.Cols() > 0 {
+		m.scale = float64(composed.Cols()) / float64(shown.Cols())
+	}
+}
+
+// Clicks returns the clicks since the last call, in preview coordinates.
+func (m *Mouse) Clicks() []mouseClick {
+	var clicks []mouseClick
+	for {
+		select {
+		case c := <-m.clicks:
+			c.at = image.Pt(int(float64(c.at.X)*m.scale), int(float64(c.at.Y)*m.scale))
+			clicks = append(clicks, c)
+		default:
+			return clicks
+		}
+	}
+}
+
+// gridTileAt is the index of the camera whose tile in the grid view of n cameras is at p, or -1.
+func gridTileAt(n int, p image.Point) int {
+	width, height := gridTileSize(n)
+	cols, _ := gridDims(n)
+	if p.X < 0 || p.Y < 0 || p.X >= cols*width {
+		return -1
+	}
+	i := p.Y/height*cols + p.X/width
+	if i >= n {
+		return -1
+	}
+	return i
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// nameVariables are the placeholders understood by --name-template.
+var nameVariables = []string{"cam_id", "cam_label", "date", "time", "unix", "index", "ext"}
+
+// validateNameTemplate rejects templates that would write outside the output directory.
+func validateNameTemplate(s string) error {
+	if s == "" {
+		return nil
+	}
+	if filepath.IsAbs(s) {
+		return errors.New("name template must be relative to the output directory")
+	}
+	if slices.Contains(strings.Split(filepath.ToSlash(s), "/"), "..") {
+		return errors.New("name template must not contain ..")
+	}
+	for _, m := range placeholderRe.FindAllString(s, -1) {
+		if !slices.Contains(nameVariables, m[1:len(m)-1]) {
+			return fmt.Errorf("unknown name template variable %s, expected one of %s", m, strings.Join(nameVariables, ", "))
+		}
+	}
+	return nil
+}
+
+// recordingName is the path, relative to the output directory, of the camera's next recording.
+func (c *Camera) recordingName(start time.Time, index int) string {
+	if config.NameTemplate == "" {
+		if segmenting() {
+			return fmt.Sprintf("%s_%d_seg%03d.%s", c.fileStem(), start.Unix(), c.segment+1, config.Container)
+		}
+		return fmt.Sprintf("%s_%d.%s", c.fileStem(), start.Unix(), config.Container)
+	}
+	name := expandTemplate(config.NameTemplate, func(v string) (string, bool) {
+		switch v {
+		case "cam_id":
+			return strconv.Itoa(c.ID), true
+		case "cam_label":
+			return c.fileStem(), true
+		case "date":
+			return start.Format("2006-01-02"), true
+		case "time":
+			return start.Format("150405"), true
+		case "unix":
+			return strconv.FormatInt(start.Unix(), 10), true
+		case "index":
+			return fmt.Sprintf("%03d", index), true
+		case "ext":
+			return config.Container, true
+		}
+		return "", false
+	})
+	if filepath.Ext(name) == "" {
+		name += "." + config.Container
+	}
+	return filepath.FromSlash(name)
+}
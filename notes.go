@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const maxNoteLength = 200
+
+// NotePrompt collects an operator note typed into the preview window. The note is stamped with
+// the time the prompt was opened, i.e. when the operator made the observation, not when they finished typing.
+type NotePrompt struct {
+	active   bool
+	openedAt time.Time
+	camID    int
+	text     []byte
+}
+
+func (p *NotePrompt) Active() bool {
+	return p.active
+}
+
+func (p *NotePrompt) Open(camID int) {
+	*p = NotePrompt{active: true, openedAt: time.Now(), camID: camID}
+	logger.Info("Type a note and press Enter to save it, ESC to cancel.")
+}
+
+// Key handles a key press while the prompt is open and returns the marker once Enter is pressed.
+func (p *NotePrompt) Key(key int) (Marker, bool) {
+	switch {
+	case key == 27:
+		p.active = false
+	case key == 13 || key == 10:
+		p.active = false
+		note := strings.TrimSpace(string(p.text))
+		if note != "" {
+			return Marker{Time: p.openedAt, CamID: p.camID, Source: "operator", Note: note}, true
+		}
+	case key == 8 || key == 127:
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+		}
+	case key >= 32 && key < 127 && len(p.text) < maxNoteLength:
+		p.text = append(p.text, byte(key))
+	}
+	return Marker{}, false
+}
+
+// Draw shows the prompt in a bar at the bottom of the preview, scrolled so the cursor stays visible.
+func (p *NotePrompt) Draw(img *gocv.Mat) {
+	const scale, thickness = 0.6, 1
+	bar := image.Rect(0, img.Rows()-32, img.Cols(), img.Rows())
+	if err := gocv.Rectangle(img, bar, color.RGBA{}, -1); err != nil {
+		logger.Error(fmt.Sprintf("Error drawing note prompt: %v.", err))
+		return
+	}
+	text := string(p.text)
+	for len(text) > 0 && gocv.GetTextSize("Note: "+text+"_", gocv.FontHersheySimplex, scale, thickness).X > img.Cols()-20 {
+		text = text[1:]
+	}
+	if err := gocv.PutText(img, "Note: "+text+"_", image.Pt(10, img.Rows()-10), gocv.FontHersheySimplex, scale, color.RGBA{R: 255, G: 255, B: 255}, thickness); err != nil {
+		logger.Error(fmt.Sprintf("Error drawing note prompt: %v.", err))
+	}
+}
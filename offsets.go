@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+const offsetsFromTimestamps = "frame_timestamps"
+
+// FileOffset places one recording on the session timeline, measured from the capture times of its frames.
+type FileOffset struct {
+	Camera      int       `json:"camera"`
+	File        string    `json:"file"`
+	FirstFrame  time.Time `json:"first_frame"`
+	LastFrame   time.Time `json:"last_frame"`
+	Frames      int       `json:"frames"`
+	FPS         float64   `json:"fps"`
+	MeasuredFPS float64   `json:"measured_fps,omitempty"`
+	// OffsetMs is how long after the session's first frame this file's first frame was captured.
+	OffsetMs     float64 `json:"offset_ms"`
+	OffsetFrames float64 `json:"offset_frames"`
+	// DriftMs is how much longer the frames took to capture than the file, played at FPS, takes to show
+	// them; when positive, later frames appear early.
+	DriftMs float64 `json:"drift_ms"`
+}
+
+// CameraOffset is how long after the earliest camera a camera's first recorded frame was captured.
+type CameraOffset struct {
+	Camera       int     `json:"camera"`
+	OffsetMs     float64 `json:"offset_ms"`
+	OffsetFrames float64 `json:"offset_frames"`
+}
+
+// OffsetReport lets editors line the recordings up on one timeline.
+type OffsetReport struct {
+	Method  string         `json:"method,omitempty"`
+	Origin  time.Time      `json:"origin,omitzero"`
+	Cameras []CameraOffset `json:"cameras,omitempty"`
+	Files   []FileOffset   `json:"files"`
+	// Sync is added by the sync command.
+	Sync *SyncReport `json:"sync,omitempty"`
+}
+
+// fileTiming follows the frames written to a camera's current file.
+type fileTiming struct {
+	first  time.Time
+	last   time.Time
+	frames int
+}
+
+func (t *fileTiming) Record(at time.Time) {
+	if t.frames == 0 {
+		t.first = at
+	}
+	t.last = at
+	t.frames++
+}
+
+// endFileTiming lists the timing of a closed file in the manifest.
+func (c *Camera) endFileTiming(t fileTiming, filename string) {
+	if c.manifest == nil || t.frames == 0 {
+		return
+	}
+	c.manifest.AddFileOffset(FileOffset{Camera: c.ID, File: filename, FirstFrame: t.first, LastFrame: t.last, Frames: t.frames, FPS: c.FPS})
+}
+
+func (m *Manifest) AddFileOffset(f FileOffset) {
+	f.File = m.relPath(f.File)
+	m.mu.Lock()
+	if m.Offsets == nil {
+		m.Offsets = &OffsetReport{}
+	}
+	m.Offsets.Files = append(m.Offsets.Files, f)
+	m.mu.Unlock()
+	m.Save()
+}
+
+// compute fills in the offsets of every file and camera relative to the earliest frame recorded.
+func (r *OffsetReport) compute() {
+	if len(r.Files) == 0 {
+		return
+	}
+	r.Method = offsetsFromTimestamps
+	r.Origin = slices.MinFunc(r.Files, func(a, b FileOffset) int { return a.FirstFrame.Compare(b.FirstFrame) }).FirstFrame
+	r.Cameras = nil
+	for i := range r.Files {
+		f := &r.Files[i]
+		offset := f.FirstFrame.Sub(r.Origin)
+		f.OffsetMs = durationMs(offset)
+		f.OffsetFrames = offset.Seconds() * f.FPS
+		if span := f.LastFrame.Sub(f.FirstFrame); f.Frames > 1 && span > 0 {
+			f.MeasuredFPS = float64(f.Frames-1) / span.Seconds()
+			if f.FPS > 0 {
+				f.DriftMs = durationMs(span) - 1000*float64(f.Frames-1)/f.FPS
+			}
+		}
+
+		j := slices.IndexFunc(r.Cameras, func(c CameraOffset) bool { return c.Camera == f.Camera })
+		if j < 0 {
+			r.Cameras = append(r.Cameras, CameraOffset{Camera: f.Camera, OffsetMs: f.OffsetMs, OffsetFrames: f.OffsetFrames})
+		} else if f.OffsetMs < r.Cameras[j].OffsetMs {
+			r.Cameras[j] = CameraOffset{Camera: f.Camera, OffsetMs: f.OffsetMs, OffsetFrames: f.OffsetFrames}
+		}
+	}
+	slices.SortFunc(r.Cameras, func(a, b CameraOffset) int { return a.Camera - b.Camera })
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r *OffsetReport) log() {
+	for _, c := range r.Cameras {
+		logger.Info(fmt.Sprintf("Cam %d started recording %.1f ms (%.2f frames) after the first camera.", c.Camera, c.OffsetMs, c.OffsetFrames))
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	osdScale     = 0.5
+	osdLine      = 20
+	osdBarHeight = 24
+	// osdDiskInterval is how often the status bar checks the free space of the output directory.
+	osdDiskInterval = 5 * time.Second
+)
+
+// hotkeyHelp is the help overlay shown with h.
+var hotkeyHelp = []string{
+	"ESC    finalize all files and exit",
+	"0-9    show a camera, type 1 2 for the 12th",
+	"[ ]    previous / next camera",
+	"v      cycle layouts",
+	"s c    snapshot / burst",
+	"e      fire an event",
+	"w      start/stop recording",
+	"p      pause/resume",
+	"n      add a note",
+	"b u    privacy blank / lift it",
+	"r m    rotate / mirror",
+	"j l i k + -  pan, tilt, zoom (PTZ)",
+	"space t g    stop, follow, preset (PTZ)",
+	"mouse  click a tile to show it, double click for the grid, right click to snapshot",
+	"h      hide this help",
+}
+
+// OSD draws the status bar and the hotkey help over the preview.
+type OSD struct {
+	help bool
+
+	free      string
+	freeCheck time.Time
+}
+
+func (o *OSD) ToggleHelp() {
+	o.help = !o.help
+}
+
+// Draw adds the status bar, unless --status-bar is off, and the help if it is shown. activeCam is the
+// index of the shown camera, or -1 in grid view.
+func (o *OSD) Draw(img *gocv.Mat, cameras []*Camera, activeCam int, manifest *Manifest) {
+	if config.StatusBar {
+		o.drawStatus(img, cameras, activeCam, manifest)
+	}
+	if o.help {
+		o.drawHelp(img)
+	}
+}
+
+func (o *OSD) drawStatus(img *gocv.Mat, cameras []*Camera, activeCam int, manifest *Manifest) {
+	shown := cameras
+	view := "grid"
+	if activeCam >= 0 && activeCam < len(cameras) {
+		shown = cameras[activeCam : activeCam+1]
+		view = fmt.Sprintf("Cam %d", shown[0].ID)
+		if shown[0].Name != "" {
+			view += " " + shown[0].Name
+		}
+	}
+	recording, paused, files := false, false, 0
+	for _, cam := range shown {
+		recording = recording || cam.Recording() && !cam.Paused()
+		paused = paused || cam.Recording() && cam.Paused()
+		files = max(files, manifest.fileCount(cam.ID))
+	}
+	state, stateColor := "STOPPED", color.RGBA{R: 200, G: 200, B: 200}
+	switch {
+	case privacy.Load():
+		state = "PRIVACY"
+	case recording:
+		state, stateColor = "REC", color.RGBA{R: 255, G: 40, B: 40}
+	case paused:
+		state, stateColor = "PAUSED", color.RGBA{R: 255, G: 200}
+	}
+
+	now := time.Now()
+	if now.Sub(o.freeCheck) >= osdDiskInterval {
+		o.freeCheck = now
+		o.free = "disk ?"
+		if free, err := freeSpace(activeOutputDir()); err == nil {
+			o.free = fmt.Sprintf("%.1f GB free", float64(free)/1e9)
+		}
+	}
+	elapsed := now.Sub(sessionStart).Truncate(time.Second)
+	text := fmt.Sprintf("%02d:%02d:%02d | %s", int(elapsed.Hours()), int(elapsed.Minutes())%60, int(elapsed.Seconds())%60, view)
+	if files > 0 && segmenting() {
+		text += fmt.Sprintf(" | seg %d", files)
+	} else if files > 0 {
+		text += fmt.Sprintf(" | file %d", files)
+	}
+	text += " | " + o.free + " | h: help"
+
+	// At the bottom, clear of the overlay in its default top-left corner; a note prompt covers it while typing.
+	bar := image.Rect(0, img.Rows()-osdBarHeight, img.Cols(), img.Rows())
+	if err := gocv.Rectangle(img, bar, color.RGBA{}, -1); err != nil {
+		logger.Error(fmt.Sprintf("Error drawing status bar: %v.", err))
+		return
+	}
+	x := 8
+	if state == "REC" {
+		_ = gocv.Circle(img, image.Pt(x+6, img.Rows()-osdBarHeight/2), 6, stateColor, -1)
+		x += 18
+	}
+	white := color.RGBA{R: 255, G: 255, B: 255}
+	_ = gocv.PutText(img, state, image.Pt(x, img.Rows()-7), gocv.FontHersheySimplex, osdScale, stateColor, 1)
+	x += gocv.GetTextSize(state, gocv.FontHersheySimplex, osdScale, 1).X + 12
+	_ = gocv.PutText(img, text, image.Pt(x, img.Rows()-7), gocv.FontHersheySimplex, osdScale, white, 1)
+}
+
+// drawHelp lists the hotkeys on a darkened box in the middle of the preview.
+func (o *OSD) drawHelp(img *gocv.Mat) {
+	width := 0
+	for _, line := range hotkeyHelp {
+		width = max(width, gocv.GetTextSize(line, gocv.FontHersheySimplex, osdScale, 1).X)
+	}
+	box := image.Rect(0, 0, width+24, len(hotkeyHelp)*osdLine+16)
+	box = box.Add(image.Pt(max(0, (img.Cols()-box.Dx())/2), max(0, (img.Rows()-box.Dy())/2)))
+	box = box.Intersect(image.Rect(0, 0, img.Cols(), img.Rows()))
+	if box.Empty() {
+		return
+	}
+	region := img.Region(box)
+	region.MultiplyFloat(0.3)
+	_ = region.Close()
+	for i, line := range hotkeyHelp {
+		pt := image.Pt(box.Min.X+12, box.Min.Y+osdLine*(i+1))
+		_ = gocv.PutText(img, line, pt, gocv.FontHersheySimplex, osdScale, color.RGBA{R: 255, G: 255, B: 255}, 1)
+	}
+}
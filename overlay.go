@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	overlayTopLeft     = "top-left"
+	overlayTopRight    = "top-right"
+	overlayBottomLeft  = "bottom-left"
+	overlayBottomRight = "bottom-right"
+
+	overlayTargetPreview = "preview"
+	overlayTargetFile    = "file"
+	overlayTargetBoth    = "both"
+
+	defaultOverlayFormat = "{label} | {timestamp} | {fps} FPS"
+
+	overlayMargin  = 10
+	overlayPadding = 4
+)
+
+var overlayPositions = []string{overlayTopLeft, overlayTopRight, overlayBottomLeft, overlayBottomRight}
+
+var overlayTargets = []string{overlayTargetPreview, overlayTargetFile, overlayTargetBoth}
+
+var overlayFonts = map[string]gocv.HersheyFont{
+	"plain":   gocv.FontHersheyPlain,
+	"simplex": gocv.FontHersheySimplex,
+	"duplex":  gocv.FontHersheyDuplex,
+	"complex": gocv.FontHersheyComplex,
+	"triplex": gocv.FontHersheyTriplex,
+	"small":   gocv.FontHersheyComplexSmall,
+	"script":  gocv.FontHersheyScriptSimplex,
+}
+
+func validateOverlayFont(s string) error {
+	if _, ok := overlayFonts[s]; !ok {
+		return fmt.Errorf("overlay font must be one of %s", strings.Join(slices.Sorted(maps.Keys(overlayFonts)), ", "))
+	}
+	return nil
+}
+
+func validateOverlayPosition(s string) error {
+	if !slices.Contains(overlayPositions, s) {
+		return fmt.Errorf("overlay position must be one of %s", strings.Join(overlayPositions, ", "))
+	}
+	return nil
+}
+
+func validateOverlayTarget(s string) error {
+	if !slices.Contains(overlayTargets, s) {
+		return fmt.Errorf("overlay target must be one of %s", strings.Join(overlayTargets, ", "))
+	}
+	return nil
+}
+
+// overlayField fills the placeholders of --overlay-format; other names are looked up in --overlay-source.
+func (c *Camera) overlayField(name string) (string, bool) {
+	switch name {
+	case "label":
+		return c.label(), true
+	case "cam_id":
+		return strconv.Itoa(c.ID), true
+	case "timestamp":
+		return clockNow().Format("2006-01-02 15:04:05.000"), true
+	case "date":
+		return clockNow().Format("2006-01-02"), true
+	case "time":
+		return clockNow().Format("15:04:05"), true
+	case "fps":
+		// Until a second of frames has been measured, e.g. in snapshots, the target is shown.
+		fps := c.measuredFPS()
+		if fps == 0 {
+			fps = c.FPS
+		}
+		return strconv.FormatFloat(fps, 'f', 2, 64), true
+	case "target_fps":
+		return strconv.FormatFloat(c.FPS, 'f', 2, 64), true
+	case "n":
+		return strconv.FormatInt(c.framesCaptured.Load(), 10), true
+	}
+	return overlayData.Lookup(name)
+}
+
+// addOverlay draws --overlay-format followed by the --overlay-data, power and GPS lines.
+func (c *Camera) addOverlay(mat *gocv.Mat) {
+	lines := []string{expandTemplate(config.OverlayFormat, c.overlayField)}
+	if config.OverlayData != "" {
+		lines = append(lines, expandTemplate(config.OverlayData, overlayData.Lookup))
+	}
+	if powerMonitoring() {
+		if text := powerOverlayText(); text != "" {
+			lines = append(lines, text)
+		}
+	}
+	if config.GPS != "" {
+		lines = append(lines, gpsOverlayText())
+	}
+
+	col := c.Color
+	if config.OverlayColor != "" {
+		col, _ = parseColor(config.OverlayColor)
+	}
+	drawOverlay(mat, lines, col)
+}
+
+// drawOverlay stacks lines in the --overlay-position corner, on a black box with --overlay-box.
+func drawOverlay(mat *gocv.Mat, lines []string, col color.RGBA) {
+	font := overlayFonts[config.OverlayFont]
+	scale := config.OverlayScale
+	thickness := max(1, int(math.Round(scale*1.5)))
+
+	sizes := make([]image.Point, len(lines))
+	width, lineHeight := 0, 0
+	for i, line := range lines {
+		sizes[i] = gocv.GetTextSize(line, font, scale, thickness)
+		width = max(width, sizes[i].X)
+		lineHeight = max(lineHeight, sizes[i].Y)
+	}
+	lineHeight += 2*overlayPadding + thickness
+
+	y := overlayMargin
+	if config.OverlayPosition == overlayBottomLeft || config.OverlayPosition == overlayBottomRight {
+		y = mat.Rows() - overlayMargin - len(lines)*lineHeight
+	}
+	for i, line := range lines {
+		x := overlayMargin
+		if config.OverlayPosition == overlayTopRight || config.OverlayPosition == overlayBottomRight {
+			x = mat.Cols() - overlayMargin - sizes[i].X
+		}
+		if config.OverlayBox {
+			box := image.Rect(x-overlayPadding, y, x+sizes[i].X+overlayPadding, y+lineHeight)
+			if err := gocv.Rectangle(mat, box, color.RGBA{}, -1); err != nil {
+				logger.Error(fmt.Sprintf("Error adding overlay: %v.", err))
+			}
+		}
+		if err := gocv.PutText(mat, line, image.Pt(x, y+lineHeight-overlayPadding-thickness), font, scale, col, thickness); err != nil {
+			logger.Error(fmt.Sprintf("Error adding overlay: %v.", err))
+		}
+		y += lineHeight
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const overlayPollInterval = time.Second
+
+var placeholderRe = regexp.MustCompile(`\{([A-Za-z0-9_.\-]+)\}`)
+
+// expandTemplate replaces {name} placeholders with lookup(name); unknown names are left as they are.
+func expandTemplate(format string, lookup func(string) (string, bool)) string {
+	return placeholderRe.ReplaceAllStringFunc(format, func(m string) string {
+		if v, ok := lookup(m[1 : len(m)-1]); ok {
+			return v
+		}
+		return m
+	})
+}
+
+// OverlayData holds the fields of the latest record read from --overlay-source.
+type OverlayData struct {
+	mu     sync.RWMutex
+	fields map[string]string
+}
+
+var overlayData = &OverlayData{fields: map[string]string{}}
+
+func (d *OverlayData) Lookup(name string) (string, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	v, ok := d.fields[name]
+	return v, ok
+}
+
+func (d *OverlayData) set(fields map[string]string) {
+	d.mu.Lock()
+	d.fields = fields
+	d.mu.Unlock()
+}
+
+// parseRecord turns one line into template fields: the members of a JSON object (nested keys
+// joined with "."), or key=value pairs. The raw text is always available as {line}.
+func parseRecord(line string) map[string]string {
+	line = strings.TrimSpace(line)
+	fields := map[string]string{"line": line}
+
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err == nil {
+		flattenJSON("", obj, fields)
+		return fields
+	}
+	for _, pair := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' || r == ';' }) {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+func flattenJSON(prefix string, v any, fields map[string]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if prefix != "" {
+				k = prefix + "." + k
+			}
+			flattenJSON(k, child, fields)
+		}
+	case nil:
+		fields[prefix] = ""
+	default:
+		fields[prefix] = fmt.Sprint(v)
+	}
+}
+
+// watchOverlaySource feeds overlayData from source until ctx is cancelled. HTTP(S) URLs and regular
+// files are polled every second (the last line of a file is used); serial ports and pipes are read as a
+// stream of lines.
+func watchOverlaySource(ctx context.Context, source string) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		if fi, err := os.Stat(source); err == nil && fi.Mode()&(os.ModeCharDevice|os.ModeNamedPipe) != 0 {
+			streamOverlaySource(ctx, source)
+			return
+		}
+	}
+
+	ticker := time.NewTicker(overlayPollInterval)
+	defer ticker.Stop()
+	failing := false
+	for {
+		line, err := readOverlaySource(ctx, source)
+		if err != nil {
+			if !failing {
+				logger.Error(fmt.Sprintf("Failed to read overlay source %s: %v.", source, err))
+			}
+		} else {
+			if failing {
+				logger.Info(fmt.Sprintf("Overlay source %s recovered.", source))
+			}
+			overlayData.set(parseRecord(line))
+		}
+		failing = err != nil
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func readOverlaySource(ctx context.Context, source string) (string, error) {
+	var data []byte
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		reqCtx, cancel := context.WithTimeout(ctx, overlayPollInterval)
+		defer cancel()
+		req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, source, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return "", fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err != nil {
+			return "", err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(source); err != nil {
+			return "", err
+		}
+	}
+
+	// A JSON document may span several lines; anything else is a log whose last line is current.
+	data = bytes.TrimSpace(data)
+	if json.Valid(data) {
+		return string(bytes.Join(bytes.Fields(data), []byte(" "))), nil
+	}
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return string(data), nil
+}
+
+// streamOverlaySource reads lines from a device such as a serial port, configured beforehand with stty.
+func streamOverlaySource(ctx context.Context, source string) {
+	for {
+		f, err := os.Open(source)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to open overlay source %s: %v.", source, err))
+		} else {
+			go func() {
+				<-ctx.Done()
+				_ = f.Close()
+			}()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if line := strings.TrimSpace(scanner.Text()); line != "" {
+					overlayData.set(parseRecord(line))
+				}
+			}
+			_ = f.Close()
+			if ctx.Err() == nil {
+				logger.Error(fmt.Sprintf("Overlay source %s closed: %v.", source, scanner.Err()))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(overlayPollInterval):
+		}
+	}
+}
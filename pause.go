@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// Paused reports whether writing is paused while capture and preview continue.
+func (c *Camera) Paused() bool {
+	return c.paused.Load()
+}
+
+// resume continues writing, in the same file or, with --resume-segment, in a new one.
+func (c *Camera) resume() {
+	if !c.paused.Swap(false) {
+		return
+	}
+	if config.ResumeSegment && c.Writer != nil {
+		c.rotateSegment()
+	}
+	logger.Info(fmt.Sprintf("Cam %d recording resumed.", c.ID))
+}
+
+func (c *Camera) pause() {
+	if c.paused.Swap(true) {
+		return
+	}
+	logger.Info(fmt.Sprintf("Cam %d recording paused.", c.ID))
+}
+
+// setPaused pauses or resumes one or all cameras and records the change as a marker, since the paused
+// time is cut from the files' timelines.
+func setPaused(cameras []*Camera, camID int, pause bool, source string, manifest *Manifest) {
+	for _, cam := range cameras {
+		if camID != allCameras && cam.ID != camID {
+			continue
+		}
+		if pause {
+			cam.do(cam.pause)
+		} else {
+			cam.do(cam.resume)
+		}
+	}
+	note := "recording resumed"
+	if pause {
+		note = "recording paused"
+	}
+	manifest.AddMarker(Marker{Time: time.Now(), CamID: camID, Source: source, Note: note})
+}
+
+// drawPaused marks the preview of a paused camera. It is drawn after the frame was handed to the writers.
+func drawPaused(mat *gocv.Mat) {
+	text := "PAUSED"
+	size := gocv.GetTextSize(text, gocv.FontHersheySimplex, 0.8, 2)
+	pt := image.Pt(max(0, mat.Cols()-size.X-10), size.Y+10)
+	if err := gocv.PutText(mat, text, pt, gocv.FontHersheySimplex, 0.8, color.RGBA{R: 255, G: 160}, 2); err != nil {
+		logger.Error(fmt.Sprintf("Error drawing pause state: %v.", err))
+	}
+}
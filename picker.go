@@ -0,0 +1,43 @@
+package main
+
+import "time"
+
+// digitTimeout is how soon a digit must follow the previous one to extend the camera index being typed.
+const digitTimeout = 700 * time.Millisecond
+
+// CameraPicker turns the digit hotkeys into a camera index, so cameras past the ninth are picked by
+// typing their index, e.g. 1 then 2 for 12. Each digit takes effect at once.
+type CameraPicker struct {
+	number int
+	last   time.Time
+}
+
+// Digit adds digit d typed at now and returns the index it picks among n cameras, or -1 for the grid.
+// A digit that would run past the last camera starts a new index.
+func (p *CameraPicker) Digit(d, n int, now time.Time) int {
+	if p.number > 0 && now.Sub(p.last) <= digitTimeout && p.number*10+d < n {
+		p.number = p.number*10 + d
+	} else {
+		p.number = d
+	}
+	p.last = now
+	if p.number >= n {
+		return -1
+	}
+	return p.number
+}
+
+// stepCamera is the camera index step places after active among n cameras, wrapping around;
+// from the grid (-1) it starts at the first or last camera.
+func stepCamera(active, n, step int) int {
+	if n == 0 {
+		return -1
+	}
+	if active < 0 || active >= n {
+		if step > 0 {
+			return 0
+		}
+		return n - 1
+	}
+	return ((active+step)%n + n) % n
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// label is how the camera is shown to people: its configured label, or "Cam N".
+func (c *Camera) label() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("Cam %d", c.ID)
+}
+
+// placeholderFrame renders the tile shown, and optionally recorded, while a camera delivers no frames.
+func (c *Camera) placeholderFrame() gocv.Mat {
+	mat := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(40, 40, 40, 0), c.Height, c.Width, gocv.MatTypeCV8UC3)
+	lastSeen := "no frame received yet"
+	if last := c.lastFrameAt.Load(); last != 0 {
+		lastSeen = "last frame " + time.Unix(0, last).Format("2006-01-02 15:04:05")
+	}
+
+	scale := max(1, float64(c.Width)/640)
+	lines := []struct {
+		text  string
+		scale float64
+		color color.RGBA
+	}{
+		{"NO SIGNAL - " + c.label(), 1.2 * scale, color.RGBA{R: 255, G: 80, B: 80}},
+		{lastSeen, 0.6 * scale, color.RGBA{R: 200, G: 200, B: 200}},
+	}
+	y := c.Height/2 - int(20*scale)
+	for _, l := range lines {
+		size := gocv.GetTextSize(l.text, gocv.FontHersheySimplex, l.scale, 2)
+		pt := image.Pt(max(0, (c.Width-size.X)/2), y)
+		if err := gocv.PutText(&mat, l.text, pt, gocv.FontHersheySimplex, l.scale, l.color, 2); err != nil {
+			logger.Error(fmt.Sprintf("Error drawing placeholder: %v.", err))
+		}
+		y += size.Y + int(20*scale)
+	}
+	return mat
+}
+
+// showPlaceholder replaces the latest frame after a failed read.
+func (c *Camera) showPlaceholder() {
+	mat := c.placeholderFrame()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.latest.Close()
+	c.latest = mat
+}
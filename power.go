@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const powerPollInterval = 10 * time.Second
+
+// PowerStatus is the latest battery and temperature reading; nil fields are not available on this machine.
+type PowerStatus struct {
+	Battery      *int     `json:"battery_percent,omitempty"`
+	Charging     bool     `json:"charging"`
+	TemperatureC *float64 `json:"temperature_c,omitempty"`
+	PowerSaving  bool     `json:"power_saving"`
+}
+
+var (
+	powerStatus atomic.Pointer[PowerStatus]
+	powerSaving atomic.Bool
+)
+
+func powerMonitoring() bool {
+	return config.PowerMonitor || config.BatteryLow > 0 || config.BatteryStop > 0 || config.ThermalLimit > 0 || config.ThermalStop > 0
+}
+
+func powerOverlayText() string {
+	st := powerStatus.Load()
+	if st == nil {
+		return ""
+	}
+	text := ""
+	if st.Battery != nil {
+		text = fmt.Sprintf("BAT %d%%", *st.Battery)
+		if st.Charging {
+			text += "+"
+		}
+	}
+	if st.TemperatureC != nil {
+		if text != "" {
+			text += " | "
+		}
+		text += fmt.Sprintf("%.0f C", *st.TemperatureC)
+	}
+	if st.PowerSaving {
+		text += " | power saving"
+	}
+	return text
+}
+
+// watchPower polls battery and temperature. Past the low thresholds the preview is paused to save
+// power; past the stop thresholds recording is stopped cleanly before the machine shuts down.
+func watchPower(ctx context.Context) {
+	ticker := time.NewTicker(powerPollInterval)
+	defer ticker.Stop()
+	stopping := false
+	for {
+		st := readPowerStatus()
+		onBattery := st.Battery != nil && !st.Charging
+
+		var reasons []string
+		if onBattery && config.BatteryLow > 0 && *st.Battery <= config.BatteryLow {
+			reasons = append(reasons, fmt.Sprintf("battery at %d%%", *st.Battery))
+		}
+		if st.TemperatureC != nil && config.ThermalLimit > 0 && *st.TemperatureC >= config.ThermalLimit {
+			reasons = append(reasons, fmt.Sprintf("temperature at %.0f°C", *st.TemperatureC))
+		}
+		saving := len(reasons) > 0
+		if saving != powerSaving.Swap(saving) {
+			if saving {
+				logger.Warn(fmt.Sprintf("Power saving on, pausing preview: %v.", reasons))
+			} else {
+				logger.Info("Power saving off, resuming preview.")
+			}
+		}
+		st.PowerSaving = saving
+		powerStatus.Store(&st)
+
+		if !stopping {
+			reason := ""
+			if onBattery && config.BatteryStop > 0 && *st.Battery <= config.BatteryStop {
+				reason = fmt.Sprintf("battery at %d%%", *st.Battery)
+			}
+			if st.TemperatureC != nil && config.ThermalStop > 0 && *st.TemperatureC >= config.ThermalStop {
+				reason = fmt.Sprintf("temperature at %.0f°C", *st.TemperatureC)
+			}
+			if reason != "" {
+				logger.Warn(fmt.Sprintf("Stopping recording, %s.", reason))
+				sendCommand(Command{Name: cmdStop, CamID: allCameras, Source: "power"})
+				stopping = true
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
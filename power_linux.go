@@ -0,0 +1,49 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func readSysfsInt(path string) (int, bool) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	return v, err == nil
+}
+
+// readPowerStatus reads the first battery and the hottest thermal zone from sysfs.
+func readPowerStatus() PowerStatus {
+	var st PowerStatus
+	batteries, _ := filepath.Glob("/sys/class/power_supply/*/capacity")
+	for _, capacity := range batteries {
+		dir := filepath.Dir(capacity)
+		if t, _ := os.ReadFile(filepath.Join(dir, "type")); strings.TrimSpace(string(t)) != "Battery" {
+			continue
+		}
+		if v, ok := readSysfsInt(capacity); ok {
+			st.Battery = &v
+			status, _ := os.ReadFile(filepath.Join(dir, "status"))
+			st.Charging = strings.TrimSpace(string(status)) != "Discharging"
+			break
+		}
+	}
+
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
+	for _, zone := range zones {
+		milli, ok := readSysfsInt(zone)
+		if !ok {
+			continue
+		}
+		if c := float64(milli) / 1000; st.TemperatureC == nil || c > *st.TemperatureC {
+			st.TemperatureC = &c
+		}
+	}
+	return st
+}
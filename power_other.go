@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// readPowerStatus is only implemented on Linux, where battery and thermal zones are exposed in sysfs.
+func readPowerStatus() PowerStatus {
+	return PowerStatus{}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync/atomic"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// privacy is set while all output is blanked. Cameras check it before processing each frame, so
+// nothing captured after it is set reaches a file, stream or preview.
+var privacy atomic.Bool
+
+// setPrivacy blanks or unblanks every camera. Blanking also stops and finalizes all recordings; they
+// are not restarted when the blank is lifted. Both are recorded as markers.
+func setPrivacy(cameras []*Camera, on bool, source string, manifest *Manifest) {
+	if privacy.Swap(on) == on {
+		return
+	}
+	note := "privacy blank lifted, recording stays stopped"
+	if on {
+		note = "privacy blank: recording stopped, previews blanked"
+		for _, cam := range cameras {
+			cam.showPrivacy()
+			cam.do(cam.stopRecording)
+		}
+	}
+	logger.Warn(fmt.Sprintf("%s (%s).", note, source))
+	manifest.AddMarker(Marker{Time: time.Now(), CamID: allCameras, Source: source, Note: note})
+}
+
+// showPrivacy replaces the latest frame with the blank shown while privacy is on.
+func (c *Camera) showPrivacy() {
+	mat := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), c.Height, c.Width, gocv.MatTypeCV8UC3)
+	scale := max(1, float64(c.Width)/640)
+	for i, text := range []string{"PRIVACY", "recording stopped"} {
+		s := scale * (1.2 - 0.6*float64(i))
+		size := gocv.GetTextSize(text, gocv.FontHersheySimplex, s, 2)
+		pt := image.Pt(max(0, (c.Width-size.X)/2), c.Height/2+int(40*scale)*i)
+		if err := gocv.PutText(&mat, text, pt, gocv.FontHersheySimplex, s, color.RGBA{R: 255, G: 255, B: 255}, 2); err != nil {
+			logger.Error(fmt.Sprintf("Error drawing privacy blank: %v.", err))
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.latest.Close()
+	c.latest = mat
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ptzNudge is how long a PTZ hotkey moves the camera; holding the key keeps it moving.
+const ptzNudge = 400 * time.Millisecond
+
+// ptzSpeed is the velocity, as a fraction of the maximum, used by the PTZ hotkeys.
+const ptzSpeed = 0.5
+
+type PTZPreset struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+}
+
+// PTZ drives an ONVIF pan/tilt/zoom camera. The device is contacted on first use and requests are
+// serialized, so it is safe to call from the UI loop (through goroutines) and the API at the same time.
+type PTZ struct {
+	camID  int
+	client *ONVIFClient
+
+	tracking    atomic.Bool
+	manualUntil atomic.Int64
+
+	mu        sync.Mutex
+	ptzURL    string
+	profile   string
+	stopTimer *time.Timer
+}
+
+func newPTZ(camID int, rawURL string) (*PTZ, error) {
+	client, err := newONVIFClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	p := &PTZ{camID: camID, client: client}
+	p.tracking.Store(config.PTZTrack)
+	return p, nil
+}
+
+// Tracking reports whether follow mode is on.
+func (p *PTZ) Tracking() bool {
+	return p.tracking.Load()
+}
+
+func (p *PTZ) SetTracking(on bool) {
+	p.tracking.Store(on)
+	state := "OFF"
+	if on {
+		state = "ON"
+	}
+	logger.Info(fmt.Sprintf("Cam %d PTZ tracking: %s.", p.camID, state))
+}
+
+// manual makes follow mode yield to an operator's PTZ command for ptzManualHold.
+func (p *PTZ) manual() {
+	p.manualUntil.Store(time.Now().Add(ptzManualHold).UnixNano())
+}
+
+func (p *PTZ) overridden() bool {
+	return time.Now().UnixNano() < p.manualUntil.Load()
+}
+
+// connect looks up the PTZ service and profile once. It must be called with p.mu held.
+func (p *PTZ) connect() error {
+	if p.profile != "" {
+		return nil
+	}
+	media, ptzURL, err := p.client.services()
+	if err != nil {
+		return err
+	}
+	profile, err := p.client.ptzProfile(media)
+	if err != nil {
+		return err
+	}
+	p.ptzURL, p.profile = ptzURL, profile
+	logger.Info(fmt.Sprintf("Cam %d PTZ connected, profile %s.", p.camID, profile))
+	return nil
+}
+
+// Move starts a continuous move with pan, tilt and zoom velocities in [-1, 1]. If d is positive the
+// camera stops after d; otherwise it keeps moving until Stop.
+func (p *PTZ) Move(pan, tilt, zoom float64, d time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(); err != nil {
+		return err
+	}
+	body := fmt.Sprintf(`<ContinuousMove xmlns="%s"><ProfileToken>%s</ProfileToken><Velocity>`+
+		`<PanTilt x="%.3f" y="%.3f" xmlns="%s"/><Zoom x="%.3f" xmlns="%s"/></Velocity></ContinuousMove>`,
+		onvifPTZNS, xmlEscape(p.profile), pan, tilt, onvifSchemaNS, zoom, onvifSchemaNS)
+	if err := p.client.call(p.ptzURL, body, nil); err != nil {
+		return err
+	}
+	if p.stopTimer != nil {
+		p.stopTimer.Stop()
+		p.stopTimer = nil
+	}
+	if d > 0 {
+		p.stopTimer = time.AfterFunc(d, func() {
+			if err := p.Stop(); err != nil {
+				logger.Error(fmt.Sprintf("Cam %d PTZ stop failed: %v.", p.camID, err))
+			}
+		})
+	}
+	return nil
+}
+
+func (p *PTZ) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(); err != nil {
+		return err
+	}
+	body := fmt.Sprintf(`<Stop xmlns="%s"><ProfileToken>%s</ProfileToken><PanTilt>true</PanTilt><Zoom>true</Zoom></Stop>`,
+		onvifPTZNS, xmlEscape(p.profile))
+	return p.client.call(p.ptzURL, body, nil)
+}
+
+func (p *PTZ) Presets() ([]PTZPreset, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Presets []struct {
+			Token string `xml:"token,attr"`
+			Name  string `xml:"Name"`
+		} `xml:"Preset"`
+	}
+	body := fmt.Sprintf(`<GetPresets xmlns="%s"><ProfileToken>%s</ProfileToken></GetPresets>`, onvifPTZNS, xmlEscape(p.profile))
+	if err := p.client.call(p.ptzURL, body, &resp); err != nil {
+		return nil, err
+	}
+	presets := make([]PTZPreset, 0, len(resp.Presets))
+	for _, pr := range resp.Presets {
+		presets = append(presets, PTZPreset{Token: pr.Token, Name: pr.Name})
+	}
+	return presets, nil
+}
+
+// GotoPreset recalls the preset whose token or name is preset.
+func (p *PTZ) GotoPreset(preset string) error {
+	presets, err := p.Presets()
+	if err != nil {
+		return err
+	}
+	for _, pr := range presets {
+		if pr.Token == preset || pr.Name == preset {
+			p.manual()
+			return p.gotoToken(pr.Token)
+		}
+	}
+	return fmt.Errorf("preset %q not found", preset)
+}
+
+// GotoPresetIndex recalls the n-th preset (1-based) in the order the camera lists them.
+func (p *PTZ) GotoPresetIndex(n int) error {
+	presets, err := p.Presets()
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > len(presets) {
+		return fmt.Errorf("camera has %d presets, no preset %d", len(presets), n)
+	}
+	p.manual()
+	return p.gotoToken(presets[n-1].Token)
+}
+
+func (p *PTZ) gotoToken(token string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	body := fmt.Sprintf(`<GotoPreset xmlns="%s"><ProfileToken>%s</ProfileToken><PresetToken>%s</PresetToken></GotoPreset>`,
+		onvifPTZNS, xmlEscape(p.profile), xmlEscape(token))
+	return p.client.call(p.ptzURL, body, nil)
+}
+
+// ptzKeys maps PTZ hotkeys to pan, tilt and zoom directions.
+var ptzKeys = map[int][3]float64{
+	'j': {-1, 0, 0},
+	'l': {1, 0, 0},
+	'i': {0, 1, 0},
+	'k': {0, -1, 0},
+	'+': {0, 0, 1},
+	'=': {0, 0, 1},
+	'-': {0, 0, -1},
+}
+
+// handleKey runs a PTZ hotkey in the background so the preview never waits for the camera.
+// It reports whether key was a PTZ key.
+func (p *PTZ) handleKey(key int) bool {
+	var action func() error
+	if dir, ok := ptzKeys[key]; ok {
+		action = func() error { return p.Move(dir[0]*ptzSpeed, dir[1]*ptzSpeed, dir[2]*ptzSpeed, ptzNudge) }
+	} else if key == ' ' {
+		action = p.Stop
+	} else if key == 't' || key == 'T' {
+		p.SetTracking(!p.Tracking())
+		return true
+	} else {
+		return false
+	}
+	p.manual()
+	go func() {
+		if err := action(); err != nil {
+			logger.Error(fmt.Sprintf("Cam %d PTZ: %v.", p.camID, err))
+		}
+	}()
+	return true
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	qualityWidth  = 320
+	qualitySample = 5 * time.Second
+	// qualityBaseline is how many samples, taken once the camera has settled, make up the session baseline.
+	qualityBaseline = 12
+	qualitySettle   = 2
+	// qualitySustain is how many samples in a row must be degraded, or fine again, before the state changes.
+	qualitySustain = 3
+
+	clipDark   = 5
+	clipBright = 250
+)
+
+// QualityScore is one sample of a camera's image quality.
+type QualityScore struct {
+	// Sharpness is the variance of the Laplacian; it falls when the lens fogs up or goes out of focus.
+	Sharpness float64 `json:"sharpness"`
+	// Noise is the mean difference from a median-filtered copy.
+	Noise float64 `json:"noise"`
+	// Clipped is the fraction of pixels that are pure black or white.
+	Clipped float64 `json:"clipped"`
+}
+
+type QualityReport struct {
+	Current  QualityScore  `json:"current"`
+	Baseline *QualityScore `json:"baseline,omitempty"`
+	Degraded []string      `json:"degraded,omitempty"`
+}
+
+// QualityMonitor scores a camera's frames every qualitySample and compares them with a baseline taken
+// at the start of the session.
+type QualityMonitor struct {
+	next     time.Time
+	samples  int
+	sum      QualityScore
+	baseline QualityScore
+	streak   int
+	degraded []string
+
+	report atomic.Pointer[QualityReport]
+}
+
+func validateQualityAlert(f float64) error {
+	if f < 0 || f > 100 {
+		return errors.New("quality alert must be between 0 and 100")
+	}
+	return nil
+}
+
+func measureQuality(frame gocv.Mat) QualityScore {
+	grey := gocv.NewMat()
+	defer grey.Close()
+	height := max(1, frame.Rows()*qualityWidth/max(1, frame.Cols()))
+	_ = gocv.Resize(frame, &grey, image.Pt(qualityWidth, height), 0, 0, gocv.InterpolationArea)
+	_ = gocv.CvtColor(grey, &grey, gocv.ColorBGRToGray)
+
+	lap, mean, stddev := gocv.NewMat(), gocv.NewMat(), gocv.NewMat()
+	defer lap.Close()
+	defer mean.Close()
+	defer stddev.Close()
+	_ = gocv.Laplacian(grey, &lap, gocv.MatTypeCV64F, 1, 1, 0, gocv.BorderDefault)
+	_ = gocv.MeanStdDev(lap, &mean, &stddev)
+	sd := stddev.GetDoubleAt(0, 0)
+
+	median, residual := gocv.NewMat(), gocv.NewMat()
+	defer median.Close()
+	defer residual.Close()
+	_ = gocv.MedianBlur(grey, &median, 3)
+	_ = gocv.AbsDiff(grey, median, &residual)
+
+	mask := gocv.NewMat()
+	defer mask.Close()
+	gocv.Threshold(grey, &mask, clipDark, 255, gocv.ThresholdBinaryInv)
+	clipped := gocv.CountNonZero(mask)
+	gocv.Threshold(grey, &mask, clipBright-1, 255, gocv.ThresholdBinary)
+	clipped += gocv.CountNonZero(mask)
+
+	return QualityScore{
+		Sharpness: sd * sd,
+		Noise:     residual.Mean().Val1,
+		Clipped:   float64(clipped) / float64(max(1, grey.Rows()*grey.Cols())),
+	}
+}
+
+// Sample scores frame if a sample is due. It returns the degraded metrics and true when the camera has
+// just degraded or recovered.
+func (q *QualityMonitor) Sample(frame gocv.Mat, at time.Time) ([]string, bool) {
+	if at.Before(q.next) {
+		return nil, false
+	}
+	q.next = at.Add(qualitySample)
+	score := measureQuality(frame)
+	q.samples++
+
+	if q.samples <= qualitySettle+qualityBaseline {
+		if q.samples > qualitySettle {
+			q.sum.Sharpness += score.Sharpness
+			q.sum.Noise += score.Noise
+			q.sum.Clipped += score.Clipped
+		}
+		report := &QualityReport{Current: score}
+		if q.samples == qualitySettle+qualityBaseline {
+			q.baseline = QualityScore{q.sum.Sharpness / qualityBaseline, q.sum.Noise / qualityBaseline, q.sum.Clipped / qualityBaseline}
+			report.Baseline = &q.baseline
+		}
+		q.report.Store(report)
+		return nil, false
+	}
+
+	degraded := q.baseline.compare(score, config.QualityAlert/100)
+	if (len(degraded) > 0) == (len(q.degraded) > 0) {
+		q.streak = 0
+		if len(degraded) > 0 {
+			q.degraded = degraded
+		}
+	} else {
+		q.streak++
+	}
+	changed := q.streak >= qualitySustain
+	if changed {
+		q.degraded, q.streak = degraded, 0
+	}
+	q.report.Store(&QualityReport{Current: score, Baseline: &q.baseline, Degraded: q.degraded})
+	return degraded, changed
+}
+
+// compare lists the metrics of score that are worse than the baseline by more than the fraction drop.
+func (b QualityScore) compare(score QualityScore, drop float64) []string {
+	var worse []string
+	if score.Sharpness < b.Sharpness*(1-drop) {
+		worse = append(worse, fmt.Sprintf("sharpness down %.0f%%", 100*(1-score.Sharpness/max(b.Sharpness, 1e-9))))
+	}
+	// A floor keeps a very clean baseline from flagging ordinary sensor noise.
+	if score.Noise > max(b.Noise, 1)*(1+drop) {
+		worse = append(worse, fmt.Sprintf("noise up %.0f%%", 100*(score.Noise/max(b.Noise, 1)-1)))
+	}
+	if score.Clipped > b.Clipped+drop {
+		worse = append(worse, fmt.Sprintf("%.0f%% of the image clipped", 100*score.Clipped))
+	}
+	return worse
+}
+
+// Report returns the latest sample, or nil before the first one.
+func (q *QualityMonitor) Report() *QualityReport {
+	return q.report.Load()
+}
+
+// checkQuality warns and adds a marker when the camera's picture degrades from its baseline or recovers.
+func (c *Camera) checkQuality(mat gocv.Mat, at time.Time) {
+	degraded, changed := c.quality.Sample(mat, at)
+	if !changed {
+		return
+	}
+	note := "image quality back to baseline"
+	if len(degraded) > 0 {
+		note = "image quality degraded: " + strings.Join(degraded, ", ")
+		logger.Warn(fmt.Sprintf("Cam %d %s.", c.ID, note))
+	} else {
+		logger.Info(fmt.Sprintf("Cam %d %s.", c.ID, note))
+	}
+	if c.manifest != nil {
+		c.manifest.AddMarker(Marker{Time: at, CamID: c.ID, Source: "quality", Note: note})
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	quorumAll = "all"
+	quorumAny = "any"
+)
+
+var errQuorum = errors.New("quorum must be all, any, a number of cameras or a list of camera IDs and labels")
+
+func validateQuorum(s string) error {
+	if s == quorumAll || s == quorumAny {
+		return nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 {
+			return errQuorum
+		}
+		return nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		if strings.TrimSpace(name) == "" {
+			return errQuorum
+		}
+	}
+	return nil
+}
+
+// cameraRef identifies a camera that is up, for --quorum lists of IDs and labels.
+type cameraRef struct {
+	id    int
+	label string
+}
+
+func (r cameraRef) is(name string) bool {
+	return name == strconv.Itoa(r.id) || r.label != "" && name == r.label
+}
+
+// quorumShortfall explains why the cameras that are up, out of total wanted, do not meet the --quorum
+// policy, or returns "" if they do.
+func quorumShortfall(policy string, up []cameraRef, total int) string {
+	switch policy {
+	case quorumAll:
+		if len(up) < total {
+			return fmt.Sprintf("%d of %d cameras are up", len(up), total)
+		}
+		return ""
+	case quorumAny:
+		if len(up) == 0 {
+			return "no camera is up"
+		}
+		return ""
+	}
+	if n, err := strconv.Atoi(policy); err == nil {
+		if len(up) < n {
+			return fmt.Sprintf("%d of %d required cameras are up", len(up), n)
+		}
+		return ""
+	}
+	var missing []string
+	for _, name := range strings.Split(policy, ",") {
+		name = strings.TrimSpace(name)
+		if !slices.ContainsFunc(up, func(r cameraRef) bool { return r.is(name) }) {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return "missing " + strings.Join(missing, ", ")
+	}
+	return ""
+}
+
+// discard closes a camera that is not going to record after all and deletes the files it created.
+func (c *Camera) discard() {
+	files := []string{c.TimelapseFilename}
+	if c.Filename != "" {
+		base := strings.TrimSuffix(c.Filename, filepath.Ext(c.Filename))
+		files = append(files, c.Filename, base+".timestamps.csv", base+".srt")
+	}
+	if c.FrameLog != nil {
+		files = append(files, c.FrameLog.file.Name())
+	}
+	c.Close()
+	for _, f := range files {
+		if f != "" {
+			_ = os.Remove(f)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	// maxWriteFailures consecutive write errors mark the current file as broken.
+	maxWriteFailures    = 5
+	writerRetryInterval = 5 * time.Second
+)
+
+// uniquePath appends _1, _2, ... to the file name if path already exists.
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// FrameWriter encodes frames into a recording; it is a *gocv.VideoWriter or an FFmpegWriter, see --writer.
+type FrameWriter interface {
+	Write(img gocv.Mat) error
+	Close() error
+}
+
+// setRecordSize sets the size of the recordings from a --record-size value, keeping the capture size
+// when there is none or it is not smaller.
+func (c *Camera) setRecordSize(size string) {
+	c.RecordWidth, c.RecordHeight = c.Width, c.Height
+	if size == "" {
+		return
+	}
+	w, h, _ := parseSize(size)
+	if w > c.Width || h > c.Height || w == c.Width && h == c.Height {
+		logger.Info(fmt.Sprintf("Cam %d records at its capture size %dx%d, the record size %s is not smaller.", c.ID, c.Width, c.Height, size))
+		return
+	}
+	c.RecordWidth, c.RecordHeight = w, h
+	logger.Info(fmt.Sprintf("Cam %d captures at %dx%d and records at %dx%d.", c.ID, c.Width, c.Height, w, h))
+}
+
+func (c *Camera) scalesRecording() bool {
+	return c.RecordWidth != c.Width || c.RecordHeight != c.Height
+}
+
+// scaleForRecording scales mat down to the record size into dst with area interpolation, which
+// averages the pixels each output pixel covers and so keeps fine detail without aliasing.
+func (c *Camera) scaleForRecording(dst *gocv.Mat, mat gocv.Mat) {
+	if err := gocv.Resize(mat, dst, image.Pt(c.RecordWidth, c.RecordHeight), 0, 0, gocv.InterpolationArea); err != nil {
+		logger.Error(fmt.Sprintf("Failed to scale cam %d for recording: %v.", c.ID, err))
+	}
+}
+
+// fileStem is the camera's label, or camera_<id>, used to name its output files.
+func (c *Camera) fileStem() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("camera_%d", c.ID)
+}
+
+func (c *Camera) openWriter() error {
+	now := time.Now()
+	root := activeOutputDir()
+	filename := filepath.Join(root, c.recordingName(now, c.fileIndex+1))
+	if c.Lossless != "" {
+		filename = losslessPath(filename, c.Lossless)
+	}
+	filename = uniquePath(filename)
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+		return fmt.Errorf("could not create directory for camera %d: %w", c.ID, err)
+	}
+	var writer FrameWriter
+	var err error
+	if c.Lossless == "" && c.Audio != "" && c.Audio != audioDisabled {
+		writer, err = newFFmpegWriter(filename, c.Codec, c.FPS, c.RecordWidth, c.RecordHeight, audioSource(c.Audio))
+	} else {
+		writer, err = c.newFileWriter(filename)
+	}
+	if err != nil {
+		return fmt.Errorf("could not open writer for camera %d: %w", c.ID, err)
+	}
+	sidecars := &fileSidecars{}
+	if config.Timestamps != "" {
+		if sidecars.stamps, err = newTimestampLog(filename, c.FPS, sessionStart); err != nil {
+			logger.Error(fmt.Sprintf("Failed to create timestamp sidecar for camera %d: %v.", c.ID, err))
+		}
+	}
+	if c.Lossless != "" {
+		if sidecars.index, err = newFrameIndex(filename, c.Lossless, sessionStart); err != nil {
+			logger.Error(fmt.Sprintf("Failed to create frame index for camera %d: %v.", c.ID, err))
+		}
+	}
+	if config.WriteQueue > 0 {
+		writer = newQueuedWriter(writer, config.WriteQueue,
+			func(at time.Time) { c.frameWritten(sidecars, at) },
+			c.writeFailed,
+			func() { c.queueDropped.Add(1) })
+	}
+	c.mu.Lock()
+	c.Writer = writer
+	c.Filename = filename
+	c.mu.Unlock()
+	c.sidecars = sidecars
+	c.outputRoot = root
+	c.fileIndex++
+	c.recording.Store(true)
+	if segmenting() {
+		c.segment++
+		c.segmentStart = now
+	}
+	return nil
+}
+
+// newFileWriter opens a silent writer for one of the camera's recordings at filename: its --lossless
+// format, or its codec with the --writer backend and the camera's encoder.
+func (c *Camera) newFileWriter(filename string) (FrameWriter, error) {
+	if c.Lossless != "" {
+		return openLosslessWriter(filename, c.Lossless, c.FPS, c.RecordWidth, c.RecordHeight)
+	}
+	if config.Writer == writerFFmpeg {
+		return newFFmpegWriter(filename, c.Codec, c.FPS, c.RecordWidth, c.RecordHeight, nil)
+	}
+	return openVideoWriter(filename, c.Codec, c.Encoder, c.HWDevice, c.FPS, c.RecordWidth, c.RecordHeight)
+}
+
+func (c *Camera) closeWriter() {
+	c.recording.Store(false)
+	c.mu.Lock()
+	writer := c.Writer
+	c.Writer = nil
+	c.mu.Unlock()
+	sidecars := c.sidecars
+	c.sidecars = nil
+	if writer == nil {
+		return
+	}
+	if err := writer.Close(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to close writer for cam %d: %v.", c.ID, err))
+	}
+	c.finishFile(sidecars, c.Filename)
+	storeSidecars(c.Filename)
+}
+
+// fileSidecars list the frames written to one file: the --timestamps sidecar, the --lossless frame
+// index and the timing for the manifest. Behind a write queue only its encoding goroutine touches
+// them until the file is closed.
+type fileSidecars struct {
+	stamps *TimestampLog
+	index  *FrameIndex
+	timing fileTiming
+}
+
+// finishFile closes the sidecars of filename once its writer is closed and lists its timing in the manifest.
+func (c *Camera) finishFile(sidecars *fileSidecars, filename string) {
+	if sidecars == nil {
+		return
+	}
+	c.endFileTiming(sidecars.timing, filename)
+	sidecars.stamps.Close()
+	sidecars.index.Close()
+}
+
+// writeFrame writes mat, captured at, to the current file. Behind a write queue the queue takes mat
+// without a copy, calls release with it once encoded and writeFrame reports true; the caller must
+// not otherwise give mat back or change it. With a nil release the queue takes a clone instead.
+func (c *Camera) writeFrame(mat gocv.Mat, at time.Time, release func(gocv.Mat)) bool {
+	if q, ok := c.Writer.(*QueuedWriter); ok {
+		q.Enqueue(mat, at, release)
+		return release != nil
+	}
+	if err := c.Writer.Write(mat); err != nil {
+		c.writeFailed(err, at)
+		return false
+	}
+	c.frameWritten(c.sidecars, at)
+	return false
+}
+
+// frameWritten books a frame once it is in the file.
+func (c *Camera) frameWritten(sidecars *fileSidecars, at time.Time) {
+	sidecars.stamps.Record(at)
+	sidecars.index.Record(at)
+	sidecars.timing.Record(at)
+	c.writeFailures.Store(0)
+	c.lastWriteAt.Store(time.Now().UnixNano())
+	c.framesWritten.Add(1)
+}
+
+// writeFailed books a frame the writer failed on; the capture loop rolls a file over after
+// maxWriteFailures in a row.
+func (c *Camera) writeFailed(err error, at time.Time) {
+	telemetry.add(metricWriteErrors, c.ID, 1)
+	c.writeErrors.Add(1)
+	if c.writeFailures.Add(1) == 1 {
+		logger.Error(fmt.Sprintf("Failed to write camera %d frame captured at %s: %v.", c.ID, at.Format("15:04:05.000"), err))
+	}
+}
+
+// framesQueued is how many frames wait in the camera's write queue, to be written yet.
+func (c *Camera) framesQueued() int64 {
+	if q, ok := c.Writer.(*QueuedWriter); ok {
+		return q.Pending()
+	}
+	return 0
+}
+
+// rolloverWriter replaces a writer that keeps failing, or whose directory was failed over, with a fresh file. If that cannot be
+// opened either, the camera stays in recording state and retries after writerRetryInterval.
+func (c *Camera) rolloverWriter() {
+	if c.Writer != nil {
+		if n := c.writeFailures.Load(); n > 0 {
+			logger.Warn(fmt.Sprintf("Cam %d: %d consecutive write errors, closing %s.", c.ID, n, c.Filename))
+		}
+		c.closeWriter()
+	}
+	c.writeFailures.Store(0)
+	c.recording.Store(true)
+	checkOutputDir(c.manifest)
+	if err := c.openWriter(); err != nil {
+		c.writerRetryAt = time.Now().Add(writerRetryInterval)
+		logger.Error(fmt.Sprintf("%v, retrying in %v.", err, writerRetryInterval))
+		return
+	}
+	if c.manifest != nil {
+		c.manifest.AddFile(c.ID, c.Filename)
+	}
+	logger.Info(fmt.Sprintf("Cam %d rolled over to %s.", c.ID, c.Filename))
+}
+
+func (c *Camera) Recording() bool {
+	return c.recording.Load()
+}
+
+// startRecording opens a new file for a camera whose writer was stopped.
+func (c *Camera) startRecording(manifest *Manifest) {
+	if c.Recording() {
+		return
+	}
+	if config.Preview {
+		logger.Warn(fmt.Sprintf("Cam %d is in preview, not recording.", c.ID))
+		return
+	}
+	if err := c.openWriter(); err != nil {
+		logger.Error(err.Error())
+		return
+	}
+	manifest.AddFile(c.ID, c.Filename)
+	logger.Info(fmt.Sprintf("Cam %d recording started, writing to %s.", c.ID, c.Filename))
+}
+
+// stopRecording finalizes the current file while capture and preview continue.
+func (c *Camera) stopRecording() {
+	c.gapPaused = false
+	if !c.Recording() {
+		return
+	}
+	c.closeWriter()
+	logger.Info(fmt.Sprintf("Cam %d recording stopped, finalized %s.", c.ID, c.Filename))
+}
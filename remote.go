@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// uploadAttempts is how often a request to a remote storage is tried before the recording fails.
+	uploadAttempts = 3
+	uploadRetry    = 2 * time.Second
+)
+
+// Storage is where recordings go, see --storage: the local disk, an S3 bucket or a WebDAV server.
+// Writers stream into it while they encode, so a remote storage needs no disk on the device.
+type Storage interface {
+	// Create opens name, a slash separated path relative to the storage root, for writing. The object
+	// is complete once the writer is closed without error.
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+	String() string
+}
+
+var storage Storage = LocalStorage{}
+
+func validateStorage(s string) error {
+	_, err := newStorage(s)
+	return err
+}
+
+// newStorage opens the --storage URL: file:// or empty for the local disk, s3://bucket/prefix, or
+// webdav:// and webdavs:// for a WebDAV server over http and https.
+func newStorage(s string) (Storage, error) {
+	if s == "" {
+		return LocalStorage{}, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL %q: %w", s, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Host != "" || strings.Trim(u.Path, "/") != "" {
+			return nil, errors.New("file storage writes to --output-dir, set that to choose the directory")
+		}
+		return LocalStorage{}, nil
+	case "s3":
+		return newS3Storage(u)
+	case "webdav", "webdavs":
+		return newWebDAVStorage(u)
+	}
+	return nil, errors.New("storage must be a file://, s3:// or webdav(s):// URL")
+}
+
+// remoteStorage reports whether --storage sends the recordings to S3 or WebDAV instead of the local disk.
+func remoteStorage() bool {
+	return config.Storage != "" && !strings.HasPrefix(config.Storage, "file:")
+}
+
+// openStorage opens --storage for the session.
+func openStorage() error {
+	s, err := newStorage(config.Storage)
+	if err != nil {
+		return err
+	}
+	storage = s
+	if remoteStorage() {
+		logger.Info(fmt.Sprintf("Streaming recordings to %s.", s))
+	}
+	return nil
+}
+
+// LocalStorage is the local disk, with names relative to the active output directory.
+type LocalStorage struct{}
+
+func (LocalStorage) Create(_ context.Context, name string) (io.WriteCloser, error) {
+	p := filepath.Join(activeOutputDir(), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(p)
+}
+
+func (LocalStorage) String() string {
+	return "file://" + activeOutputDir()
+}
+
+// createOutput creates filename, a file under the output directory, through the storage: on the
+// local disk it is that file, with --storage the object of the same relative name.
+func createOutput(filename string) (io.WriteCloser, error) {
+	return storage.Create(context.Background(), storageName(filename))
+}
+
+// storageName is filename relative to the output directory it belongs to, which the storage mirrors.
+func storageName(filename string) string {
+	for _, dir := range []string{activeOutputDir(), config.OutputDir, config.FallbackDir} {
+		if dir == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, filename); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(filename)
+}
+
+// streamingFormats are the containers ffmpeg can write to a pipe, with the arguments doing so: mp4
+// and mov go out as fragments since their index cannot be written back at the start.
+var streamingFormats = map[string][]string{
+	"mp4":  {"-f", "mp4", "-movflags", "frag_keyframe+empty_moov+default_base_moof"},
+	"mov":  {"-f", "mov", "-movflags", "frag_keyframe+empty_moov+default_base_moof"},
+	"mkv":  {"-f", "matroska"},
+	"webm": {"-f", "webm"},
+}
+
+// checkStorage makes sure the recordings can be streamed to a remote --storage.
+func checkStorage() error {
+	if !remoteStorage() {
+		return nil
+	}
+	if _, ok := streamingFormats[config.Container]; !ok {
+		return fmt.Errorf("--storage streams recordings and needs a mp4, mov, mkv or webm container, not %s", config.Container)
+	}
+	if losslessUsed(losslessHuffYUV) {
+		return errors.New("--storage cannot stream huffyuv, which is written to avi; use --lossless ffv1 or png")
+	}
+	if losslessUsed(losslessPNG) && config.WriteQueue <= 0 {
+		// Every frame is a request of its own, which must not hold up the capture loop.
+		return errors.New("--storage uploads --lossless png frames one by one and needs a --write-queue")
+	}
+	return nil
+}
+
+// losslessUsed reports whether --lossless or a camera's lossless setting is mode.
+func losslessUsed(mode string) bool {
+	return config.Lossless == mode || slices.ContainsFunc(config.Cameras, func(c CameraConfig) bool { return c.Lossless == mode })
+}
+
+// storeSidecars moves the sidecars of a finished recording into a remote storage. They are small and
+// written to the output directory while the recording itself streams. It is a no-op on the local disk.
+func storeSidecars(filename string) {
+	if !remoteStorage() {
+		return
+	}
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	files := []string{filepath.Join(filename, "index.csv")}
+	for _, sidecar := range []string{".timestamps.csv", ".srt", ".index.csv", ".json"} {
+		files = append(files, base+sidecar)
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			continue
+		}
+		if err := storeFile(f); err != nil {
+			logger.Error(fmt.Sprintf("Failed to store %s in %s, keeping it on disk: %v.", f, storage, err))
+			continue
+		}
+		_ = os.Remove(f)
+	}
+	// The directory of a png sequence, whose frames went to the storage, is empty now.
+	_ = os.Remove(filename)
+}
+
+// storeManifest copies the session manifest, which stays on the local disk while it is updated, to a
+// remote storage once the session has ended.
+func storeManifest(manifest *Manifest) {
+	if !remoteStorage() || config.Preview {
+		return
+	}
+	if err := storeFile(manifest.path); err != nil {
+		logger.Error(fmt.Sprintf("Failed to store %s in %s: %v.", manifest.path, storage, err))
+	}
+}
+
+// storeFile copies the local file filename to the storage object of the same relative name.
+func storeFile(filename string) error {
+	return withRetries(func() error {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w, err := createOutput(filename)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, f); err != nil {
+			_ = w.Close()
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// withRetries runs a request to a remote storage, trying it uploadAttempts times.
+func withRetries(request func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := request()
+		if err == nil || attempt == uploadAttempts {
+			return err
+		}
+		logger.Warn(fmt.Sprintf("Storage request failed (%v), retrying in %v.", err, uploadRetry))
+		time.Sleep(uploadRetry)
+	}
+}
+
+// countingWriter counts the bytes written through it, for --segment-size of streamed recordings.
+type countingWriter struct {
+	io.WriteCloser
+	n atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.n.Add(int64(n))
+	return n, err
+}
+
+// joinKey joins a storage prefix and a name into a slash separated key.
+func joinKey(prefix, name string) string {
+	return strings.TrimPrefix(path.Join(prefix, name), "/")
+}
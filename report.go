@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// RunReport sums up a recording run per camera when it ends.
+type RunReport struct {
+	SessionID string         `json:"session_id"`
+	StartedAt time.Time      `json:"started_at"`
+	EndedAt   time.Time      `json:"ended_at"`
+	Duration  float64        `json:"duration_s"`
+	Cameras   []CameraReport `json:"cameras"`
+}
+
+type CameraReport struct {
+	ID    int    `json:"id"`
+	Label string `json:"label,omitempty"`
+	// Captured counts frames read, Written those in the recordings. ReadFailures are reads that returned
+	// no frame, Shed frames the load governor kept out of the recordings and QueueDropped those the full
+	// write queue discarded.
+	Captured     int64        `json:"captured"`
+	Written      int64        `json:"written"`
+	ReadFailures int64        `json:"read_failures"`
+	Shed         int64        `json:"shed,omitempty"`
+	QueueDropped int64        `json:"queue_dropped,omitempty"`
+	WriteErrors  int64        `json:"write_errors"`
+	Reconnects   int64        `json:"reconnects"`
+	CaptureFPS   float64      `json:"capture_fps"`
+	WriteFPS     float64      `json:"write_fps"`
+	Bytes        int64        `json:"bytes"`
+	Files        []FileReport `json:"files,omitempty"`
+}
+
+type FileReport struct {
+	File  string `json:"file"`
+	Bytes int64  `json:"bytes"`
+}
+
+func newRunReport(cameras []*Camera, manifest *Manifest, gov *Governor, ended time.Time) RunReport {
+	r := RunReport{SessionID: manifest.SessionID, StartedAt: sessionStart, EndedAt: ended, Duration: ended.Sub(sessionStart).Seconds()}
+	for _, cam := range cameras {
+		c := CameraReport{ID: cam.ID, Label: cam.Name, Captured: cam.framesCaptured.Load(), Written: cam.framesWritten.Load(),
+			ReadFailures: cam.framesDropped.Load(), Shed: gov.Shed(cam.ID), QueueDropped: cam.queueDropped.Load(), WriteErrors: cam.writeErrors.Load(), Reconnects: cam.reconnects.Load()}
+		if secs := ended.Sub(cam.openedAt).Seconds(); secs > 0 {
+			c.CaptureFPS, c.WriteFPS = float64(c.Captured)/secs, float64(c.Written)/secs
+		}
+		manifest.mu.Lock()
+		i := slices.IndexFunc(manifest.Cameras, func(m CameraManifest) bool { return m.ID == cam.ID })
+		var files []string
+		if i >= 0 {
+			files = slices.Clone(manifest.Cameras[i].Files)
+		}
+		manifest.mu.Unlock()
+		for _, f := range files {
+			if fi, err := os.Stat(manifest.absPath(f)); err == nil {
+				c.Files = append(c.Files, FileReport{File: f, Bytes: fi.Size()})
+				c.Bytes += fi.Size()
+			}
+		}
+		r.Cameras = append(r.Cameras, c)
+	}
+	return r
+}
+
+// reportRun logs the end-of-run summary and writes it to --report as JSON.
+func reportRun(cameras []*Camera, manifest *Manifest, gov *Governor) {
+	r := newRunReport(cameras, manifest, gov, time.Now())
+	logger.Info(fmt.Sprintf("Run of %v ended.", time.Duration(r.Duration*float64(time.Second)).Round(time.Second)))
+	for _, c := range r.Cameras {
+		logger.Info(fmt.Sprintf("Cam %d: %d frames captured (%.2f fps), %d written (%.2f fps), %d read failures, %d shed, %d dropped from the write queue, %d write errors, %d reconnects, %d file(s) of %.1f MB.",
+			c.ID, c.Captured, c.CaptureFPS, c.Written, c.WriteFPS, c.ReadFailures, c.Shed, c.QueueDropped, c.WriteErrors, c.Reconnects, len(c.Files), float64(c.Bytes)/1e6))
+	}
+	if config.Report == "" {
+		return
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err == nil {
+		err = writeAtomic(config.Report, data)
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to write report %s: %v.", config.Report, err))
+		return
+	}
+	logger.Info(fmt.Sprintf("Report written to %s.", config.Report))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	retentionDelete = "delete"
+	retentionStop   = "stop"
+
+	retentionInterval = 5 * time.Second
+	// retentionMinAge keeps files that are still being written out of the deletion candidates.
+	retentionMinAge = 30 * time.Second
+)
+
+func retentionEnabled() bool {
+	return config.MinFreeSpace > 0 || config.MaxTotalSize > 0
+}
+
+type recordedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// recordingExts are the extensions of the recordings: the container and those of the --lossless
+// ffv1 and huffyuv files.
+func recordingExts() []string {
+	exts := []string{"." + config.Container}
+	modes := []string{config.Lossless}
+	for _, c := range config.Cameras {
+		modes = append(modes, c.Lossless)
+	}
+	for _, mode := range modes {
+		if mode == losslessFFV1 || mode == losslessHuffYUV {
+			exts = append(exts, filepath.Ext(losslessPath("recording", mode)))
+		}
+	}
+	return exts
+}
+
+// recordedFiles lists the recordings under dir, oldest first, with their total size. A --lossless png
+// sequence counts as one recording of all its files, last modified with its newest frame.
+func recordedFiles(dir string) ([]recordedFile, int64) {
+	var files []recordedFile
+	var total int64
+	exts := recordingExts()
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if _, err := os.Stat(filepath.Join(path, pngFrameName(0))); err != nil {
+				return nil
+			}
+			f := pngSequenceFile(path)
+			files = append(files, f)
+			total += f.size
+			return filepath.SkipDir
+		}
+		if !slices.Contains(exts, filepath.Ext(path)) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			files = append(files, recordedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+			total += info.Size()
+		}
+		return nil
+	})
+	slices.SortFunc(files, func(a, b recordedFile) int { return a.modTime.Compare(b.modTime) })
+	return files, total
+}
+
+// pngSequenceFile sums up the png sequence in dir.
+func pngSequenceFile(dir string) recordedFile {
+	f := recordedFile{path: dir}
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			f.size += info.Size()
+			if info.ModTime().After(f.modTime) {
+				f.modTime = info.ModTime()
+			}
+		}
+		return nil
+	})
+	return f
+}
+
+// removeRecording deletes a recording together with its timestamp sidecars, and a png sequence with
+// its frame index.
+func removeRecording(path string) error {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	_ = os.Remove(base + ".timestamps.csv")
+	_ = os.Remove(base + ".srt")
+	_ = os.Remove(base + ".index.csv")
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return os.RemoveAll(path)
+	}
+	return os.Remove(path)
+}
+
+// enforceRetention checks --min-free-space and --max-total-size on the active output directory. With
+// --on-full delete the oldest finished recordings are removed until both hold again; with stop, or when
+// nothing is left to delete, recording is stopped and reported as such.
+func enforceRetention(manifest *Manifest) bool {
+	dir := activeOutputDir()
+	files, total := recordedFiles(dir)
+	var free uint64
+	freeKnown := false
+	if f, err := freeSpace(dir); err == nil {
+		free, freeKnown = f, true
+	}
+	exceeded := func() string {
+		if config.MaxTotalSize > 0 && total > config.MaxTotalSize {
+			return fmt.Sprintf("recordings use %d MB of %d MB", total>>20, config.MaxTotalSize>>20)
+		}
+		if config.MinFreeSpace > 0 && freeKnown && free < uint64(config.MinFreeSpace) {
+			return fmt.Sprintf("only %d MB free of the required %d MB", free>>20, config.MinFreeSpace>>20)
+		}
+		return ""
+	}
+
+	reason := exceeded()
+	if reason == "" {
+		return false
+	}
+	if config.OnFull == retentionDelete {
+		cutoff := time.Now().Add(-retentionMinAge)
+		for _, f := range files {
+			if reason == "" {
+				return false
+			}
+			if f.modTime.After(cutoff) {
+				break
+			}
+			if err := removeRecording(f.path); err != nil {
+				logger.Error(fmt.Sprintf("Failed to delete %s: %v.", f.path, err))
+				continue
+			}
+			logger.Info(fmt.Sprintf("Deleted %s (%d MB), %s.", f.path, f.size>>20, reason))
+			publishStatus(StatusEvent{Type: statusDisk, CamID: allCameras, File: filepath.Base(f.path), Note: "deleted, " + reason})
+			manifest.AddDeleted(f.path)
+			total -= f.size
+			free += uint64(f.size)
+			reason = exceeded()
+		}
+		if reason == "" {
+			return false
+		}
+	}
+	logger.Error(fmt.Sprintf("Stopping, %s.", reason))
+	publishStatus(StatusEvent{Type: statusDisk, CamID: allCameras, Note: "stopping, " + reason})
+	return true
+}
+
+// watchRetention enforces the storage limits until ctx is done and stops the session when they cannot be met.
+func watchRetention(ctx context.Context, manifest *Manifest) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if enforceRetention(manifest) {
+				sendCommand(Command{Name: cmdStop, CamID: allCameras, Source: "retention"})
+				return
+			}
+		}
+	}
+}
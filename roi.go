@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+const defaultROIBlur = 21
+
+// parseROI parses "x,y,w,h" given as fractions of the frame, e.g. 0.25,0.25,0.5,0.5 for the centre.
+func parseROI(s string) ([4]float64, error) {
+	var roi [4]float64
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return roi, errors.New("roi must be x,y,w,h as fractions of the frame")
+	}
+	for i, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || v < 0 || v > 1 {
+			return roi, fmt.Errorf("invalid roi value %q, expected a fraction between 0 and 1", p)
+		}
+		roi[i] = v
+	}
+	if roi[2] == 0 || roi[3] == 0 || roi[0]+roi[2] > 1 || roi[1]+roi[3] > 1 {
+		return roi, errors.New("roi must be non-empty and inside the frame")
+	}
+	return roi, nil
+}
+
+// roiRect scales a fractional ROI to a frame of width x height pixels.
+func roiRect(roi [4]float64, width, height int) image.Rectangle {
+	w, h := float64(width), float64(height)
+	return image.Rect(int(roi[0]*w), int(roi[1]*h), int((roi[0]+roi[2])*w), int((roi[1]+roi[3])*h))
+}
+
+// degradePeriphery returns a copy of mat with everything outside rect blurred. Encoders spend few
+// bits on smooth areas, so the ROI keeps its quality at the same bitrate with any codec.
+func degradePeriphery(mat gocv.Mat, rect image.Rectangle, ksize int) gocv.Mat {
+	out := gocv.NewMat()
+	if err := gocv.GaussianBlur(mat, &out, image.Pt(ksize, ksize), 0, 0, gocv.BorderReplicate); err != nil {
+		logger.Error(fmt.Sprintf("Failed to blur periphery: %v.", err))
+		_ = out.Close()
+		return mat.Clone()
+	}
+	rect = rect.Intersect(image.Rect(0, 0, mat.Cols(), mat.Rows()))
+	if rect.Empty() {
+		return out
+	}
+	src := mat.Region(rect)
+	dst := out.Region(rect)
+	src.CopyTo(&dst)
+	_ = src.Close()
+	_ = dst.Close()
+	return out
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// s3PartSize is the size of the parts a recording is streamed up in; S3 needs at least 5 MiB for
+// every part but the last, and objects smaller than this go up in a single PUT.
+const s3PartSize = 16 << 20
+
+// S3Storage uploads to an S3 bucket, or with --s3-endpoint to any S3 compatible store such as MinIO,
+// signing requests with the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and optional AWS_SESSION_TOKEN
+// of the environment.
+type S3Storage struct {
+	bucket, prefix string
+	region         string
+	endpoint       *url.URL
+	pathStyle      bool
+
+	accessKey, secretKey, token string
+	client                      *http.Client
+}
+
+func newS3Storage(u *url.URL) (*S3Storage, error) {
+	if u.Host == "" {
+		return nil, errors.New("s3 storage needs a bucket, e.g. s3://recordings/site-1")
+	}
+	s := &S3Storage{
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+		client:    &http.Client{Timeout: 10 * time.Minute},
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("s3 storage needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY in the environment")
+	}
+	endpoint := fmt.Sprintf("https://%s.s3.%s.amazonaws.com", s.bucket, s.region)
+	if config.S3Endpoint != "" {
+		endpoint, s.pathStyle = strings.TrimSuffix(config.S3Endpoint, "/"), true
+	}
+	e, err := url.Parse(endpoint)
+	if err != nil || e.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+	s.endpoint = e
+	return s, nil
+}
+
+func (s *S3Storage) String() string {
+	return "s3://" + s.bucket + "/" + s.prefix
+}
+
+// Create streams name up as a multipart upload, one part at a time while the next one fills, so
+// memory stays bounded whatever the size of the recording. An object smaller than a part goes up in a
+// single PUT on Close.
+func (s *S3Storage) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return &s3Writer{s: s, ctx: ctx, key: joinKey(s.prefix, name), buf: make([]byte, 0, s3PartSize)}, nil
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+// s3Writer is an object being written to an S3Storage.
+type s3Writer struct {
+	s        *S3Storage
+	ctx      context.Context
+	key      string
+	buf      []byte
+	uploadID string
+	parts    []s3Part
+	// pending is the upload of the last full part, which runs while buf fills.
+	pending chan error
+	err     error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), s3PartSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p, written = p[n:], written+n
+		if len(w.buf) == s3PartSize {
+			if w.err = w.flush(); w.err != nil {
+				return written, w.err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush starts the upload of buf as the next part once the previous one is up.
+func (w *s3Writer) flush() error {
+	if err := w.wait(); err != nil {
+		return err
+	}
+	if w.uploadID == "" {
+		id, err := w.s.createMultipart(w.ctx, w.key)
+		if err != nil {
+			return err
+		}
+		w.uploadID = id
+	}
+	n := len(w.parts) + 1
+	w.parts = append(w.parts, s3Part{PartNumber: n})
+	body := w.buf
+	w.buf = make([]byte, 0, s3PartSize)
+	w.pending = make(chan error, 1)
+	go func() {
+		err := withRetries(func() error {
+			etag, err := w.s.uploadPart(w.ctx, w.key, w.uploadID, n, body)
+			w.parts[n-1].ETag = etag
+			return err
+		})
+		w.pending <- err
+	}()
+	return nil
+}
+
+// wait waits for the part being uploaded, if any.
+func (w *s3Writer) wait() error {
+	if w.pending == nil {
+		return nil
+	}
+	err := <-w.pending
+	w.pending = nil
+	return err
+}
+
+// Close uploads what is left and completes the object, or drops the parts of a failed upload so the
+// bucket is not billed for them.
+func (w *s3Writer) Close() error {
+	err := w.wait()
+	if err == nil {
+		err = w.err
+	}
+	if err == nil && w.uploadID == "" {
+		return withRetries(func() error {
+			_, err := w.s.do(w.ctx, http.MethodPut, w.key, nil, w.buf)
+			return err
+		})
+	}
+	if err == nil && len(w.buf) > 0 {
+		n := len(w.parts) + 1
+		err = withRetries(func() error {
+			etag, err := w.s.uploadPart(w.ctx, w.key, w.uploadID, n, w.buf)
+			if err == nil {
+				w.parts = append(w.parts, s3Part{PartNumber: n, ETag: etag})
+			}
+			return err
+		})
+	}
+	if err == nil {
+		var body []byte
+		body, err = xml.Marshal(struct {
+			XMLName xml.Name `xml:"CompleteMultipartUpload"`
+			Parts   []s3Part `xml:"Part"`
+		}{Parts: w.parts})
+		if err == nil {
+			err = withRetries(func() error {
+				_, err := w.s.do(w.ctx, http.MethodPost, w.key, url.Values{"uploadId": {w.uploadID}}, body)
+				return err
+			})
+		}
+	}
+	if err != nil && w.uploadID != "" {
+		w.s.abort(w.key, w.uploadID)
+	}
+	return err
+}
+
+// createMultipart starts a multipart upload of key and returns its id.
+func (s *S3Storage) createMultipart(ctx context.Context, key string) (string, error) {
+	var created struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err := withRetries(func() error {
+		resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+		if err != nil {
+			return err
+		}
+		if err := xml.Unmarshal(resp, &created); err != nil || created.UploadID == "" {
+			return fmt.Errorf("could not start multipart upload of %s: %v", key, err)
+		}
+		return nil
+	})
+	return created.UploadID, err
+}
+
+func (s *S3Storage) uploadPart(ctx context.Context, key, uploadID string, n int, body []byte) (string, error) {
+	query := url.Values{"partNumber": {fmt.Sprint(n)}, "uploadId": {uploadID}}
+	req, err := s.request(ctx, http.MethodPut, key, query, body)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("part %d of %s: %s: %s", n, key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// abort drops the parts of a failed multipart upload so the bucket is not billed for them.
+func (s *S3Storage) abort(key, uploadID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if _, err := s.do(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil); err != nil {
+		logger.Warn(fmt.Sprintf("Failed to abort upload of %s: %v.", key, err))
+	}
+}
+
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, error) {
+	req, err := s.request(ctx, method, key, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, key, resp.Status, bytes.TrimSpace(data))
+	}
+	return data, err
+}
+
+// request builds a request for key signed with AWS Signature Version 4.
+func (s *S3Storage) request(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = "/" + key
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	}
+	u.RawPath = awsEscapePath(u.Path)
+	u.RawQuery = awsQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, time.Now())
+	return req, nil
+}
+
+// sign adds the Signature Version 4 headers for req with body, signed at now, to req.
+func (s *S3Storage) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	date, stamp := now.Format("20060102"), now.Format("20060102T150405Z")
+	hash := sha256.Sum256(body)
+	payload := hex.EncodeToString(hash[:])
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host, "x-amz-content-sha256": payload, "x-amz-date": stamp}
+	if s.token != "" {
+		headers["x-amz-security-token"] = s.token
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical := strings.Join([]string{req.Method, awsEscapePath(req.URL.Path), awsQuery(req.URL.Query()),
+		canonicalHeaders.String(), signed, payload}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+	key4 := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{date, s.region, "s3", "aws4_request"} {
+		key4 = hmacSHA256(key4, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key4, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signed, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, as Signature Version 4 requires.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func awsEscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsQuery is the canonical query string: sorted, escaped and with = even for empty values.
+func awsQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
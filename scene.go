@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	sceneOff     = ""
+	sceneSegment = "segment"
+	sceneMarker  = "marker"
+
+	sceneWidth      = 64
+	sceneSample     = 500 * time.Millisecond
+	scenePixelDelta = 40
+	// sceneSustain is how long a new view must hold before it counts, so people walking past are ignored.
+	sceneSustain = 1500 * time.Millisecond
+)
+
+func validateSceneChange(s string) error {
+	if s != sceneOff && s != sceneSegment && s != sceneMarker {
+		return fmt.Errorf("scene change must be %s or %s", sceneSegment, sceneMarker)
+	}
+	return nil
+}
+
+// SceneDetector compares small grey samples against a reference view and reports a scene change, such as
+// the lights going on or the camera being moved, once a different view has held steady for sceneSustain.
+// The reference follows gradual changes like daylight.
+type SceneDetector struct {
+	ref   gocv.Mat
+	prev  gocv.Mat
+	since time.Time
+	next  time.Time
+}
+
+// Detect returns the fraction of the reference view that changed and whether that is a new scene, one
+// where more than threshold of the view changed.
+func (d *SceneDetector) Detect(frame gocv.Mat, at time.Time, threshold float64) (float64, bool) {
+	if at.Before(d.next) {
+		return 0, false
+	}
+	d.next = at.Add(sceneSample)
+
+	small := gocv.NewMat()
+	height := max(1, frame.Rows()*sceneWidth/max(1, frame.Cols()))
+	_ = gocv.Resize(frame, &small, image.Pt(sceneWidth, height), 0, 0, gocv.InterpolationArea)
+	_ = gocv.CvtColor(small, &small, gocv.ColorBGRToGray)
+	_ = gocv.GaussianBlur(small, &small, image.Pt(5, 5), 0, 0, gocv.BorderDefault)
+	if d.ref.Empty() || d.ref.Rows() != small.Rows() {
+		_ = d.ref.Close()
+		d.ref = small
+		return 0, false
+	}
+
+	changed := changedFraction(d.ref, small)
+	if changed < threshold {
+		d.since = time.Time{}
+		if changed < threshold/2 {
+			_ = d.ref.Close()
+			d.ref = small
+		} else {
+			_ = small.Close()
+		}
+		return changed, false
+	}
+
+	steady := !d.prev.Empty() && changedFraction(d.prev, small) < threshold/2
+	_ = d.prev.Close()
+	d.prev = small.Clone()
+	if d.since.IsZero() || !steady {
+		d.since = at
+		_ = small.Close()
+		return changed, false
+	}
+	if at.Sub(d.since) < sceneSustain {
+		_ = small.Close()
+		return changed, false
+	}
+	_ = d.ref.Close()
+	d.ref = small
+	d.since = time.Time{}
+	return changed, true
+}
+
+func changedFraction(a, b gocv.Mat) float64 {
+	diff := gocv.NewMat()
+	defer diff.Close()
+	_ = gocv.AbsDiff(a, b, &diff)
+	gocv.Threshold(diff, &diff, scenePixelDelta, 255, gocv.ThresholdBinary)
+	return float64(gocv.CountNonZero(diff)) / float64(max(1, b.Rows()*b.Cols()))
+}
+
+func (d *SceneDetector) Close() {
+	_ = d.ref.Close()
+	_ = d.prev.Close()
+}
+
+// detectScene marks a scene change and, with --scene-change segment, continues in a new file.
+func (c *Camera) detectScene(mat gocv.Mat, at time.Time) {
+	changed, ok := c.scene.Detect(mat, at, config.SceneThreshold/100)
+	if !ok {
+		return
+	}
+	note := fmt.Sprintf("scene change, %.0f%% of the view changed", changed*100)
+	logger.Info(fmt.Sprintf("Cam %d %s.", c.ID, note))
+	if config.SceneChange == sceneSegment && c.Writer != nil {
+		c.rotateSegment()
+	}
+	if c.manifest != nil {
+		c.manifest.AddMarker(Marker{Time: at, CamID: c.ID, Source: "scene", Note: note})
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var errSchedule = errors.New(`schedule must be windows like "mon-fri 08:00-18:00" or cron expressions with a length like "0 8 * * 1-5 for 10h", separated by ";"`)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// scheduleOpen is whether a --schedule window is open; always true without one.
+var scheduleOpen atomic.Bool
+
+func init() {
+	scheduleOpen.Store(true)
+}
+
+// ScheduleWindow is one --schedule window: days with a time span, or a cron expression giving when it
+// opens and how long it stays open.
+type ScheduleWindow struct {
+	days       [7]bool
+	start, end int // minutes after midnight; an end before the start runs past midnight
+
+	cron   *cronSpec
+	length time.Duration
+	// checked is the last minute looked at for a cron start and opened the latest start at or before it,
+	// so each minute is matched once rather than the whole length every tick.
+	checked, opened time.Time
+}
+
+// maxScheduleLength caps the length of a cron window.
+const maxScheduleLength = 7 * 24 * time.Hour
+
+func parseSchedule(s string) ([]ScheduleWindow, error) {
+	var windows []ScheduleWindow
+	for _, part := range strings.Split(s, ";") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part == "" {
+			continue
+		}
+		w, err := parseScheduleWindow(part)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	if len(windows) == 0 {
+		return nil, errSchedule
+	}
+	return windows, nil
+}
+
+func parseScheduleWindow(s string) (ScheduleWindow, error) {
+	if expr, length, ok := strings.Cut(s, " for "); ok {
+		cron, err := parseCron(expr)
+		if err != nil {
+			return ScheduleWindow{}, err
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(length))
+		if err != nil || d < time.Minute || d > maxScheduleLength {
+			return ScheduleWindow{}, fmt.Errorf("invalid window length %q, expected e.g. 10h and at most %v", length, maxScheduleLength)
+		}
+		return ScheduleWindow{cron: cron, length: d}, nil
+	}
+
+	fields := strings.Fields(s)
+	var w ScheduleWindow
+	switch len(fields) {
+	case 1:
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	case 2:
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return ScheduleWindow{}, err
+		}
+		w.days = days
+	default:
+		return ScheduleWindow{}, errSchedule
+	}
+	from, to, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return ScheduleWindow{}, errSchedule
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return ScheduleWindow{}, err
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return ScheduleWindow{}, err
+	}
+	if w.start == w.end {
+		return ScheduleWindow{}, fmt.Errorf("schedule window %q is empty", s)
+	}
+	return w, nil
+}
+
+// parseDays parses daily, or days and day ranges such as mon-fri,sun.
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	if s == "daily" || s == "*" {
+		return [7]bool{true, true, true, true, true, true, true}, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdays[from]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q, expected mon, tue, wed, thu, fri, sat or sun", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdays[to]; !ok {
+				return days, fmt.Errorf("invalid day %q, expected mon, tue, wed, thu, fri, sat or sun", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses HH:MM into minutes after midnight; 24:00 is the end of the day.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err == nil {
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if s == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+}
+
+func (w *ScheduleWindow) contains(t time.Time) bool {
+	if w.cron != nil {
+		w.scanCron(t.Truncate(time.Minute))
+		return !w.opened.IsZero() && t.Sub(w.opened) < w.length
+	}
+	m := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	if w.start < w.end {
+		return w.days[today] && m >= w.start && m < w.end
+	}
+	return w.days[today] && m >= w.start || w.days[yesterday] && m < w.end
+}
+
+// scanCron brings opened up to minute. Going on from the last minute checked it matches only the
+// minutes since; at the first call, or after the clock jumped, it searches back over the window length.
+func (w *ScheduleWindow) scanCron(minute time.Time) {
+	if !w.checked.IsZero() && !minute.Before(w.checked) && minute.Sub(w.checked) < w.length {
+		for at := w.checked.Add(time.Minute); !at.After(minute); at = at.Add(time.Minute) {
+			if w.cron.match(at) {
+				w.opened = at
+			}
+		}
+		w.checked = minute
+		return
+	}
+	w.checked, w.opened = minute, time.Time{}
+	for at := minute; minute.Sub(at) < w.length; at = at.Add(-time.Minute) {
+		if w.cron.match(at) {
+			w.opened = at
+			return
+		}
+	}
+}
+
+func inSchedule(windows []ScheduleWindow, t time.Time) bool {
+	for i := range windows {
+		if windows[i].contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// cronSpec is a five field cron expression: minute, hour, day of month, month and day of week.
+type cronSpec struct {
+	minute, hour, dom, month, dow []bool
+	// anyDOM and anyDOW are set for a * day field; when both day fields are restricted either may match.
+	anyDOM, anyDOW bool
+}
+
+func parseCron(s string) (*cronSpec, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q, expected minute hour day-of-month month day-of-week", s)
+	}
+	c := &cronSpec{anyDOM: fields[2] == "*", anyDOW: fields[4] == "*"}
+	var err error
+	for _, f := range []struct {
+		dst      *[]bool
+		min, max int
+	}{{&c.minute, 0, 59}, {&c.hour, 0, 23}, {&c.dom, 1, 31}, {&c.month, 1, 12}, {&c.dow, 0, 7}} {
+		if *f.dst, err = parseCronField(fields[0], f.min, f.max); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	}
+	// Sunday is 0 or 7.
+	c.dow[0] = c.dow[0] || c.dow[7]
+	return c, nil
+}
+
+// parseCronField parses *, n, a-b and comma lists of them, each with an optional /step.
+func parseCronField(s string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(s, ",") {
+		span, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid cron step %q", part)
+			}
+			step = n
+		}
+		lo, hi := min, max
+		if span != "*" {
+			from, to, isRange := strings.Cut(span, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("invalid cron field %q", part)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("invalid cron field %q", part)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("cron field %q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSpec) match(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[t.Month()] {
+		return false
+	}
+	dom, dow := c.dom[t.Day()], c.dow[t.Weekday()]
+	switch {
+	case c.anyDOM && c.anyDOW:
+		return true
+	case c.anyDOM:
+		return dow
+	case c.anyDOW:
+		return dom
+	}
+	return dom || dow
+}
+
+func validateSchedule(s string) error {
+	_, err := parseSchedule(s)
+	return err
+}
+
+// runSchedule starts recording on the continuously recording cameras when a --schedule window opens and
+// stops it, finalizing their files, when it closes.
+func runSchedule(ctx context.Context, cameras *cameraList, manifest *Manifest) {
+	windows, _ := parseSchedule(config.Schedule)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	started := false
+	for {
+		if now := time.Now(); armed() {
+			open := inSchedule(windows, now)
+			if !started && !open {
+				logger.Info("Outside the recording schedule, waiting for a window to open.")
+			} else if open != scheduleOpen.Load() {
+				setScheduled(cameras.Load(), open, manifest, now)
+			}
+			scheduleOpen.Store(open)
+			started = true
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func setScheduled(cameras []*Camera, open bool, manifest *Manifest, now time.Time) {
+	if open && privacy.Load() {
+		logger.Warn("Schedule window opened during the privacy blank, recording stays stopped.")
+		return
+	}
+	for _, cam := range cameras {
+		if cam.Motion != nil {
+			continue
+		}
+		if open {
+			cam.do(func() { cam.startRecording(manifest) })
+		} else {
+			cam.do(cam.stopRecording)
+		}
+	}
+	note := "schedule window closed, recording stopped"
+	if open {
+		note = "schedule window opened, recording started"
+	}
+	logger.Info(fmt.Sprintf("The %s.", note))
+	manifest.AddMarker(Marker{Time: now, CamID: allCameras, Source: "schedule", Note: note})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// setValues lists the values set in a parsed cron field.
+func setValues(set []bool) []int {
+	var values []int
+	for v, ok := range set {
+		if ok {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+		want     []int
+	}{
+		{"*", 0, 6, []int{0, 1, 2, 3, 4, 5, 6}},
+		{"5", 0, 59, []int{5}},
+		{"1-5", 0, 7, []int{1, 2, 3, 4, 5}},
+		{"1,3,5", 0, 7, []int{1, 3, 5}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"5/20", 0, 59, []int{5, 25, 45}},
+		{"1-10/3", 0, 59, []int{1, 4, 7, 10}},
+		{"0-4/2,22", 0, 23, []int{0, 2, 4, 22}},
+		{"*/5", 1, 12, []int{1, 6, 11}},
+	}
+	for _, tt := range tests {
+		set, err := parseCronField(tt.field, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("parseCronField(%q) failed: %v", tt.field, err)
+			continue
+		}
+		if got := setValues(set); !slices.Equal(got, tt.want) {
+			t.Errorf("parseCronField(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronFieldErrors(t *testing.T) {
+	tests := []struct {
+		field    string
+		min, max int
+	}{
+		{"60", 0, 59}, {"5-1", 0, 59}, {"0/0", 0, 59}, {"*/x", 0, 59}, {"a", 0, 59},
+		{"1-", 0, 59}, {"-1", 0, 59}, {"", 0, 59}, {"0", 1, 31}, {"8", 0, 7},
+	}
+	for _, tt := range tests {
+		if _, err := parseCronField(tt.field, tt.min, tt.max); err == nil {
+			t.Errorf("parseCronField(%q) in %d-%d succeeded", tt.field, tt.min, tt.max)
+		}
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	// 2026-10-16 is a Friday, the 18th a Sunday.
+	friday := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	sunday := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		at   time.Time
+		want bool
+	}{
+		{"0 8 * * *", friday, true},
+		{"0 8 * * *", friday.Add(time.Minute), false},
+		{"0 8 * * 1-5", friday, true},
+		{"0 8 * * 1-5", sunday, false},
+		// Sunday is 0 or 7.
+		{"0 8 * * 0", sunday, true},
+		{"0 8 * * 7", sunday, true},
+		{"0 8 * * 7", friday, false},
+		{"0 8 16 * *", friday, true},
+		{"0 8 16 11 *", friday, false},
+		// With both day fields restricted either one matching is enough.
+		{"0 8 1 * 5", friday, true},
+		{"0 8 16 * 0", friday, true},
+		{"0 8 1 * 0", friday, false},
+		// A * day field leaves the other one to decide.
+		{"0 8 * * 0", friday, false},
+		{"0 8 1 * *", friday, false},
+	}
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q) failed: %v", tt.expr, err)
+		}
+		if got := c.match(tt.at); got != tt.want {
+			t.Errorf("%q matching %s = %v, want %v", tt.expr, tt.at.Format(time.RFC1123), got, tt.want)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"mon-fri",
+		"funday 08:00-18:00",
+		"08:00-08:00",
+		"08:00-25:00",
+		"0 8 * * for 10h",
+		"0 8 * * 1-5 for 30s",
+		"0 8 * * 1-5 for 169h",
+		"0 8 * * 1-5 for soon",
+	} {
+		if _, err := parseSchedule(s); err == nil {
+			t.Errorf("parseSchedule(%q) succeeded", s)
+		}
+	}
+}
+
+func TestScheduleWindowContains(t *testing.T) {
+	// 2026-10-16 is a Friday.
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 10, day, hour, minute, 30, 0, time.UTC) }
+	tests := []struct {
+		schedule string
+		at       time.Time
+		want     bool
+	}{
+		{"mon-fri 08:00-18:00", at(16, 8, 0), true},
+		{"mon-fri 08:00-18:00", at(16, 17, 59), true},
+		{"mon-fri 08:00-18:00", at(16, 18, 0), false},
+		{"mon-fri 08:00-18:00", at(17, 12, 0), false},
+		{"daily 22:00-06:00", at(16, 23, 0), true},
+		{"daily 22:00-06:00", at(17, 5, 59), true},
+		{"daily 22:00-06:00", at(17, 6, 0), false},
+		// A window past midnight belongs to the day it starts on.
+		{"fri 22:00-06:00", at(17, 3, 0), true},
+		{"fri 22:00-06:00", at(16, 3, 0), false},
+		{"0 8 * * 1-5 for 10h", at(16, 7, 59), false},
+		{"0 8 * * 1-5 for 10h", at(16, 8, 0), true},
+		{"0 8 * * 1-5 for 10h", at(16, 17, 59), true},
+		{"0 8 * * 1-5 for 10h", at(16, 18, 0), false},
+		{"0 22 * * 5 for 12h", at(17, 9, 0), true},
+		{"0 22 * * 5 for 12h", at(17, 10, 0), false},
+	}
+	for _, tt := range tests {
+		windows, err := parseSchedule(tt.schedule)
+		if err != nil {
+			t.Fatalf("parseSchedule(%q) failed: %v", tt.schedule, err)
+		}
+		if got := inSchedule(windows, tt.at); got != tt.want {
+			t.Errorf("%q at %s = %v, want %v", tt.schedule, tt.at.Format(time.RFC1123), got, tt.want)
+		}
+	}
+}
+
+// TestCronWindowAcrossTicks checks the window found by going on from the last minute checked against
+// searching anew at every minute.
+func TestCronWindowAcrossTicks(t *testing.T) {
+	windows, err := parseSchedule("0 8 * * 1-5 for 10h; 30 */6 * * 0 for 90m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	for at := start; at.Before(start.Add(5 * 24 * time.Hour)); at = at.Add(17 * time.Second) {
+		fresh, _ := parseSchedule("0 8 * * 1-5 for 10h; 30 */6 * * 0 for 90m")
+		if got, want := inSchedule(windows, at), inSchedule(fresh, at); got != want {
+			t.Fatalf("at %s the window is open = %v, searching anew %v", at.Format(time.RFC1123), got, want)
+		}
+	}
+	// A clock stepping back searches anew.
+	back := start.Add(24*time.Hour + 9*time.Hour)
+	if !inSchedule(windows, back) {
+		t.Errorf("window not open at %s after the clock went back", back.Format(time.RFC1123))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// segmentSizeCheckInterval limits how often the current file is stat'ed for --segment-size.
+const segmentSizeCheckInterval = time.Second
+
+func segmenting() bool {
+	return config.SegmentDuration > 0 || config.SegmentSize > 0
+}
+
+// segmentDue reports whether the current file reached --segment-duration or --segment-size.
+func (c *Camera) segmentDue(now time.Time) bool {
+	if config.SegmentDuration > 0 && now.Sub(c.segmentStart) >= config.SegmentDuration {
+		return true
+	}
+	if config.SegmentSize > 0 && now.Sub(c.segmentSizeCheck) >= segmentSizeCheckInterval {
+		c.segmentSizeCheck = now
+		if writtenSize(c.Writer, c.Filename) >= config.SegmentSize {
+			return true
+		}
+	}
+	return false
+}
+
+// writtenSize is the size of the current recording: what the writer counted if it keeps a count, as
+// a png sequence does, or the size of the file.
+func writtenSize(w FrameWriter, filename string) int64 {
+	if q, ok := w.(*QueuedWriter); ok {
+		w = q.writer
+	}
+	if s, ok := w.(interface{ Size() int64 }); ok {
+		return s.Size()
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// rotateSegment starts the next segment before finalizing the previous one in the background,
+// so no frame is lost while the old file's trailer is written.
+func (c *Camera) rotateSegment() {
+	old, oldName, oldSidecars := c.Writer, c.Filename, c.sidecars
+	if err := c.openWriter(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to start next segment for cam %d, continuing %s: %v.", c.ID, oldName, err))
+		c.segmentStart = time.Now()
+		return
+	}
+	if c.manifest != nil {
+		c.manifest.AddFile(c.ID, c.Filename)
+	}
+	logger.Info(fmt.Sprintf("Cam %d segment %d started: %s.", c.ID, c.segment, c.Filename))
+	publishStatus(StatusEvent{Type: statusSegmentRotated, CamID: c.ID, File: filepath.Base(c.Filename)})
+
+	c.finalizing.Add(1)
+	go func() {
+		defer c.finalizing.Done()
+		if err := old.Close(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to finalize segment %s: %v.", oldName, err))
+		}
+		c.finishFile(oldSidecars, oldName)
+		storeSidecars(oldName)
+	}()
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"image"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+type Server struct {
+	srv      *http.Server
+	cameras  cameraList
+	manifest *Manifest
+}
+
+// startServer binds every --serve address before returning, so a taken port or bad certificate fails the start.
+func startServer(addrs string, cameras []*Camera, manifest *Manifest) (*Server, error) {
+	s := &Server{manifest: manifest}
+	s.cameras.Store(cameras)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /snapshot/{file}", s.handleSnapshot)
+	mux.HandleFunc("POST /event", s.handleEvent)
+	mux.HandleFunc("POST /event/{cam}", s.handleEvent)
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	s.registerAPI(mux)
+	s.registerMJPEG(mux)
+
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if authEnabled() && tlsConfig == nil {
+		logger.Warn("Credentials are sent in clear text, set --tls-cert and --tls-key to enable HTTPS.")
+	}
+	listeners, err := listen(addrs, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	s.srv = &http.Server{Handler: authorize(mux), ReadHeaderTimeout: 10 * time.Second}
+	scheme := "HTTP"
+	if tlsConfig != nil {
+		scheme = "HTTPS"
+		if tlsConfig.ClientCAs != nil {
+			scheme = "HTTPS (client certificates required)"
+		}
+	}
+	for _, l := range listeners {
+		logger.Info(fmt.Sprintf("%s server listening on %s.", scheme, l.Addr()))
+		go func() {
+			if err := s.srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error(fmt.Sprintf("HTTP server on %s failed: %v.", l.Addr(), err))
+			}
+		}()
+	}
+	return s, nil
+}
+
+// parseListenAddrs splits --serve into host:port addresses. IPv6 hosts must be bracketed, e.g. [::1]:8080.
+func parseListenAddrs(s string) ([]string, error) {
+	var addrs []string
+	for _, addr := range strings.Split(s, ",") {
+		addr = strings.TrimSpace(addr)
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			if strings.Count(addr, ":") > 1 && !strings.HasPrefix(addr, "[") {
+				return nil, fmt.Errorf("invalid address %q, IPv6 addresses must be bracketed, e.g. [::1]:8080", addr)
+			}
+			return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+func listen(addrs string, tlsConfig *tls.Config) ([]net.Listener, error) {
+	parsed, err := parseListenAddrs(addrs)
+	if err != nil {
+		return nil, err
+	}
+	var listeners []net.Listener
+	for _, addr := range parsed {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, prev := range listeners {
+				_ = prev.Close()
+			}
+			return nil, err
+		}
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// serverTLSConfig returns nil without --tls-cert and --tls-key. With --tls-client-ca, clients must
+// present a certificate signed by that CA.
+func serverTLSConfig() (*tls.Config, error) {
+	if config.TLSCert == "" && config.TLSKey == "" {
+		if config.TLSClientCA != "" {
+			return nil, errors.New("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	if config.TLSCert == "" || config.TLSKey == "" {
+		return nil, errors.New("--tls-cert and --tls-key must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if config.TLSClientCA != "" {
+		pem, err := os.ReadFile(config.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.TLSClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+func (s *Server) Close() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.srv.Shutdown(ctx); err != nil {
+		logger.Error(fmt.Sprintf("Failed to shutdown HTTP server: %v.", err))
+	}
+}
+
+func (s *Server) camera(id int) *Camera {
+	return findCamera(s.cameras.Load(), id)
+}
+
+// setCameras updates the served cameras after a hot-plug change.
+func (s *Server) setCameras(cameras []*Camera) {
+	if s != nil {
+		s.cameras.Store(cameras)
+	}
+}
+
+// handleSnapshot serves GET /snapshot/{cam}.jpg[?width=N] with the latest displayed frame.
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".jpg")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.Atoi(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	cam := s.camera(id)
+	if cam == nil {
+		http.Error(w, fmt.Sprintf("camera %d not found", id), http.StatusNotFound)
+		return
+	}
+
+	width := 0
+	if v := r.URL.Query().Get("width"); v != "" {
+		width, err = strconv.Atoi(v)
+		if err != nil || width <= 0 {
+			http.Error(w, "width must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	buf, err := cam.latestJPEG(width)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	_, _ = w.Write(buf)
+}
+
+// handleEvent serves POST /event[/{cam}][?note=text] and fires an event for one or all cameras.
+func (s *Server) handleEvent(w http.ResponseWriter, r *http.Request) {
+	ev := Event{CamID: allCameras, Source: "http", Note: r.URL.Query().Get("note")}
+	if v := r.PathValue("cam"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || s.camera(id) == nil {
+			http.Error(w, fmt.Sprintf("camera %s not found", v), http.StatusNotFound)
+			return
+		}
+		ev.CamID = id
+	}
+	fireEvent(ev)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (c *Camera) setLatest(mat gocv.Mat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	mat.CopyTo(&c.latest)
+}
+
+func (c *Camera) latestJPEG(width int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.latest.Empty() {
+		return nil, fmt.Errorf("no frame available for camera %d", c.ID)
+	}
+
+	// Snapshots are only ever scaled down, so a huge width cannot make the resize allocate without bound.
+	src := c.latest
+	if width > 0 && width < c.latest.Cols() {
+		height := c.latest.Rows() * width / c.latest.Cols()
+		resized := gocv.NewMat()
+		defer resized.Close()
+		if err := gocv.Resize(c.latest, &resized, image.Pt(width, max(height, 1)), 0, 0, gocv.InterpolationArea); err != nil {
+			return nil, err
+		}
+		src = resized
+	}
+
+	nb, err := gocv.IMEncode(gocv.JPEGFileExt, src)
+	if err != nil {
+		return nil, err
+	}
+	defer nb.Close()
+	return append([]byte(nil), nb.GetBytes()...), nil
+}
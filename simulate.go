@@ -0,0 +1,306 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gocv.io/x/gocv"
+)
+
+func simulateCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "simulate",
+		Usage:     "Play a session's recordings back in real time as live cameras, over MJPEG and optionally RTSP, to test against",
+		ArgsUsage: "<session-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "listen", Usage: "Address the cameras are served on as MJPEG streams at /cam/<id>", Value: "127.0.0.1:8090"},
+			&cli.StringFlag{Name: "rtsp", Usage: "Also publish each camera as H.264 with ffmpeg to <url>/cam<id>, e.g. rtsp://localhost:8554 of an RTSP server such as mediamtx"},
+			&cli.Float64Flag{Name: "speed", Usage: "Playback speed, e.g. 2 for twice real time", Value: 1, Validator: func(f float64) error {
+				if f <= 0 {
+					return errors.New("speed must be greater than zero")
+				}
+				return nil
+			}},
+			&cli.BoolFlag{Name: "loop", Usage: "Start over when the session has played to the end"},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := setup(cmd); err != nil {
+				return err
+			}
+			if cmd.Args().Len() != 1 {
+				return errors.New("simulate takes the session ID, e.g. simulate 1714557600")
+			}
+			return simulateSession(ctx, cmd.Args().First(), cmd.String("listen"), strings.TrimSuffix(cmd.String("rtsp"), "/"),
+				cmd.Float64("speed"), cmd.Bool("loop"))
+		},
+	}
+}
+
+// simCamera plays the recordings of one camera of a session, keeping its latest frame as a JPEG for
+// the MJPEG streams and feeding it to the RTSP publisher.
+type simCamera struct {
+	id     int
+	fps    float64
+	files  []string
+	starts []time.Time
+
+	mu      sync.Mutex
+	jpeg    []byte
+	changed chan struct{}
+
+	rtspURL string
+	rtsp    *simPublisher
+}
+
+func simulateSession(ctx context.Context, sessionID, listen, rtsp string, speed float64, loop bool) error {
+	m, err := readManifest(config.OutputDir, sessionID)
+	if err != nil {
+		return fmt.Errorf("could not open session %s: %w", sessionID, err)
+	}
+	if rtsp != "" {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			return errors.New("ffmpeg is required for --rtsp but was not found in PATH")
+		}
+	}
+	starts := map[string]time.Time{}
+	if m.Offsets != nil {
+		for _, f := range m.Offsets.Files {
+			starts[f.File] = f.FirstFrame
+		}
+	}
+	// origin is the first frame of the session; files start playing as long after it as they were recorded.
+	var origin time.Time
+	var cameras []*simCamera
+	for _, cam := range m.Cameras {
+		sc := &simCamera{id: cam.ID, fps: cam.FPS, changed: make(chan struct{})}
+		for _, file := range cam.Files {
+			path := m.absPath(file)
+			if fi, err := os.Stat(path); err != nil || fi.IsDir() {
+				logger.Warn(fmt.Sprintf("Cam %d: skipping %s, it is not a video on disk.", cam.ID, file))
+				continue
+			}
+			sc.files = append(sc.files, path)
+			sc.starts = append(sc.starts, starts[file])
+			if start := starts[file]; !start.IsZero() && (origin.IsZero() || start.Before(origin)) {
+				origin = start
+			}
+		}
+		if len(sc.files) == 0 {
+			continue
+		}
+		if rtsp != "" {
+			sc.rtspURL = fmt.Sprintf("%s/cam%d", rtsp, cam.ID)
+		}
+		cameras = append(cameras, sc)
+	}
+	if len(cameras) == 0 {
+		return errors.New("the session has no recordings to play")
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	var sources []string
+	for _, sc := range cameras {
+		mux.HandleFunc(fmt.Sprintf("GET /cam/%d", sc.id), sc.serveMJPEG)
+		sources = append(sources, fmt.Sprintf("--source %d=http://%s/cam/%d", sc.id, ln.Addr(), sc.id))
+		if sc.rtspURL != "" {
+			logger.Info(fmt.Sprintf("Cam %d is published to %s.", sc.id, sc.rtspURL))
+		}
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(fmt.Sprintf("Simulation server on %s failed: %v.", ln.Addr(), err))
+		}
+	}()
+	defer srv.Close()
+	logger.Info(fmt.Sprintf("Simulating session %s with %d camera(s) on %s, record them with: %s.", sessionID, len(cameras), ln.Addr(), strings.Join(sources, " ")))
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for {
+		started := time.Now()
+		var wg sync.WaitGroup
+		for _, sc := range cameras {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sc.play(ctx, origin, started, speed)
+			}()
+		}
+		wg.Wait()
+		if ctx.Err() != nil || !loop {
+			break
+		}
+		logger.Info("Session played to the end, starting over.")
+	}
+	for _, sc := range cameras {
+		sc.rtsp.Close()
+	}
+	if ctx.Err() != nil {
+		logger.Info("Simulation stopped.")
+	} else {
+		logger.Info("Session played to the end.")
+	}
+	return nil
+}
+
+// play plays the camera's files one after the other, each starting when it was recorded relative to
+// origin if the manifest has its offsets.
+func (sc *simCamera) play(ctx context.Context, origin, started time.Time, speed float64) {
+	for i, file := range sc.files {
+		if !origin.IsZero() && !sc.starts[i].IsZero() {
+			at := started.Add(time.Duration(float64(sc.starts[i].Sub(origin)) / speed))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(at)):
+			}
+		}
+		if err := sc.playFile(ctx, file, speed); err != nil {
+			logger.Warn(fmt.Sprintf("Cam %d: could not play %s: %v.", sc.id, filepath.Base(file), err))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (sc *simCamera) playFile(ctx context.Context, file string, speed float64) error {
+	video, err := gocv.VideoCaptureFile(file)
+	if err != nil {
+		return err
+	}
+	defer video.Close()
+	fps := video.Get(gocv.VideoCaptureFPS)
+	if fps <= 0 {
+		fps = cmp.Or(sc.fps, 30)
+	}
+	interval := time.Duration(float64(time.Second) / fps / speed)
+	frame := gocv.NewMat()
+	defer frame.Close()
+	next := time.Now()
+	for video.Read(&frame) && !frame.Empty() {
+		sc.publish(frame, fps*speed)
+		next = next.Add(interval)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+	return nil
+}
+
+// publish makes frame the camera's latest; rate is the rate frames are played at, which the RTSP
+// stream is encoded with.
+func (sc *simCamera) publish(frame gocv.Mat, rate float64) {
+	buf, err := gocv.IMEncode(gocv.JPEGFileExt, frame)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to encode frame of cam %d: %v.", sc.id, err))
+		return
+	}
+	sc.mu.Lock()
+	sc.jpeg = append(sc.jpeg[:0:0], buf.GetBytes()...)
+	close(sc.changed)
+	sc.changed = make(chan struct{})
+	sc.mu.Unlock()
+	buf.Close()
+
+	if sc.rtspURL == "" {
+		return
+	}
+	if sc.rtsp != nil && (sc.rtsp.width != frame.Cols() || sc.rtsp.height != frame.Rows() || sc.rtsp.rate != rate) {
+		// A file of another size or frame rate needs a new stream.
+		sc.rtsp.Close()
+		sc.rtsp = nil
+	}
+	if sc.rtsp == nil {
+		if sc.rtsp, err = newSimPublisher(sc.rtspURL, rate, frame.Cols(), frame.Rows()); err != nil {
+			logger.Error(fmt.Sprintf("Failed to publish cam %d to %s: %v.", sc.id, sc.rtspURL, err))
+			sc.rtspURL = ""
+			return
+		}
+	}
+	if err := sc.rtsp.Write(frame); err != nil {
+		logger.Error(fmt.Sprintf("Failed to publish cam %d to %s: %v.", sc.id, sc.rtspURL, err))
+		sc.rtsp.Close()
+		sc.rtsp = nil
+	}
+}
+
+// serveMJPEG streams the camera's frames as they are played.
+func (sc *simCamera) serveMJPEG(w http.ResponseWriter, r *http.Request) {
+	part := startMJPEG(w)
+	for {
+		sc.mu.Lock()
+		data, changed := sc.jpeg, sc.changed
+		sc.mu.Unlock()
+		if data != nil {
+			if err := part(data); err != nil {
+				return
+			}
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// simPublisher encodes raw frames with ffmpeg and pushes them to an RTSP server.
+type simPublisher struct {
+	width, height int
+	rate          float64
+	cmd           *exec.Cmd
+	stdin         io.WriteCloser
+}
+
+func newSimPublisher(url string, rate float64, width, height int) (*simPublisher, error) {
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-f", "rawvideo", "-pix_fmt", "bgr24",
+		"-s", fmt.Sprintf("%dx%d", width, height), "-r", strconv.FormatFloat(rate, 'f', -1, 64), "-i", "-",
+		"-an", "-c:v", "libx264", "-preset", "ultrafast", "-tune", "zerolatency", "-pix_fmt", "yuv420p",
+		"-f", "rtsp", "-rtsp_transport", "tcp", url)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &simPublisher{width: width, height: height, rate: rate, cmd: cmd, stdin: stdin}, nil
+}
+
+func (p *simPublisher) Write(frame gocv.Mat) error {
+	_, err := p.stdin.Write(frame.ToBytes())
+	return err
+}
+
+// Close ends the stream. It is a no-op on a nil publisher.
+func (p *simPublisher) Close() {
+	if p == nil {
+		return
+	}
+	_ = p.stdin.Close()
+	_ = p.cmd.Wait()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+var rawFormats = map[string]int{"bgr24": 3, "rgb24": 3, "gray": 1}
+
+// RawSink streams tightly packed raw frames of one camera to a writer. Frames are handed
+// to a goroutine through a small queue and dropped if the consumer falls behind, so a slow
+// reader never stalls recording.
+type RawSink struct {
+	name   string
+	camID  int
+	format string
+	frames chan []byte
+}
+
+type sinkSpec struct {
+	camID  int
+	format string
+	path   string
+}
+
+// parseSinkSpec parses "cam=N[,fmt=bgr24|rgb24|gray][,path=P]".
+func parseSinkSpec(spec string) (sinkSpec, error) {
+	s := sinkSpec{camID: allCameras, format: "bgr24"}
+	for _, part := range strings.Split(spec, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return s, fmt.Errorf("invalid option %q, expected key=value", part)
+		}
+		switch k {
+		case "cam":
+			id, err := strconv.Atoi(v)
+			if err != nil || id < 0 {
+				return s, fmt.Errorf("invalid camera %q", v)
+			}
+			s.camID = id
+		case "fmt":
+			if _, ok := rawFormats[v]; !ok {
+				return s, fmt.Errorf("unsupported format %q, use bgr24, rgb24 or gray", v)
+			}
+			s.format = v
+		case "path":
+			s.path = v
+		default:
+			return s, fmt.Errorf("unknown option %q", k)
+		}
+	}
+	if s.camID == allCameras {
+		return s, errors.New("cam is required")
+	}
+	return s, nil
+}
+
+// newRawSink starts a sink that obtains its writer from open. If reopen is set, a failed
+// write closes the writer and open is called again, e.g. to wait for the next FIFO reader.
+func newRawSink(name string, camID int, format string, open func() (io.WriteCloser, error), reopen bool) *RawSink {
+	s := &RawSink{name: name, camID: camID, format: format, frames: make(chan []byte, 2)}
+	go s.run(open, reopen)
+	return s
+}
+
+func (s *RawSink) run(open func() (io.WriteCloser, error), reopen bool) {
+	for {
+		w, err := open()
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to open %s: %v.", s.name, err))
+			return
+		}
+		logger.Info(fmt.Sprintf("Streaming cam %d as %s to %s.", s.camID, s.format, s.name))
+		for frame := range s.frames {
+			if _, err = w.Write(frame); err != nil {
+				break
+			}
+		}
+		_ = w.Close()
+		if err == nil {
+			return
+		}
+		logger.Info(fmt.Sprintf("Stopped streaming to %s: %v.", s.name, err))
+		if !reopen {
+			return
+		}
+	}
+}
+
+func (s *RawSink) Push(mat gocv.Mat) {
+	var data []byte
+	switch s.format {
+	case "bgr24":
+		data = mat.ToBytes()
+	default:
+		code := gocv.ColorBGRToRGB
+		if s.format == "gray" {
+			code = gocv.ColorBGRToGray
+		}
+		converted := gocv.NewMat()
+		defer converted.Close()
+		if err := gocv.CvtColor(mat, &converted, code); err != nil {
+			logger.Error(fmt.Sprintf("Failed to convert frame for %s: %v.", s.name, err))
+			return
+		}
+		data = converted.ToBytes()
+	}
+
+	select {
+	case s.frames <- data:
+	default:
+	}
+}
+
+func (s *RawSink) Close() {
+	close(s.frames)
+}
+
+func attachSinks(cameras []*Camera) {
+	for _, spec := range config.FIFOs {
+		s, err := parseSinkSpec(spec)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Invalid fifo %q: %v.", spec, err))
+			continue
+		}
+		cam := findCamera(cameras, s.camID)
+		if cam == nil {
+			logger.Error(fmt.Sprintf("Fifo %s: camera %d is not open.", s.path, s.camID))
+			continue
+		}
+		if err = makeFifo(s.path); err != nil {
+			logger.Error(fmt.Sprintf("Failed to create fifo %s: %v.", s.path, err))
+			continue
+		}
+		path := s.path
+		cam.Sinks = append(cam.Sinks, newRawSink(path, cam.ID, s.format, func() (io.WriteCloser, error) {
+			return openFifo(path)
+		}, true))
+	}
+
+	if config.PipeStdout != "" {
+		s, err := parseSinkSpec(config.PipeStdout)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Invalid pipe-stdout %q: %v.", config.PipeStdout, err))
+			return
+		}
+		cam := findCamera(cameras, s.camID)
+		if cam == nil {
+			logger.Error(fmt.Sprintf("Stdout: camera %d is not open.", s.camID))
+			return
+		}
+		cam.Sinks = append(cam.Sinks, newRawSink("stdout", cam.ID, s.format, func() (io.WriteCloser, error) {
+			return os.Stdout, nil
+		}, false))
+	}
+}
+
+func findCamera(cameras []*Camera, id int) *Camera {
+	for _, cam := range cameras {
+		if cam.ID == id {
+			return cam
+		}
+	}
+	return nil
+}
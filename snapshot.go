@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	snapshotJPEG = "jpg"
+	snapshotPNG  = "png"
+)
+
+func validateSnapshotFormat(s string) error {
+	if s != snapshotJPEG && s != snapshotPNG {
+		return fmt.Errorf("snapshot format must be %s or %s", snapshotJPEG, snapshotPNG)
+	}
+	return nil
+}
+
+func validateSnapshotInterval(d time.Duration) error {
+	if d != 0 && d < time.Second {
+		return errors.New("snapshot interval must be at least 1s, or 0 to disable")
+	}
+	return nil
+}
+
+// saveSnapshot writes a still of cam into --snapshot-dir as snapshot_cam<id>_<unix>[_<suffix>].<format>,
+// with its lens and pose in a .json next to it.
+func saveSnapshot(mat gocv.Mat, cam *Camera, at time.Time, suffix string) {
+	_ = os.MkdirAll(config.SnapshotDir, os.ModePerm)
+	name := fmt.Sprintf("snapshot_cam%d_%d", cam.ID, at.Unix())
+	if suffix != "" {
+		name += "_" + suffix
+	}
+	filename := uniquePath(filepath.Join(config.SnapshotDir, name+"."+config.SnapshotFormat))
+	ok := false
+	if config.SnapshotFormat == snapshotJPEG {
+		ok = gocv.IMWriteWithParams(filename, mat, []int{gocv.IMWriteJpegQuality, config.SnapshotQuality})
+	} else {
+		ok = gocv.IMWrite(filename, mat)
+	}
+	if ok {
+		cam.writeSnapshotMeta(filename, mat.Cols(), mat.Rows(), at)
+		logger.Info(fmt.Sprintf("Saved snapshot: %s", filename))
+	} else {
+		logger.Info("Failed to save snapshot.")
+	}
+}
+
+// renderSnapshot turns a captured frame into a still, oriented like the recording and with the overlay
+// if --snapshot-overlay; the frame itself is left untouched.
+func (c *Camera) renderSnapshot(frame *gocv.Mat) gocv.Mat {
+	still := c.transformFrame(frame, c.Rotation, c.Mirror)
+	if config.SnapshotOverlay {
+		c.addOverlay(&still)
+	}
+	return still
+}
+
+func (c *Camera) saveStill(at time.Time, suffix string) {
+	still := c.renderSnapshot(&c.Frame)
+	saveSnapshot(still, c, at, suffix)
+	_ = still.Close()
+}
+
+func takeSnapshots(cameras []*Camera, camID int) {
+	for _, cam := range cameras {
+		if camID != allCameras && cam.ID != camID {
+			continue
+		}
+		cam.do(func() {
+			if cam.Frame.Empty() {
+				logger.Warn(fmt.Sprintf("Cam %d has no frame to snapshot.", cam.ID))
+				return
+			}
+			cam.saveStill(time.Now(), "")
+		})
+	}
+}
+
+// startBursts makes the cameras save their next --snapshot-burst frames as stills.
+func startBursts(cameras []*Camera, camID int) {
+	for _, cam := range cameras {
+		if camID != allCameras && cam.ID != camID {
+			continue
+		}
+		cam.do(func() {
+			if cam.burstLeft > 0 {
+				return
+			}
+			cam.burstLeft, cam.burstStart = config.SnapshotBurst, time.Now()
+			logger.Info(fmt.Sprintf("Cam %d: saving a burst of %d frames.", cam.ID, config.SnapshotBurst))
+		})
+	}
+}
+
+// autoSnapshot saves the current frame while a burst runs, and every --snapshot-interval while armed.
+func (c *Camera) autoSnapshot(at time.Time) {
+	if c.burstLeft > 0 {
+		c.saveStill(c.burstStart, fmt.Sprintf("%03d", config.SnapshotBurst-c.burstLeft+1))
+		c.burstLeft--
+		return
+	}
+	if config.SnapshotInterval > 0 && armed() && !c.Paused() && at.Sub(c.lastSnapshot) >= config.SnapshotInterval {
+		c.lastSnapshot = at
+		c.saveStill(at, "")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	// stallTimeout without frames after which a camera is reopened.
+	stallTimeout        = 3 * time.Second
+	maxReconnectBackoff = 30 * time.Second
+)
+
+type sourceSpec struct {
+	camID int
+	url   string
+}
+
+// parseSourceSpec parses "[id=]url" where url is an rtsp(s) or http(s) stream; camID is -1 when not given.
+func parseSourceSpec(spec string) (sourceSpec, error) {
+	s := sourceSpec{camID: -1, url: spec}
+	if id, rest, ok := strings.Cut(spec, "="); ok && !strings.Contains(id, "://") {
+		n, err := strconv.Atoi(id)
+		if err != nil || n < 0 {
+			return s, fmt.Errorf("invalid camera id %q", id)
+		}
+		s.camID, s.url = n, rest
+	}
+	u, err := url.Parse(s.url)
+	if err != nil {
+		return s, err
+	}
+	switch u.Scheme {
+	case "rtsp", "rtsps", "http", "https":
+	default:
+		return s, fmt.Errorf("unsupported source %q, expected an rtsp:// or http(s):// URL", redactURL(s.url))
+	}
+	return s, nil
+}
+
+// redactURL hides credentials embedded in a stream URL before it is logged or saved.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// networkCameraSettings assigns camera IDs to --source URLs, using free IDs after the local cameras when none is given.
+func networkCameraSettings(localIDs []int) []CameraConfig {
+	used := slices.Clone(localIDs)
+	var specs []sourceSpec
+	for _, raw := range config.Sources {
+		s, _ := parseSourceSpec(raw)
+		if s.camID >= 0 {
+			used = append(used, s.camID)
+		}
+		specs = append(specs, s)
+	}
+
+	var settings []CameraConfig
+	next := 0
+	for _, s := range specs {
+		if s.camID < 0 {
+			for slices.Contains(used, next) {
+				next++
+			}
+			s.camID = next
+			used = append(used, next)
+		}
+		cs := cameraSettings(s.camID)
+		cs.Source = s.url
+		settings = append(settings, cs)
+	}
+	return settings
+}
+
+func openCapture(settings CameraConfig) (*gocv.VideoCapture, error) {
+	if settings.Pipeline != "" {
+		return gocv.OpenVideoCaptureWithAPI(settings.Pipeline, gocv.VideoCaptureGstreamer)
+	}
+	if settings.Source != "" {
+		return openDevice(settings.Source, settings.Backend)
+	}
+	return openDevice(settings.ID, settings.Backend)
+}
+
+// reconnect reopens a device or network source that stopped delivering frames, backing off between
+// attempts. Writing continues in a new segment once frames arrive again.
+func (c *Camera) reconnect() {
+	if time.Now().Before(c.reconnectAt) {
+		return
+	}
+	if last := c.lastFrameAt.Load(); last != 0 && time.Since(time.Unix(0, last)) < stallTimeout {
+		return
+	}
+
+	c.reconnectBackoff = min(max(2*c.reconnectBackoff, time.Second), maxReconnectBackoff)
+	c.reconnectAt = time.Now().Add(c.reconnectBackoff)
+	if !c.offline {
+		_ = c.Capture.Close()
+		c.offline = true
+		publishStatus(StatusEvent{Type: statusCameraLost, CamID: c.ID, Note: "no frames from " + c.sourceName()})
+	}
+	capture, err := c.reopen()
+	if err != nil || !capture.IsOpened() {
+		if capture != nil {
+			_ = capture.Close()
+		}
+		logger.Error(fmt.Sprintf("Cam %d: failed to reconnect to %s, retrying in %v.", c.ID, c.sourceName(), c.reconnectBackoff))
+		return
+	}
+	c.Capture = capture
+	c.offline = false
+	c.reopened = true
+	c.reconnectBackoff = 0
+	c.reconnects.Add(1)
+	logger.Info(fmt.Sprintf("Cam %d reconnected to %s.", c.ID, c.sourceName()))
+	publishStatus(StatusEvent{Type: statusCameraOpened, CamID: c.ID, Note: "reconnected to " + c.sourceName()})
+}
+
+// negotiatedMode reads back the mode a device actually accepted, since Set fails silently, and
+// returns it so files are written at the real size and rate. The size is taken from a frame when one
+// can be read, as some backends report the requested size regardless.
+func negotiatedMode(capture *gocv.VideoCapture, id int, width, height, fps float64) (float64, float64, float64) {
+	w, h := capture.Get(gocv.VideoCaptureFrameWidth), capture.Get(gocv.VideoCaptureFrameHeight)
+	frame := gocv.NewMat()
+	if capture.Read(&frame) && !frame.Empty() {
+		w, h = float64(frame.Cols()), float64(frame.Rows())
+	}
+	_ = frame.Close()
+	f := capture.Get(gocv.VideoCaptureFPS)
+
+	if w > 0 && h > 0 && (w != width || h != height) {
+		logger.Warn(fmt.Sprintf("Cam %d delivers %.0fx%.0f instead of the requested %.0fx%.0f, recording at %.0fx%.0f.", id, w, h, width, height, w, h))
+		width, height = w, h
+	}
+	if f > 0 && f <= 240 && math.Abs(f-fps) > 0.01 {
+		logger.Warn(fmt.Sprintf("Cam %d runs at %.2f fps instead of the requested %.2f, recording at %.2f fps.", id, f, fps, f))
+		fps = f
+	}
+	return width, height, fps
+}
+
+// reopen opens the camera again, asking a local device for the mode it was first opened with.
+func (c *Camera) reopen() (*gocv.VideoCapture, error) {
+	if c.Pipeline != "" {
+		return gocv.OpenVideoCaptureWithAPI(c.Pipeline, gocv.VideoCaptureGstreamer)
+	}
+	if c.Source != "" {
+		return openDevice(c.Source, c.Backend)
+	}
+	capture, err := openDevice(c.ID, c.Backend)
+	if err != nil {
+		return capture, err
+	}
+	if config.InputFourCC != "" {
+		capture.Set(gocv.VideoCaptureFOURCC, capture.ToCodec(config.InputFourCC))
+	}
+	capture.Set(gocv.VideoCaptureFrameWidth, float64(c.Width))
+	capture.Set(gocv.VideoCaptureFrameHeight, float64(c.Height))
+	capture.Set(gocv.VideoCaptureFPS, c.FPS)
+	if c.rawMJPEG {
+		rawCapture(capture)
+	}
+	return capture, nil
+}
+
+func (c *Camera) sourceName() string {
+	if c.Pipeline != "" {
+		return "GStreamer pipeline"
+	}
+	if c.Source != "" {
+		return redactURL(c.Source)
+	}
+	return fmt.Sprintf("device %d", c.ID)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	statusFramesInterval = 5 * time.Second
+	statusQueue          = 64
+)
+
+// StatusEvent is pushed to clients of GET /api/v1/events. CamID is allCameras for events that are
+// not about one camera, such as disk warnings.
+type StatusEvent struct {
+	Time   time.Time `json:"time"`
+	Type   string    `json:"type"`
+	CamID  int       `json:"camera"`
+	Source string    `json:"source,omitempty"`
+	Note   string    `json:"note,omitempty"`
+	File   string    `json:"file,omitempty"`
+
+	Frames *frameCounts `json:"frames,omitempty"`
+}
+
+type frameCounts struct {
+	Captured int64 `json:"captured"`
+	Written  int64 `json:"written"`
+	Dropped  int64 `json:"dropped"`
+}
+
+const (
+	statusCameraOpened   = "camera_opened"
+	statusCameraLost     = "camera_lost"
+	statusFrames         = "frames"
+	statusSegmentRotated = "segment_rotated"
+	statusDisk           = "disk"
+	statusMotion         = "motion"
+	statusMarker         = "marker"
+	statusTamper         = "tamper"
+)
+
+// statusHub fans status events out to the connected clients. A client that falls behind misses events
+// rather than holding up the cameras.
+type statusHub struct {
+	mu   sync.Mutex
+	subs map[chan StatusEvent]struct{}
+}
+
+var statusEvents = &statusHub{subs: map[chan StatusEvent]struct{}{}}
+
+func publishStatus(ev StatusEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	statusEvents.mu.Lock()
+	defer statusEvents.mu.Unlock()
+	for ch := range statusEvents.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (h *statusHub) subscribe() chan StatusEvent {
+	ch := make(chan StatusEvent, statusQueue)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *statusHub) unsubscribe(ch chan StatusEvent) {
+	h.mu.Lock()
+	delete(h.subs, ch)
+	h.mu.Unlock()
+}
+
+// handleEvents serves GET /api/v1/events as a WebSocket of JSON status events, with frame counts for
+// every camera each statusFramesInterval.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer ws.Close()
+	ch := statusEvents.subscribe()
+	defer statusEvents.unsubscribe(ch)
+	logger.Info(fmt.Sprintf("Event stream opened by %s.", r.RemoteAddr))
+
+	send := func(ev StatusEvent) bool {
+		data, err := json.Marshal(ev)
+		return err == nil && ws.WriteText(data) == nil
+	}
+	sendFrames := func() bool {
+		for _, cam := range s.cameras.Load() {
+			counts := &frameCounts{Captured: cam.framesCaptured.Load(), Written: cam.framesWritten.Load(), Dropped: cam.framesDropped.Load()}
+			if !send(StatusEvent{Time: time.Now(), Type: statusFrames, CamID: cam.ID, Frames: counts}) {
+				return false
+			}
+		}
+		return true
+	}
+
+	ticker := time.NewTicker(statusFramesInterval)
+	defer ticker.Stop()
+	if !sendFrames() {
+		return
+	}
+	for {
+		select {
+		case <-ws.Closed():
+			return
+		case ev := <-ch:
+			if !send(ev) {
+				return
+			}
+		case <-ticker.C:
+			if !sendFrames() {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// minFreeBytes below which the output directory counts as full.
+	minFreeBytes        = 64 << 20
+	outputCheckInterval = 2 * time.Second
+)
+
+var (
+	activeDir  atomic.Pointer[string]
+	failoverMu sync.Mutex
+)
+
+// activeOutputDir is where new recordings go: --output-dir until a failover to --fallback-dir.
+func activeOutputDir() string {
+	if dir := activeDir.Load(); dir != nil {
+		return *dir
+	}
+	return config.OutputDir
+}
+
+// probeOutputDir reports why dir cannot take more recordings, or nil if it can.
+func probeOutputDir(dir string) error {
+	if free, err := freeSpace(dir); err == nil && free < minFreeBytes {
+		return fmt.Errorf("only %d MiB free", free>>20)
+	}
+	f, err := os.CreateTemp(dir, ".probe-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte{0})
+	if err == nil {
+		err = f.Sync()
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return err
+}
+
+// checkOutputDir switches to the fallback directory once the active one is full, read-only or gone.
+// Switching is one-way; cameras notice the new directory and roll their writers over to it.
+func checkOutputDir(manifest *Manifest) {
+	if config.FallbackDir == "" {
+		return
+	}
+	failoverMu.Lock()
+	defer failoverMu.Unlock()
+
+	from := activeOutputDir()
+	if from == config.FallbackDir {
+		return
+	}
+	reason := probeOutputDir(from)
+	if reason == nil {
+		return
+	}
+	if err := os.MkdirAll(config.FallbackDir, os.ModePerm); err != nil {
+		logger.Error(fmt.Sprintf("Output directory %s is unusable (%v) and fallback %s failed: %v.", from, reason, config.FallbackDir, err))
+		return
+	}
+	if err := probeOutputDir(config.FallbackDir); err != nil {
+		logger.Error(fmt.Sprintf("Output directory %s is unusable (%v) and fallback %s failed: %v.", from, reason, config.FallbackDir, err))
+		return
+	}
+
+	to := config.FallbackDir
+	activeDir.Store(&to)
+	logger.Warn(fmt.Sprintf("Output directory %s is unusable (%v), switching to %s.", from, reason, to))
+	publishStatus(StatusEvent{Type: statusDisk, CamID: allCameras, Note: fmt.Sprintf("%s is unusable (%v), switched to %s", from, reason, to)})
+	if manifest != nil {
+		manifest.AddFailover(Failover{Time: time.Now(), From: from, To: to, Reason: reason.Error()})
+	}
+}
+
+func watchOutputDir(ctx context.Context, manifest *Manifest) {
+	ticker := time.NewTicker(outputCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkOutputDir(manifest)
+		}
+	}
+}
+
+// followOutputDir rolls the writer over once new recordings go to a different directory.
+func (c *Camera) followOutputDir() {
+	if c.Writer != nil && c.outputRoot != activeOutputDir() {
+		c.rolloverWriter()
+	}
+}
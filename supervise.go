@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// superviseHeartbeatEnv names the file a supervised recorder keeps touching; it holds the session ID.
+	superviseHeartbeatEnv = "MCAM_SUPERVISE_HEARTBEAT"
+	// superviseSessionEnv is the session a restarted recorder resumes.
+	superviseSessionEnv = "MCAM_SUPERVISE_SESSION"
+
+	heartbeatInterval     = time.Second
+	superviseRestartDelay = 2 * time.Second
+	superviseStopGrace    = 10 * time.Second
+)
+
+// supervised reports whether this process is the recorder run by a --supervise parent.
+func supervised() bool {
+	return os.Getenv(superviseHeartbeatEnv) != ""
+}
+
+// runSupervisor runs the recorder as a child with the same arguments and restarts it when it exits with
+// an error or writes no frames for --supervise-timeout, resuming its session, until it exits cleanly or
+// the supervisor is interrupted.
+func runSupervisor(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the recorder executable: %w", err)
+	}
+	f, err := os.CreateTemp("", "mcam-heartbeat-*")
+	if err != nil {
+		return fmt.Errorf("could not create heartbeat file: %w", err)
+	}
+	heartbeat := f.Name()
+	_ = f.Close()
+	defer os.Remove(heartbeat)
+
+	session := config.Resume
+	for restarts := 0; ; restarts++ {
+		child := exec.Command(exe, os.Args[1:]...)
+		child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+		child.Env = append(os.Environ(), superviseHeartbeatEnv+"="+heartbeat)
+		if session != "" {
+			child.Env = append(child.Env, superviseSessionEnv+"="+session)
+		}
+		now := time.Now()
+		_ = os.Chtimes(heartbeat, now, now)
+		if err := child.Start(); err != nil {
+			return fmt.Errorf("could not start the recorder: %w", err)
+		}
+		logger.Info(fmt.Sprintf("Supervising recorder (pid %d), restarts so far: %d.", child.Process.Pid, restarts))
+
+		hung, err := superviseChild(ctx, child, heartbeat)
+		if data, rErr := os.ReadFile(heartbeat); rErr == nil && len(data) > 0 {
+			session = strings.TrimSpace(string(data))
+		}
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case hung:
+			logger.Warn(fmt.Sprintf("Recorder wrote no frames for %v, restarting it.", superviseTimeout()))
+		case err != nil:
+			logger.Warn(fmt.Sprintf("Recorder exited: %v, restarting it.", err))
+		default:
+			logger.Info("Recorder finished.")
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(superviseRestartDelay):
+		}
+	}
+}
+
+// superviseChild waits for child, stopping it when ctx is done or its heartbeat goes stale, which it
+// reports as hung.
+func superviseChild(ctx context.Context, child *exec.Cmd, heartbeat string) (hung bool, err error) {
+	done := make(chan error, 1)
+	go func() { done <- child.Wait() }()
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return false, err
+		case <-ctx.Done():
+			return false, stopChild(child, done)
+		case now := <-ticker.C:
+			if fi, err := os.Stat(heartbeat); err == nil && now.Sub(fi.ModTime()) > superviseTimeout() {
+				_ = stopChild(child, done)
+				return true, nil
+			}
+		}
+	}
+}
+
+// superviseTimeout is --supervise-timeout, or two timelapse intervals if those are longer.
+func superviseTimeout() time.Duration {
+	interval := config.TimelapseStep
+	if config.TimelapseEvery > 1 {
+		interval = time.Duration(float64(config.TimelapseEvery) / config.FPS * float64(time.Second))
+	}
+	return max(config.SuperviseTimeout, 2*interval)
+}
+
+// stopChild asks child to stop and kills it if it has not within superviseStopGrace.
+func stopChild(child *exec.Cmd, done <-chan error) error {
+	if err := child.Process.Signal(syscall.SIGTERM); err != nil {
+		_ = child.Process.Kill()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(superviseStopGrace):
+		logger.Warn(fmt.Sprintf("Recorder (pid %d) did not stop, killing it.", child.Process.Pid))
+		_ = child.Process.Kill()
+		return <-done
+	}
+}
+
+// Heartbeat tells a --supervise parent that the recorder is alive by touching its file while frames are
+// written, or while no camera is meant to be writing.
+type Heartbeat struct {
+	path    string
+	cameras cameraList
+}
+
+// startHeartbeat starts the heartbeat of a supervised recorder, or returns nil when it is not supervised.
+func startHeartbeat(ctx context.Context, cameras []*Camera, sessionID string) *Heartbeat {
+	path := os.Getenv(superviseHeartbeatEnv)
+	if path == "" {
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(sessionID), 0o600); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write heartbeat %s: %v.", path, err))
+	}
+	h := &Heartbeat{path: path}
+	h.cameras.Store(cameras)
+	go h.run(ctx)
+	return h
+}
+
+func (h *Heartbeat) setCameras(cameras []*Camera) {
+	if h == nil {
+		return
+	}
+	h.cameras.Store(cameras)
+}
+
+func (h *Heartbeat) run(ctx context.Context) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	var last int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			var written int64
+			expected := false
+			for _, cam := range h.cameras.Load() {
+				written += cam.framesWritten.Load()
+				expected = expected || cam.Recording() && !cam.Paused()
+			}
+			if written != last || !expected || !armed() || privacy.Load() {
+				_ = os.Chtimes(h.path, now, now)
+			}
+			last = written
+		}
+	}
+}
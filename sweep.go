@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gocv.io/x/gocv"
+)
+
+// sweepRange is a from:to:step series of values for a capture property.
+type sweepRange struct {
+	from, to, step float64
+}
+
+func parseSweepRange(s string) (sweepRange, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return sweepRange{}, fmt.Errorf("invalid range %q, expected from:to:step, e.g. -13:-1:1", s)
+	}
+	var v [3]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return sweepRange{}, fmt.Errorf("invalid range %q, expected from:to:step, e.g. -13:-1:1", s)
+		}
+		v[i] = f
+	}
+	r := sweepRange{from: v[0], to: v[1], step: v[2]}
+	if r.step <= 0 || r.to < r.from {
+		return sweepRange{}, fmt.Errorf("range %q needs from no greater than to and a step greater than zero", s)
+	}
+	return r, nil
+}
+
+// values lists the range, or a single NaN when it is unset so the property is left as it is.
+func (r sweepRange) values() []float64 {
+	if r.step == 0 {
+		return []float64{math.NaN()}
+	}
+	var v []float64
+	for i := 0; ; i++ {
+		x := r.from + float64(i)*r.step
+		if x > r.to+r.step*1e-9 {
+			return v
+		}
+		v = append(v, x)
+	}
+}
+
+func sweepCommand() *cli.Command {
+	validate := func(s string) error {
+		_, err := parseSweepRange(s)
+		return err
+	}
+	return &cli.Command{
+		Name:      "sweep",
+		Usage:     "Record one camera while stepping it through exposure and gain values, logging the settings of every frame",
+		ArgsUsage: "<camera-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "exposure", Usage: "Exposure values as from:to:step in the backend's units, e.g. -13:-1:1", Validator: validate},
+			&cli.StringFlag{Name: "gain", Usage: "Gain values as from:to:step, e.g. 0:100:10", Validator: validate},
+			&cli.IntFlag{Name: "frames-per-step", Usage: "Frames recorded at each setting", Value: 10, Validator: func(n int) error {
+				if n < 1 {
+					return errors.New("frames per step must be at least 1")
+				}
+				return nil
+			}},
+			&cli.IntFlag{Name: "settle", Usage: "Frames discarded after each change while the sensor settles", Value: 5, Validator: func(n int) error {
+				if n < 0 {
+					return errors.New("settle must not be negative")
+				}
+				return nil
+			}},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := setup(cmd); err != nil {
+				return err
+			}
+			id, err := strconv.Atoi(cmd.Args().First())
+			if cmd.Args().Len() != 1 || err != nil || id < 0 {
+				return errors.New("sweep takes the camera ID, e.g. sweep 0 --exposure -13:-1:1")
+			}
+			if !cmd.IsSet("exposure") && !cmd.IsSet("gain") {
+				return errors.New("sweep needs --exposure, --gain or both")
+			}
+			var exposure, gain sweepRange
+			if cmd.IsSet("exposure") {
+				exposure, _ = parseSweepRange(cmd.String("exposure"))
+			}
+			if cmd.IsSet("gain") {
+				gain, _ = parseSweepRange(cmd.String("gain"))
+			}
+			return sweepCamera(ctx, cameraSettings(id), exposure, gain, cmd.Int("frames-per-step"), cmd.Int("settle"))
+		},
+	}
+}
+
+// sweepCamera records every exposure and gain combination, frames per step each after settle frames, into
+// sweep_cam<id>_<unix>.<container> with a .csv listing the requested and read back settings of each frame.
+func sweepCamera(ctx context.Context, s CameraConfig, exposure, gain sweepRange, framesPerStep, settle int) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	capture, err := openCapture(s)
+	if err != nil || !capture.IsOpened() {
+		return fmt.Errorf("could not open camera %d", s.ID)
+	}
+	defer capture.Close()
+	width, height, fps := s.Width, s.Height, s.FPS
+	if !s.fixedMode() {
+		if config.InputFourCC != "" {
+			capture.Set(gocv.VideoCaptureFOURCC, capture.ToCodec(config.InputFourCC))
+		}
+		capture.Set(gocv.VideoCaptureFrameWidth, width)
+		capture.Set(gocv.VideoCaptureFrameHeight, height)
+		capture.Set(gocv.VideoCaptureFPS, fps)
+		width, height, fps = negotiatedMode(capture, s.ID, width, height, fps)
+	}
+	if !math.IsNaN(exposure.values()[0]) {
+		capture.Set(gocv.VideoCaptureAutoExposure, manualExposure())
+	}
+
+	_ = os.MkdirAll(config.OutputDir, os.ModePerm)
+	base := filepath.Join(config.OutputDir, fmt.Sprintf("sweep_cam%d_%d", s.ID, time.Now().Unix()))
+	writer, err := newFrameWriter(base+"."+config.Container, s.Codec, fps, int(width), int(height))
+	if err != nil {
+		return fmt.Errorf("could not open sweep writer for camera %d: %w", s.ID, err)
+	}
+	defer writer.Close()
+	f, err := os.Create(base + ".csv")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	log := csv.NewWriter(f)
+	defer log.Flush()
+	_ = log.Write([]string{"frame", "time", "exposure", "gain", "exposure_read", "gain_read", "mean"})
+
+	mat := gocv.NewMat()
+	defer mat.Close()
+	frame := 0
+	exposures, gains := exposure.values(), gain.values()
+	logger.Info(fmt.Sprintf("Sweeping cam %d through %d setting(s) into %s.", s.ID, len(exposures)*len(gains), base+"."+config.Container))
+	for _, e := range exposures {
+		for _, g := range gains {
+			if ctx.Err() != nil {
+				logger.Info(fmt.Sprintf("Sweep interrupted after %d frames.", frame))
+				return nil
+			}
+			if !math.IsNaN(e) {
+				capture.Set(gocv.VideoCaptureExposure, e)
+			}
+			if !math.IsNaN(g) {
+				capture.Set(gocv.VideoCaptureGain, g)
+			}
+			for range settle {
+				capture.Read(&mat)
+			}
+			readE, readG := capture.Get(gocv.VideoCaptureExposure), capture.Get(gocv.VideoCaptureGain)
+			logger.Info(fmt.Sprintf("Exposure %s, gain %s (camera reports %g, %g).", sweepValue(e), sweepValue(g), readE, readG))
+			for range framesPerStep {
+				if !capture.Read(&mat) || mat.Empty() {
+					continue
+				}
+				at := time.Now()
+				if err := writer.Write(mat); err != nil {
+					return fmt.Errorf("could not write camera %d: %w", s.ID, err)
+				}
+				_ = log.Write([]string{strconv.Itoa(frame), at.Format(time.RFC3339Nano), sweepValue(e), sweepValue(g),
+					strconv.FormatFloat(readE, 'g', -1, 64), strconv.FormatFloat(readG, 'g', -1, 64),
+					strconv.FormatFloat(meanLuma(mat), 'f', 2, 64)})
+				frame++
+			}
+			log.Flush()
+		}
+	}
+	logger.Info(fmt.Sprintf("Sweep done, %d frames with their settings in %s.", frame, base+".csv"))
+	return nil
+}
+
+// manualExposure is the auto-exposure value that turns it off: V4L2's manual mode on Linux, 0.25 elsewhere.
+func manualExposure() float64 {
+	if runtime.GOOS == "linux" {
+		return 1
+	}
+	return 0.25
+}
+
+func sweepValue(v float64) string {
+	if math.IsNaN(v) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// meanLuma is the mean Rec. 601 luma of a BGR frame.
+func meanLuma(mat gocv.Mat) float64 {
+	m := mat.Mean()
+	return 0.114*m.Val1 + 0.587*m.Val2 + 0.299*m.Val3
+}
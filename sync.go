@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli/v3"
+	"gocv.io/x/gocv"
+)
+
+const (
+	syncFlash = "flash"
+	syncClap  = "clap"
+
+	// syncFlashJump is the rise in mean brightness, out of 255, from one frame to the next that counts as a flash.
+	syncFlashJump = 40
+
+	// Audio is measured in blocks of syncClapBlock samples (5ms); a clap is a block syncClapRatio times
+	// louder than the loudest of the syncClapQuiet blocks before it.
+	syncSampleRate = 16000
+	syncClapBlock  = 80
+	syncClapQuiet  = 20
+	syncClapRatio  = 8
+)
+
+// SyncReport aligns the first recording of every camera on a flash or clap seen by all of them.
+type SyncReport struct {
+	Method     string       `json:"method"`
+	AnalyzedAt time.Time    `json:"analyzed_at"`
+	Files      []SyncedFile `json:"files"`
+}
+
+// SyncedFile places the sync event in one recording. OffsetMs is how far the file must be delayed
+// for its event to line up with the file that saw it latest.
+type SyncedFile struct {
+	Camera       int     `json:"camera"`
+	File         string  `json:"file"`
+	EventMs      float64 `json:"event_ms"`
+	OffsetMs     float64 `json:"offset_ms"`
+	OffsetFrames float64 `json:"offset_frames"`
+}
+
+func validateSyncMethod(s string) error {
+	if s != syncFlash && s != syncClap {
+		return fmt.Errorf("sync method must be %s or %s", syncFlash, syncClap)
+	}
+	return nil
+}
+
+func syncCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "sync",
+		Usage:     "Find a sync flash or clap in the recordings of a session and write their offsets into its manifest",
+		ArgsUsage: "<session-id>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "by", Usage: "Sync event to look for: an LED or camera flash, or an audio clap (flash, clap)", Value: syncFlash, Validator: validateSyncMethod},
+			&cli.DurationFlag{Name: "window", Usage: "How far into each recording to look for the sync event", Value: 30 * time.Second, Validator: func(d time.Duration) error {
+				if d <= 0 {
+					return errors.New("sync window must be greater than zero")
+				}
+				return nil
+			}},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := setup(cmd); err != nil {
+				return err
+			}
+			if cmd.Args().Len() != 1 {
+				return errors.New("sync takes the session ID, e.g. sync 1714557600")
+			}
+			return syncSession(ctx, cmd.Args().First(), cmd.String("by"), cmd.Duration("window"))
+		},
+	}
+}
+
+// syncSession finds the sync event in the first recording of each camera of a session.
+func syncSession(ctx context.Context, sessionID, method string, window time.Duration) error {
+	m, err := readManifest(config.OutputDir, sessionID)
+	if err != nil {
+		return fmt.Errorf("could not open session %s: %w", sessionID, err)
+	}
+	if method == syncClap {
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			return errors.New("ffmpeg is required to find a clap but was not found in PATH")
+		}
+	}
+
+	report := &SyncReport{Method: method, AnalyzedAt: time.Now()}
+	fps := map[int]float64{}
+	for _, cam := range m.Cameras {
+		if len(cam.Files) == 0 {
+			continue
+		}
+		path := m.absPath(cam.Files[0])
+		if method == syncClap && cam.Audio == "" {
+			logger.Warn(fmt.Sprintf("Cam %d was recorded without audio, skipping %s.", cam.ID, cam.Files[0]))
+			continue
+		}
+		var at time.Duration
+		if method == syncClap {
+			at, err = findClap(ctx, path, window)
+		} else {
+			at, err = findFlash(path, window)
+		}
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Cam %d: no %s found in %s: %v.", cam.ID, method, cam.Files[0], err))
+			continue
+		}
+		logger.Info(fmt.Sprintf("Cam %d: %s at %v in %s.", cam.ID, method, at, cam.Files[0]))
+		report.Files = append(report.Files, SyncedFile{Camera: cam.ID, File: cam.Files[0], EventMs: durationMs(at)})
+		fps[cam.ID] = cam.FPS
+	}
+	if len(report.Files) < 2 {
+		return fmt.Errorf("the %s was found in %d recording(s), at least 2 are needed", method, len(report.Files))
+	}
+
+	latest := slices.MaxFunc(report.Files, func(a, b SyncedFile) int { return cmp.Compare(a.EventMs, b.EventMs) }).EventMs
+	for i := range report.Files {
+		f := &report.Files[i]
+		f.OffsetMs = latest - f.EventMs
+		f.OffsetFrames = f.OffsetMs / 1000 * fps[f.Camera]
+		logger.Info(fmt.Sprintf("Cam %d: delay %s by %.1f ms (%.2f frames).", f.Camera, f.File, f.OffsetMs, f.OffsetFrames))
+	}
+
+	m.mu.Lock()
+	if m.Offsets == nil {
+		m.Offsets = &OffsetReport{Files: []FileOffset{}}
+	}
+	m.Offsets.Sync = report
+	m.mu.Unlock()
+	m.Save()
+	return nil
+}
+
+// findFlash returns the position of the frame where the picture brightens most, if that is a flash.
+func findFlash(path string, window time.Duration) (time.Duration, error) {
+	video, err := gocv.VideoCaptureFile(path)
+	if err != nil {
+		return 0, err
+	}
+	defer video.Close()
+	fps := video.Get(gocv.VideoCaptureFPS)
+	if fps <= 0 {
+		return 0, errors.New("unknown frame rate")
+	}
+
+	frame, small := gocv.NewMat(), gocv.NewMat()
+	defer frame.Close()
+	defer small.Close()
+	prev, best, bestFrame := -1.0, 0.0, -1
+	for n := 0; float64(n) < window.Seconds()*fps && video.Read(&frame) && !frame.Empty(); n++ {
+		_ = gocv.Resize(frame, &small, image.Pt(64, max(1, frame.Rows()*64/max(1, frame.Cols()))), 0, 0, gocv.InterpolationArea)
+		_ = gocv.CvtColor(small, &small, gocv.ColorBGRToGray)
+		brightness := small.Mean().Val1
+		if prev >= 0 && brightness-prev > best {
+			best, bestFrame = brightness-prev, n
+		}
+		prev = brightness
+	}
+	if best < syncFlashJump {
+		return 0, fmt.Errorf("the brightest jump is %.0f of %d needed", best, syncFlashJump)
+	}
+	return time.Duration(float64(bestFrame) / fps * float64(time.Second)), nil
+}
+
+// findClap decodes the audio of a recording with ffmpeg and returns the position of the sharpest onset.
+func findClap(ctx context.Context, path string, window time.Duration) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-hide_banner", "-loglevel", "error", "-nostdin", "-i", path,
+		"-t", strconv.FormatFloat(window.Seconds(), 'f', 3, 64), "-vn", "-ac", "1", "-ar", strconv.Itoa(syncSampleRate), "-f", "s16le", "-")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err = cmd.Start(); err != nil {
+		return 0, err
+	}
+	var levels []float64
+	r := bufio.NewReader(out)
+	block := make([]byte, 2*syncClapBlock)
+	for {
+		if _, err = io.ReadFull(r, block); err != nil {
+			break
+		}
+		var sum float64
+		for i := 0; i < len(block); i += 2 {
+			s := float64(int16(binary.LittleEndian.Uint16(block[i:])))
+			sum += s * s
+		}
+		levels = append(levels, math.Sqrt(sum/syncClapBlock))
+	}
+	if err := cmd.Wait(); err != nil {
+		return 0, fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	best, bestBlock := 0.0, -1
+	for i := syncClapQuiet; i < len(levels); i++ {
+		quiet := slices.Max(levels[i-syncClapQuiet : i])
+		if ratio := levels[i] / max(quiet, 1); ratio > best {
+			best, bestBlock = ratio, i
+		}
+	}
+	if best < syncClapRatio {
+		return 0, errors.New("no sound stands out from the background")
+	}
+	return time.Duration(bestBlock*syncClapBlock) * time.Second / syncSampleRate, nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	tamperWidth    = 160
+	tamperInterval = 500 * time.Millisecond
+	// tamperSustain is how long the picture must stay dark or blurred before it counts, and stay fine
+	// before the tamper is cleared.
+	tamperSustain = 2 * time.Second
+	// tamperFollow is how quickly the reference follows gradual changes like dusk or slow refocusing.
+	tamperFollow = 0.05
+
+	tamperDark = 15
+	// tamperBlur is the fraction of the reference sharpness below which the view counts as blurred.
+	tamperBlur = 0.2
+	// tamperMoved is the fraction of the view that must change for good to count as repositioned.
+	tamperMoved = 0.6
+
+	tamperHookTimeout = 10 * time.Second
+
+	tamperCleared = "tamper cleared"
+)
+
+type tamperSample struct {
+	brightness float64
+	sharpness  float64
+}
+
+// TamperDetector reports a camera being covered, sprayed or defocused, and being turned away from its
+// view. Only sudden changes count; the reference follows gradual ones.
+type TamperDetector struct {
+	next   time.Time
+	ref    tamperSample
+	refSet bool
+	since  time.Time
+	active bool
+	view   SceneDetector
+}
+
+func sampleTamper(frame gocv.Mat) tamperSample {
+	grey, lap := gocv.NewMat(), gocv.NewMat()
+	mean, stddev := gocv.NewMat(), gocv.NewMat()
+	defer grey.Close()
+	defer lap.Close()
+	defer mean.Close()
+	defer stddev.Close()
+	height := max(1, frame.Rows()*tamperWidth/max(1, frame.Cols()))
+	_ = gocv.Resize(frame, &grey, image.Pt(tamperWidth, height), 0, 0, gocv.InterpolationArea)
+	_ = gocv.CvtColor(grey, &grey, gocv.ColorBGRToGray)
+	_ = gocv.Laplacian(grey, &lap, gocv.MatTypeCV64F, 1, 1, 0, gocv.BorderDefault)
+	_ = gocv.MeanStdDev(lap, &mean, &stddev)
+	sd := stddev.GetDoubleAt(0, 0)
+	return tamperSample{brightness: grey.Mean().Val1, sharpness: sd * sd}
+}
+
+// Detect returns a note and true when the camera has just been tampered with, or the tamper cleared.
+func (d *TamperDetector) Detect(frame gocv.Mat, at time.Time) (string, bool) {
+	if at.Before(d.next) {
+		return "", false
+	}
+	d.next = at.Add(tamperInterval)
+	s := sampleTamper(frame)
+	if !d.refSet {
+		d.ref, d.refSet = s, true
+		return "", false
+	}
+
+	reason := ""
+	switch {
+	case s.brightness < tamperDark && d.ref.brightness >= 2*tamperDark:
+		reason = "covered, the picture went dark"
+	case s.sharpness < d.ref.sharpness*tamperBlur:
+		reason = fmt.Sprintf("blurred, sharpness down %.0f%%", 100*(1-s.sharpness/d.ref.sharpness))
+	}
+	if reason == "" && !d.active {
+		d.ref.brightness += tamperFollow * (s.brightness - d.ref.brightness)
+		d.ref.sharpness += tamperFollow * (s.sharpness - d.ref.sharpness)
+		if changed, ok := d.view.Detect(frame, at, tamperMoved); ok {
+			return fmt.Sprintf("repositioned, %.0f%% of the view changed", changed*100), true
+		}
+	}
+
+	if (reason != "") == d.active {
+		d.since = time.Time{}
+		return "", false
+	}
+	if d.since.IsZero() {
+		d.since = at
+	}
+	if at.Sub(d.since) < tamperSustain {
+		return "", false
+	}
+	d.active, d.since = reason != "", time.Time{}
+	if !d.active {
+		return tamperCleared, true
+	}
+	return reason, true
+}
+
+func (d *TamperDetector) Close() {
+	d.view.Close()
+}
+
+// detectTamper raises a tamper event: a warning, a marker, an event for --event-clips, a status event
+// and the --tamper-webhook and --tamper-exec hooks.
+func (c *Camera) detectTamper(mat gocv.Mat, at time.Time) {
+	note, ok := c.tamper.Detect(mat, at)
+	if !ok {
+		return
+	}
+	logger.Warn(fmt.Sprintf("Cam %d tamper: %s.", c.ID, note))
+	ev := Event{Time: at, CamID: c.ID, Source: "tamper", Note: note}
+	if note != tamperCleared {
+		merged, ok := eventLimiter.Allow(c.ID, "tamper", at)
+		if !ok {
+			return
+		}
+		ev.Merged = merged
+	}
+	if c.manifest != nil {
+		c.manifest.AddMarker(Marker{Time: at, CamID: c.ID, Source: "tamper", Note: note})
+	}
+	publishStatus(StatusEvent{Time: at, Type: statusTamper, CamID: c.ID, Note: note})
+	if note != tamperCleared {
+		queueEvent(ev)
+	}
+	go runTamperHooks(ev)
+}
+
+func validateWebhook(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook must be an http or https URL")
+	}
+	return nil
+}
+
+// runTamperHooks posts ev as JSON to --tamper-webhook and runs --tamper-exec with TAMPER_CAMERA,
+// TAMPER_TIME and TAMPER_NOTE in its environment.
+func runTamperHooks(ev Event) {
+	ctx, cancel := context.WithTimeout(context.Background(), tamperHookTimeout)
+	defer cancel()
+	if config.TamperWebhook != "" {
+		if err := postWebhook(ctx, config.TamperWebhook, ev); err != nil {
+			logger.Error(fmt.Sprintf("Failed to send tamper webhook for cam %d: %v.", ev.CamID, err))
+		}
+	}
+	if args := strings.Fields(config.TamperExec); len(args) > 0 {
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = append(os.Environ(),
+			"TAMPER_CAMERA="+strconv.Itoa(ev.CamID),
+			"TAMPER_TIME="+ev.Time.Format(time.RFC3339),
+			"TAMPER_NOTE="+ev.Note)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			logger.Error(fmt.Sprintf("Tamper command for cam %d failed: %v: %s.", ev.CamID, err, bytes.TrimSpace(out)))
+		}
+	}
+}
+
+func postWebhook(ctx context.Context, target string, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telemetry exports per-frame spans and pipeline metrics using the OTLP/HTTP JSON encoding,
+// so any OpenTelemetry collector can ingest them without extra dependencies.
+type Telemetry struct {
+	tracesURL   string
+	metricsURL  string
+	sampleRatio float64
+	client      *http.Client
+	resource    otlpResource
+	start       time.Time
+
+	mu         sync.Mutex
+	spans      []otlpSpan
+	counters   map[metricKey]int64
+	histograms map[metricKey]*histogram
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+const (
+	instrumentationName = "mCamRecorder"
+
+	metricFramesCaptured = "recorder.frames.captured"
+	metricFramesDropped  = "recorder.frames.dropped"
+	metricWriteErrors    = "recorder.write.errors"
+	metricStageDuration  = "recorder.stage.duration"
+
+	maxPendingSpans = 4096
+	exportInterval  = 10 * time.Second
+)
+
+var (
+	metricUnits = map[string]string{
+		metricFramesCaptured: "{frame}",
+		metricFramesDropped:  "{frame}",
+		metricWriteErrors:    "{frame}",
+		metricStageDuration:  "s",
+	}
+	stageBounds = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+type metricKey struct {
+	name  string
+	camID int
+	stage string
+}
+
+type histogram struct {
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"`
+	Start        string         `json:"startTimeUnixNano"`
+	End          string         `json:"endTimeUnixNano"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+func strAttr(key, v string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{StringValue: &v}}
+}
+
+func intAttr(key string, v int) otlpKeyValue {
+	s := strconv.Itoa(v)
+	return otlpKeyValue{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// setupTelemetry starts exporting to endpoint (host:port) and installs the result as the global telemetry.
+func setupTelemetry(endpoint string, insecure bool, sampleRatio float64) *Telemetry {
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	base := scheme + "://" + strings.TrimSuffix(endpoint, "/")
+
+	attrs := []otlpKeyValue{strAttr("service.name", instrumentationName), strAttr("service.version", version)}
+	if host, err := os.Hostname(); err == nil {
+		attrs = append(attrs, strAttr("host.name", host))
+	}
+	for _, kv := range strings.Split(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"), ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			attrs = append(attrs, strAttr(strings.TrimSpace(k), strings.TrimSpace(v)))
+		}
+	}
+
+	t := &Telemetry{
+		tracesURL:   base + "/v1/traces",
+		metricsURL:  base + "/v1/metrics",
+		sampleRatio: sampleRatio,
+		client:      &http.Client{Timeout: 5 * time.Second},
+		resource:    otlpResource{Attributes: attrs},
+		start:       time.Now(),
+		counters:    map[metricKey]int64{},
+		histograms:  map[metricKey]*histogram{},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go t.run()
+	telemetry = t
+	return t
+}
+
+func (t *Telemetry) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := t.export(context.Background()); err != nil {
+				logger.Error(fmt.Sprintf("Failed to export telemetry: %v.", err))
+			}
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// Shutdown stops the periodic exporter and flushes what is still pending.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	close(t.stop)
+	<-t.done
+	return t.export(ctx)
+}
+
+func (t *Telemetry) add(name string, camID int, n int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.counters[metricKey{name: name, camID: camID}] += n
+	t.mu.Unlock()
+}
+
+func (t *Telemetry) observe(camID int, stage string, d time.Duration) {
+	key := metricKey{name: metricStageDuration, camID: camID, stage: stage}
+	secs := d.Seconds()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h, ok := t.histograms[key]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(stageBounds)+1)}
+		t.histograms[key] = h
+	}
+	h.count++
+	h.sum += secs
+	i, _ := slices.BinarySearch(stageBounds, secs)
+	h.buckets[i]++
+}
+
+// Span is a frame or stage span; a nil *Span is valid and records nothing.
+type Span struct {
+	t       *Telemetry
+	camID   int
+	sampled bool
+	traceID [16]byte
+	spanID  [8]byte
+	start   time.Time
+}
+
+// startFrame opens the root span covering one frame of one camera.
+func (t *Telemetry) startFrame(camID int) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{t: t, camID: camID, sampled: rand.Float64() < t.sampleRatio, start: time.Now()}
+	if s.sampled {
+		fillRandom(s.traceID[:])
+		fillRandom(s.spanID[:])
+	}
+	return s
+}
+
+// stage opens a child span for a pipeline stage; the returned func ends it and records its duration.
+func (s *Span) stage(name string) func() {
+	if s == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		end := time.Now()
+		s.t.observe(s.camID, name, end.Sub(start))
+		if s.sampled {
+			var id [8]byte
+			fillRandom(id[:])
+			s.t.record(otlpSpan{
+				TraceID:      hex.EncodeToString(s.traceID[:]),
+				SpanID:       hex.EncodeToString(id[:]),
+				ParentSpanID: hex.EncodeToString(s.spanID[:]),
+				Name:         name,
+				Kind:         1,
+				Start:        unixNano(start),
+				End:          unixNano(end),
+			})
+		}
+	}
+}
+
+func (s *Span) End() {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.t.record(otlpSpan{
+		TraceID:    hex.EncodeToString(s.traceID[:]),
+		SpanID:     hex.EncodeToString(s.spanID[:]),
+		Name:       "frame",
+		Kind:       1,
+		Start:      unixNano(s.start),
+		End:        unixNano(time.Now()),
+		Attributes: []otlpKeyValue{intAttr("camera", s.camID)},
+	})
+}
+
+func (t *Telemetry) record(span otlpSpan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) < maxPendingSpans {
+		t.spans = append(t.spans, span)
+	}
+}
+
+func fillRandom(b []byte) {
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+}
+
+func (t *Telemetry) export(ctx context.Context) error {
+	scope := otlpScope{Name: instrumentationName, Version: version}
+	now := unixNano(time.Now())
+	start := unixNano(t.start)
+
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	var metrics []map[string]any
+	for key, v := range t.counters {
+		metrics = append(metrics, map[string]any{
+			"name": key.name,
+			"unit": metricUnits[key.name],
+			"sum": map[string]any{
+				"aggregationTemporality": 2,
+				"isMonotonic":            true,
+				"dataPoints": []map[string]any{{
+					"attributes":        []otlpKeyValue{intAttr("camera", key.camID)},
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+					"asInt":             strconv.FormatInt(v, 10),
+				}},
+			},
+		})
+	}
+	for key, h := range t.histograms {
+		metrics = append(metrics, map[string]any{
+			"name": key.name,
+			"unit": metricUnits[key.name],
+			"histogram": map[string]any{
+				"aggregationTemporality": 2,
+				"dataPoints": []map[string]any{{
+					"attributes":        []otlpKeyValue{intAttr("camera", key.camID), strAttr("stage", key.stage)},
+					"startTimeUnixNano": start,
+					"timeUnixNano":      now,
+					"count":             strconv.FormatUint(h.count, 10),
+					"sum":               h.sum,
+					"bucketCounts":      slices.Clone(h.buckets),
+					"explicitBounds":    stageBounds,
+				}},
+			},
+		})
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	if len(spans) > 0 {
+		errs = append(errs, t.post(ctx, t.tracesURL, map[string]any{
+			"resourceSpans": []map[string]any{{
+				"resource":   t.resource,
+				"scopeSpans": []map[string]any{{"scope": scope, "spans": spans}},
+			}},
+		}))
+	}
+	if len(metrics) > 0 {
+		errs = append(errs, t.post(ctx, t.metricsURL, map[string]any{
+			"resourceMetrics": []map[string]any{{
+				"resource":     t.resource,
+				"scopeMetrics": []map[string]any{{"scope": scope, "metrics": metrics}},
+			}},
+		}))
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Telemetry) post(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// cameraPalette gives cameras without a configured color distinct ones, picked by camera ID.
+var cameraPalette = []color.RGBA{
+	{R: 230, G: 25, B: 75},
+	{R: 60, G: 180, B: 75},
+	{R: 255, G: 225, B: 25},
+	{R: 0, G: 130, B: 200},
+	{R: 245, G: 130, B: 48},
+	{R: 145, G: 30, B: 180},
+	{R: 70, G: 240, B: 240},
+	{R: 240, G: 50, B: 230},
+	{R: 210, G: 245, B: 60},
+	{R: 250, G: 190, B: 212},
+}
+
+// parseColor parses a #rrggbb color.
+func parseColor(s string) (color.RGBA, error) {
+	hex, ok := strings.CutPrefix(s, "#")
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if !ok || len(hex) != 6 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, expected #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// cameraColor is the configured color of a camera or its palette color.
+func cameraColor(id int, configured string) color.RGBA {
+	if c, err := parseColor(configured); err == nil {
+		return c
+	}
+	return cameraPalette[id%len(cameraPalette)]
+}
+
+func colorHex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// tileFrame is the camera's preview framed in its color, as shown in the viewer, streams and grid recording.
+func (c *Camera) tileFrame() gocv.Mat {
+	mat := c.previewFrame()
+	thickness := max(3, mat.Cols()/160)
+	if err := gocv.Rectangle(&mat, image.Rect(0, 0, mat.Cols(), mat.Rows()), c.Color, 2*thickness); err != nil {
+		logger.Error(fmt.Sprintf("Error drawing border of cam %d: %v.", c.ID, err))
+	}
+	return mat
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+func (c *Camera) openTimelapse(outDir string, startedAt int64, width, height float64) error {
+	filename := filepath.Join(outDir, fmt.Sprintf("%s_%d_timelapse.%s", c.fileStem(), startedAt, config.Container))
+	writer, err := newFrameWriter(filename, c.Codec, c.FPS, int(width), int(height))
+	if err != nil {
+		return fmt.Errorf("could not open timelapse writer for camera %d: %w", c.ID, err)
+	}
+	c.Timelapse = writer
+	c.TimelapseFilename = filename
+	return nil
+}
+
+// writeTimelapse appends mat to the timelapse file if at least one interval has passed since the last sample.
+func (c *Camera) writeTimelapse(mat gocv.Mat) {
+	if c.Timelapse == nil {
+		return
+	}
+	now := time.Now()
+	if !c.lastTimelapse.IsZero() && now.Sub(c.lastTimelapse) < config.TimelapseInterval {
+		return
+	}
+	c.lastTimelapse = now
+	if err := c.Timelapse.Write(mat); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write timelapse for camera %d: %v.", c.ID, err))
+	}
+}
+
+var errTimelapse = errors.New("timelapse must be 1/N to keep every Nth frame, e.g. 1/5, or an interval of at least one frame, e.g. 10s")
+
+// parseTimelapse parses --timelapse, either 1/N for every Nth frame or a duration for one frame per interval.
+func parseTimelapse(s string) (every int, step time.Duration, err error) {
+	if n, ok := strings.CutPrefix(s, "1/"); ok {
+		every, err = strconv.Atoi(n)
+		if err != nil || every < 1 {
+			return 0, 0, errTimelapse
+		}
+		return every, 0, nil
+	}
+	step, err = time.ParseDuration(s)
+	if err != nil || step <= 0 {
+		return 0, 0, errTimelapse
+	}
+	return 0, step, nil
+}
+
+// lapseSample reports whether a frame that is about to be recorded is kept by --timelapse. Kept frames
+// are written back to back, so the recording plays at --fps and time runs faster.
+func (c *Camera) lapseSample(at time.Time) bool {
+	switch {
+	case config.TimelapseEvery > 1:
+		keep := c.lapseFrames%config.TimelapseEvery == 0
+		c.lapseFrames++
+		return keep
+	case config.TimelapseStep > 0:
+		if !c.lastLapse.IsZero() && at.Sub(c.lastLapse) < config.TimelapseStep {
+			return false
+		}
+		c.lastLapse = at
+	}
+	return true
+}
+
+// lapseFraction is the share of captured frames --timelapse keeps for a camera running at fps.
+func lapseFraction(fps float64) float64 {
+	switch {
+	case config.TimelapseEvery > 1:
+		return 1 / float64(config.TimelapseEvery)
+	case config.TimelapseStep > 0 && fps > 0:
+		return min(1, 1/(fps*config.TimelapseStep.Seconds()))
+	}
+	return 1
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	timestampsCSV  = "csv"
+	timestampsSRT  = "srt"
+	timestampsBoth = "both"
+)
+
+func validateTimestamps(s string) error {
+	if s != timestampsCSV && s != timestampsSRT && s != timestampsBoth {
+		return errors.New("timestamps must be csv, srt or both")
+	}
+	return nil
+}
+
+// TimestampLog maps the frames of one recording to the wall-clock time they were captured, as a
+// <file>.timestamps.csv sidecar and/or <file>.srt subtitles showing the capture time.
+type TimestampLog struct {
+	fps   float64
+	start time.Time
+	n     int
+
+	csvFile *os.File
+	csv     *csv.Writer
+
+	srtFile  *os.File
+	srt      *bufio.Writer
+	cue      int
+	cueText  string
+	cueStart time.Duration
+}
+
+// newTimestampLog creates the sidecars configured by --timestamps next to the recording filename.
+func newTimestampLog(filename string, fps float64, start time.Time) (*TimestampLog, error) {
+	base := strings.TrimSuffix(filename, filepath.Ext(filename))
+	l := &TimestampLog{fps: fps, start: start}
+	if config.Timestamps == timestampsCSV || config.Timestamps == timestampsBoth {
+		f, err := os.Create(base + ".timestamps.csv")
+		if err != nil {
+			return nil, err
+		}
+		l.csvFile, l.csv = f, csv.NewWriter(f)
+		_ = l.csv.Write([]string{"frame", "pts_ms", "wall_time", "mono_ns"})
+	}
+	if config.Timestamps == timestampsSRT || config.Timestamps == timestampsBoth {
+		f, err := os.Create(base + ".srt")
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.srtFile, l.srt = f, bufio.NewWriter(f)
+	}
+	return l, nil
+}
+
+// pts is the position of frame n in the file's timeline.
+func (l *TimestampLog) pts(n int) time.Duration {
+	return time.Duration(float64(n) / l.fps * float64(time.Second))
+}
+
+// Record logs the capture time of the next frame written to the recording. It is a no-op on a nil log.
+func (l *TimestampLog) Record(at time.Time) {
+	if l == nil {
+		return
+	}
+	pts := l.pts(l.n)
+	if l.csv != nil {
+		_ = l.csv.Write([]string{
+			strconv.Itoa(l.n),
+			strconv.FormatFloat(float64(pts.Microseconds())/1000, 'f', 3, 64),
+			at.Format(time.RFC3339Nano),
+			strconv.FormatInt(int64(at.Sub(l.start)), 10),
+		})
+	}
+	if l.srt != nil {
+		if text := at.Format("2006-01-02 15:04:05"); text != l.cueText {
+			l.flushCue(pts)
+			l.cueText, l.cueStart = text, pts
+		}
+	}
+	l.n++
+}
+
+func (l *TimestampLog) flushCue(end time.Duration) {
+	if l.cueText == "" {
+		return
+	}
+	l.cue++
+	fmt.Fprintf(l.srt, "%d\n%s --> %s\n%s\n\n", l.cue, srtTime(l.cueStart), srtTime(end), l.cueText)
+}
+
+func srtTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func (l *TimestampLog) Close() {
+	if l == nil {
+		return
+	}
+	if l.csv != nil {
+		l.csv.Flush()
+		_ = l.csvFile.Close()
+	}
+	if l.srt != nil {
+		l.flushCue(l.pts(l.n))
+		_ = l.srt.Flush()
+		_ = l.srtFile.Close()
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	trackPerson = "person"
+	trackMotion = "motion"
+
+	trackInterval = 250 * time.Millisecond
+	// trackDeadzone is the offset from the centre, as a fraction of half the frame, that is left alone.
+	trackDeadzone = 0.15
+	// trackGain converts the subject's offset into a PTZ velocity.
+	trackGain = 0.6
+	// trackWidth is the width frames are scaled to before detection.
+	trackWidth = 320
+	// ptzManualHold is how long tracking yields after a manual PTZ command.
+	ptzManualHold = 10 * time.Second
+)
+
+func validateTrackTarget(s string) error {
+	if s != trackPerson && s != trackMotion {
+		return fmt.Errorf("track target must be %s or %s", trackPerson, trackMotion)
+	}
+	return nil
+}
+
+// Tracker steers a PTZ camera to keep the largest detected person, or the centre of motion, in the middle of the frame.
+type Tracker struct {
+	cam    *Camera
+	hog    gocv.HOGDescriptor
+	prev   gocv.Mat
+	moving bool
+}
+
+func runTracker(ctx context.Context, cam *Camera) {
+	t := &Tracker{cam: cam, prev: gocv.NewMat()}
+	if config.TrackTarget == trackPerson {
+		t.hog = gocv.NewHOGDescriptor()
+		defer t.hog.Close()
+		people := gocv.HOGDefaultPeopleDetector()
+		_ = t.hog.SetSVMDetector(people)
+		_ = people.Close()
+	}
+	defer t.prev.Close()
+
+	ticker := time.NewTicker(trackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.step()
+		}
+	}
+}
+
+func (t *Tracker) step() {
+	ptz := t.cam.PTZ
+	if !ptz.Tracking() || ptz.overridden() {
+		t.stop()
+		return
+	}
+	frame := t.cam.previewFrame()
+	defer frame.Close()
+	small := gocv.NewMat()
+	defer small.Close()
+	height := max(1, frame.Rows()*trackWidth/max(1, frame.Cols()))
+	if err := gocv.Resize(frame, &small, image.Pt(trackWidth, height), 0, 0, gocv.InterpolationArea); err != nil {
+		return
+	}
+
+	x, y, ok := t.locate(small)
+	if ok && !inZones(t.cam.Zones, x/float64(small.Cols()), y/float64(small.Rows())) {
+		ok = false
+	}
+	if !ok {
+		t.stop()
+		return
+	}
+	dx := (x/float64(small.Cols()) - 0.5) * 2
+	dy := (y/float64(small.Rows()) - 0.5) * 2
+	if math.Abs(dx) < trackDeadzone && math.Abs(dy) < trackDeadzone {
+		t.stop()
+		return
+	}
+	pan := max(-1, min(1, dx*trackGain))
+	tilt := max(-1, min(1, -dy*trackGain))
+	if err := ptz.Move(pan, tilt, 0, 2*trackInterval); err != nil {
+		logger.Error(fmt.Sprintf("Cam %d tracking: %v.", t.cam.ID, err))
+		return
+	}
+	t.moving = true
+}
+
+// locate returns the centre of the subject in frame.
+func (t *Tracker) locate(frame gocv.Mat) (float64, float64, bool) {
+	if config.TrackTarget == trackPerson {
+		var best image.Rectangle
+		for _, r := range t.hog.DetectMultiScale(frame) {
+			if r.Dx()*r.Dy() > best.Dx()*best.Dy() {
+				best = r
+			}
+		}
+		if best.Empty() {
+			return 0, 0, false
+		}
+		return float64(best.Min.X+best.Max.X) / 2, float64(best.Min.Y+best.Max.Y) / 2, true
+	}
+
+	grey := gocv.NewMat()
+	_ = gocv.CvtColor(frame, &grey, gocv.ColorBGRToGray)
+	_ = gocv.GaussianBlur(grey, &grey, image.Pt(5, 5), 0, 0, gocv.BorderDefault)
+	defer func() {
+		_ = t.prev.Close()
+		t.prev = grey
+	}()
+	if t.prev.Empty() || t.prev.Rows() != grey.Rows() {
+		return 0, 0, false
+	}
+	diff := gocv.NewMat()
+	defer diff.Close()
+	_ = gocv.AbsDiff(t.prev, grey, &diff)
+	gocv.Threshold(diff, &diff, motionPixelDelta, 255, gocv.ThresholdBinary)
+	m := gocv.Moments(diff, true)
+	if m["m00"] < float64(diff.Rows()*diff.Cols())*config.MotionThreshold/100 {
+		return 0, 0, false
+	}
+	return m["m10"] / m["m00"], m["m01"] / m["m00"], true
+}
+
+func (t *Tracker) stop() {
+	if !t.moving {
+		return
+	}
+	t.moving = false
+	if err := t.cam.PTZ.Stop(); err != nil {
+		logger.Error(fmt.Sprintf("Cam %d tracking: %v.", t.cam.ID, err))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gocv.io/x/gocv"
+)
+
+// usbPeriodicShare is the fraction of a USB bus that may be reserved for isochronous transfers.
+const usbPeriodicShare = 0.8
+
+type usbDevice struct {
+	Bus       string
+	Path      string
+	Product   string
+	Serial    string
+	SpeedMbps float64
+}
+
+// bitsPerPixel estimates the transfer cost of a capture format; compressed formats use a
+// conservative average since their real size depends on the scene.
+func bitsPerPixel(fourcc string) float64 {
+	switch strings.ToUpper(strings.TrimSpace(fourcc)) {
+	case "MJPG", "JPEG":
+		return 3
+	case "H264", "HEVC", "H265":
+		return 1
+	case "NV12", "NV21", "YU12", "YV12", "I420":
+		return 12
+	case "GREY", "Y800":
+		return 8
+	case "RGB3", "BGR3":
+		return 24
+	default:
+		return 16
+	}
+}
+
+type busLoad struct {
+	device   usbDevice
+	cameras  []int
+	required float64
+	fourccs  []string
+}
+
+// checkUSBBandwidth groups cameras by USB bus and warns when the negotiated modes need more
+// bandwidth than the bus can reserve, which shows up as silent failures or reduced FPS.
+func checkUSBBandwidth(cameras []*Camera) {
+	buses := map[string]*busLoad{}
+	for _, cam := range cameras {
+		if cam.Source != "" {
+			continue
+		}
+		dev, ok := usbDeviceForCamera(cam.ID)
+		if !ok {
+			continue
+		}
+		width := cam.Capture.Get(gocv.VideoCaptureFrameWidth)
+		height := cam.Capture.Get(gocv.VideoCaptureFrameHeight)
+		fps := cam.Capture.Get(gocv.VideoCaptureFPS)
+		if fps <= 0 {
+			fps = cam.FPS
+		}
+		fourcc := cam.Capture.CodecString()
+		mbps := width * height * fps * bitsPerPixel(fourcc) / 1e6
+		logger.Info(fmt.Sprintf("Cam %d (%s) on USB bus %s port %s at %.0f Mbps: %.0fx%.0f@%.0f %s needs ~%.0f Mbps.",
+			cam.ID, dev.Product, dev.Bus, dev.Path, dev.SpeedMbps, width, height, fps, fourcc, mbps))
+
+		load, ok := buses[dev.Bus]
+		if !ok {
+			load = &busLoad{device: dev}
+			buses[dev.Bus] = load
+		}
+		// A camera on a slower hub port still consumes the bus at that port's speed.
+		load.device.SpeedMbps = max(load.device.SpeedMbps, dev.SpeedMbps)
+		load.cameras = append(load.cameras, cam.ID)
+		load.required += mbps
+		load.fourccs = append(load.fourccs, fourcc)
+	}
+
+	for bus, load := range buses {
+		usable := load.device.SpeedMbps * usbPeriodicShare
+		if len(load.cameras) < 2 && load.required <= usable {
+			continue
+		}
+		if load.required <= usable {
+			logger.Info(fmt.Sprintf("USB bus %s: cams %v need ~%.0f of ~%.0f usable Mbps.", bus, load.cameras, load.required, usable))
+			continue
+		}
+
+		advice := "lower --width/--height or --fps, or move cameras to another USB controller"
+		if !slices.Contains(load.fourccs, "MJPG") {
+			advice = "use --input-fourcc MJPG, " + advice
+		}
+		logger.Warn(fmt.Sprintf("USB bus %s is oversubscribed: cams %v need ~%.0f Mbps but only ~%.0f Mbps can be reserved; expect failed reads or reduced FPS. Suggestion: %s.",
+			bus, load.cameras, load.required, usable, advice))
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func readSysfs(dir, name string) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// usbDeviceForCamera walks from /sys/class/video4linux/videoN up to the USB device that owns it.
+func usbDeviceForCamera(index int) (usbDevice, bool) {
+	dir, err := filepath.EvalSymlinks(fmt.Sprintf("/sys/class/video4linux/video%d/device", index))
+	if err != nil {
+		return usbDevice{}, false
+	}
+	for ; dir != "/" && dir != "."; dir = filepath.Dir(dir) {
+		bus := readSysfs(dir, "busnum")
+		speed := readSysfs(dir, "speed")
+		if bus == "" || speed == "" {
+			continue
+		}
+		mbps, err := strconv.ParseFloat(speed, 64)
+		if err != nil {
+			return usbDevice{}, false
+		}
+		return usbDevice{
+			Bus:       bus,
+			Path:      filepath.Base(dir),
+			Product:   readSysfs(dir, "product"),
+			Serial:    readSysfs(dir, "serial"),
+			SpeedMbps: mbps,
+		}, true
+	}
+	return usbDevice{}, false
+}
+
+// videoDeviceName is the name the driver gives /dev/videoN, e.g. the camera's product name.
+func videoDeviceName(index int) string {
+	return readSysfs(fmt.Sprintf("/sys/class/video4linux/video%d", index), "name")
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// usbDeviceForCamera is only implemented on Linux, where the topology is exposed in sysfs.
+func usbDeviceForCamera(int) (usbDevice, bool) {
+	return usbDevice{}, false
+}
+
+func videoDeviceName(int) string {
+	return ""
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Role int
+
+const (
+	roleViewer Role = iota + 1
+	roleOperator
+	roleAdmin
+)
+
+var roleNames = map[string]Role{"viewer": roleViewer, "operator": roleOperator, "admin": roleAdmin}
+
+func (r Role) String() string {
+	for name, role := range roleNames {
+		if role == r {
+			return name
+		}
+	}
+	return "none"
+}
+
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+
+	// loginAttempts token requests are allowed per client address within loginWindow, as every one
+	// costs a full password hash.
+	loginAttempts = 5
+	loginWindow   = time.Minute
+)
+
+type User struct {
+	Name         string `yaml:"name"`
+	Role         string `yaml:"role"`
+	PasswordHash string `yaml:"password_hash"`
+
+	role Role
+}
+
+// Principal is who a request was authenticated as.
+type Principal struct {
+	Name string
+	Role Role
+}
+
+type issuedToken struct {
+	Principal
+	expires time.Time
+}
+
+// Accounts holds the users from --users and the tokens issued to them. Tokens live in memory only,
+// so a restart signs everyone out.
+type Accounts struct {
+	users map[string]User
+
+	mu     sync.Mutex
+	tokens map[string]issuedToken
+}
+
+var accounts = &Accounts{users: map[string]User{}, tokens: map[string]issuedToken{}}
+
+type principalKey struct{}
+
+func principalFrom(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// loadUsers reads the --users file:
+//
+//	users:
+//	  - name: alice
+//	    role: admin
+//	    password_hash: pbkdf2-sha256$600000$...
+func loadUsers(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file struct {
+		Users []User `yaml:"users"`
+	}
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(file.Users) == 0 {
+		return fmt.Errorf("%s: no users defined", path)
+	}
+	for _, u := range file.Users {
+		if u.Name == "" {
+			return fmt.Errorf("%s: user without a name", path)
+		}
+		if _, ok := accounts.users[u.Name]; ok {
+			return fmt.Errorf("%s: user %q is defined twice", path, u.Name)
+		}
+		role, ok := roleNames[u.Role]
+		if !ok {
+			return fmt.Errorf("%s: user %q: role must be viewer, operator or admin", path, u.Name)
+		}
+		if _, _, _, err := parsePasswordHash(u.PasswordHash); err != nil {
+			return fmt.Errorf("%s: user %q: %w", path, u.Name, err)
+		}
+		u.role = role
+		accounts.users[u.Name] = u
+	}
+	return nil
+}
+
+// authEnabled reports whether the HTTP server requires credentials.
+func authEnabled() bool {
+	return config.APIToken != "" || len(accounts.users) > 0
+}
+
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, sha256.Size)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+func parsePasswordHash(hash string) (int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return 0, nil, nil, fmt.Errorf("password_hash must be a %s hash from --hash-password", passwordScheme)
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter <= 0 {
+		return 0, nil, nil, fmt.Errorf("invalid iteration count %q in password_hash", parts[1])
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("invalid salt in password_hash: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(key) == 0 {
+		return 0, nil, nil, errors.New("invalid key in password_hash")
+	}
+	return iter, salt, key, nil
+}
+
+func checkPassword(hash, password string) bool {
+	iter, salt, key, err := parsePasswordHash(hash)
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(key))
+	return err == nil && subtle.ConstantTimeCompare(got, key) == 1
+}
+
+// printPasswordHash reads a password from the first line of r and writes its password_hash to w.
+func printPasswordHash(r io.Reader, w io.Writer) error {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return errors.New("empty password")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, hash)
+	return err
+}
+
+// dummyPasswordHash is checked for unknown users so they take as long to reject as a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("")
+	return hash
+})
+
+// login checks a user's password and issues a bearer token valid for --token-ttl.
+func (a *Accounts) login(name, password string) (string, issuedToken, error) {
+	u, ok := a.users[name]
+	hash := dummyPasswordHash()
+	if ok {
+		hash = u.PasswordHash
+	}
+	if !checkPassword(hash, password) || !ok {
+		return "", issuedToken{}, errors.New("invalid user name or password")
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", issuedToken{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	issued := issuedToken{Principal: Principal{Name: u.Name, Role: u.role}, expires: now.Add(config.TokenTTL)}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Tokens that are never used again would otherwise stay until the recorder exits.
+	maps.DeleteFunc(a.tokens, func(_ string, t issuedToken) bool { return now.After(t.expires) })
+	a.tokens[token] = issued
+	return token, issued, nil
+}
+
+// lookup resolves a bearer token. --api-token acts as an admin.
+func (a *Accounts) lookup(token string) (Principal, bool) {
+	if token == "" {
+		return Principal{}, false
+	}
+	if config.APIToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(config.APIToken)) == 1 {
+		return Principal{Name: "api-token", Role: roleAdmin}, true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	issued, ok := a.tokens[token]
+	if !ok {
+		return Principal{}, false
+	}
+	if time.Now().After(issued.expires) {
+		delete(a.tokens, token)
+		return Principal{}, false
+	}
+	return issued.Principal, true
+}
+
+func (a *Accounts) revoke(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.tokens, token)
+}
+
+// revokeUser signs a user out everywhere and returns how many tokens were revoked.
+func (a *Accounts) revokeUser(name string) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for token, issued := range a.tokens {
+		if issued.Name == name {
+			delete(a.tokens, token)
+			n++
+		}
+	}
+	return n
+}
+
+// LoginThrottle caps the token requests of each client address at loginAttempts per loginWindow.
+type LoginThrottle struct {
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+}
+
+var loginThrottle = &LoginThrottle{attempts: map[string][]time.Time{}}
+
+// Allow records an attempt from addr at and reports whether it may go ahead or, if not, how long
+// until it may.
+func (t *LoginThrottle) Allow(addr string, at time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	recent := t.attempts[addr][:0]
+	for _, a := range t.attempts[addr] {
+		if at.Sub(a) < loginWindow {
+			recent = append(recent, a)
+		}
+	}
+	if len(recent) >= loginAttempts {
+		t.attempts[addr] = recent
+		return recent[0].Add(loginWindow).Sub(at), false
+	}
+	t.attempts[addr] = append(recent, at)
+	if len(t.attempts) > 1024 {
+		for a, times := range t.attempts {
+			if at.Sub(times[len(times)-1]) >= loginWindow {
+				delete(t.attempts, a)
+			}
+		}
+	}
+	return 0, true
+}
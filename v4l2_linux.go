@@ -0,0 +1,127 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// V4L2 ioctls and structures from linux/videodev2.h.
+const (
+	vidiocEnumFmt            = 0xC0405602
+	vidiocEnumFrameSizes     = 0xC02C564A
+	vidiocEnumFrameIntervals = 0xC034564B
+
+	v4l2BufTypeVideoCapture = 1
+	v4l2FrmTypeDiscrete     = 1
+)
+
+type v4l2FmtDesc struct {
+	Index       uint32
+	Type        uint32
+	Flags       uint32
+	Description [32]byte
+	PixelFormat uint32
+	MbusCode    uint32
+	Reserved    [3]uint32
+}
+
+type v4l2FrmSizeEnum struct {
+	Index       uint32
+	PixelFormat uint32
+	Type        uint32
+	// Discrete sizes use the first two values, stepwise ones min/max/step width then height.
+	Size     [6]uint32
+	Reserved [2]uint32
+}
+
+type v4l2FrmIvalEnum struct {
+	Index       uint32
+	PixelFormat uint32
+	Width       uint32
+	Height      uint32
+	Type        uint32
+	// Discrete intervals use the first fraction, stepwise ones min, max and step.
+	Interval [6]uint32
+	Reserved [2]uint32
+}
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+		if errno == syscall.EINTR {
+			continue
+		}
+		if errno != 0 {
+			return errno
+		}
+		return nil
+	}
+}
+
+// probeFormats asks the V4L2 driver of /dev/videoN for every pixel format, frame size and frame rate it offers.
+func probeFormats(index int) ([]deviceFormat, error) {
+	f, err := os.OpenFile(fmt.Sprintf("/dev/video%d", index), os.O_RDWR|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fd := f.Fd()
+
+	var formats []deviceFormat
+	for i := uint32(0); ; i++ {
+		desc := v4l2FmtDesc{Index: i, Type: v4l2BufTypeVideoCapture}
+		if err := ioctl(fd, vidiocEnumFmt, unsafe.Pointer(&desc)); err != nil {
+			if errors.Is(err, syscall.EINVAL) {
+				break
+			}
+			return formats, err
+		}
+		format := deviceFormat{
+			FourCC:      fourccString(desc.PixelFormat),
+			Description: strings.TrimRight(string(desc.Description[:]), "\x00"),
+		}
+		for j := uint32(0); ; j++ {
+			size := v4l2FrmSizeEnum{Index: j, PixelFormat: desc.PixelFormat}
+			if ioctl(fd, vidiocEnumFrameSizes, unsafe.Pointer(&size)) != nil {
+				break
+			}
+			if size.Type == v4l2FrmTypeDiscrete {
+				format.Sizes = append(format.Sizes, frameSize{Width: int(size.Size[0]), Height: int(size.Size[1])})
+				continue
+			}
+			// Stepwise and continuous ranges are reported by their smallest and largest size.
+			format.Sizes = append(format.Sizes,
+				frameSize{Width: int(size.Size[0]), Height: int(size.Size[3])},
+				frameSize{Width: int(size.Size[1]), Height: int(size.Size[4])})
+			break
+		}
+		for k := range format.Sizes {
+			s := &format.Sizes[k]
+			for j := uint32(0); ; j++ {
+				ival := v4l2FrmIvalEnum{Index: j, PixelFormat: desc.PixelFormat, Width: uint32(s.Width), Height: uint32(s.Height)}
+				if ioctl(fd, vidiocEnumFrameIntervals, unsafe.Pointer(&ival)) != nil {
+					break
+				}
+				// The interval is seconds per frame; stepwise ranges are reported by their fastest rate.
+				if num, den := ival.Interval[0], ival.Interval[1]; num > 0 {
+					s.FPS = append(s.FPS, float64(den)/float64(num))
+				}
+				if ival.Type != v4l2FrmTypeDiscrete {
+					break
+				}
+			}
+		}
+		formats = append(formats, format)
+	}
+	return formats, nil
+}
+
+func fourccString(v uint32) string {
+	return string([]byte{byte(v), byte(v >> 8), byte(v >> 16), byte(v >> 24)})
+}
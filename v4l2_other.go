@@ -0,0 +1,35 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+
+	"gocv.io/x/gocv"
+)
+
+// probeSizes are tried where the capture backend cannot list a camera's modes.
+var probeSizes = []frameSize{{Width: 640, Height: 480}, {Width: 1280, Height: 720}, {Width: 1920, Height: 1080}, {Width: 3840, Height: 2160}}
+
+// probeFormats requests each of probeSizes at up to 60 fps and keeps the ones the camera accepts.
+func probeFormats(index int) ([]deviceFormat, error) {
+	capture, err := openDevice(index, "")
+	if err != nil {
+		return nil, err
+	}
+	defer capture.Close()
+	if !capture.IsOpened() {
+		return nil, errors.New("could not open camera")
+	}
+	format := deviceFormat{FourCC: capture.CodecString()}
+	for _, s := range probeSizes {
+		capture.Set(gocv.VideoCaptureFrameWidth, float64(s.Width))
+		capture.Set(gocv.VideoCaptureFrameHeight, float64(s.Height))
+		capture.Set(gocv.VideoCaptureFPS, 60)
+		if int(capture.Get(gocv.VideoCaptureFrameWidth)) == s.Width && int(capture.Get(gocv.VideoCaptureFrameHeight)) == s.Height {
+			s.FPS = []float64{capture.Get(gocv.VideoCaptureFPS)}
+			format.Sizes = append(format.Sizes, s)
+		}
+	}
+	return []deviceFormat{format}, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	layoutGrid = iota
+	layoutFocus
+	layoutPair
+	layoutFullscreen
+	layoutStrip
+	layoutStereo
+)
+
+// layoutNames are the built-in layouts; the config file's layouts follow them.
+var layoutNames = []string{"grid", "focus", "pair", "fullscreen", "strip", "stereo"}
+
+// focusThumbs is how many other cameras the focus layout shows beside the main one.
+const focusThumbs = 4
+
+const gridAuto = "auto"
+
+// gridMaxWidth and gridMaxHeight bound the grid when tiles keep the capture size, so a dozen or more
+// cameras are shrunk to fit a 4K canvas instead of building a mosaic no screen or encoder can take.
+const (
+	gridMaxWidth  = 3840
+	gridMaxHeight = 2160
+)
+
+// parseSize parses "WxH", e.g. 640x360.
+func parseSize(s string) (int, int, error) {
+	w, h, ok := strings.Cut(s, "x")
+	width, err1 := strconv.Atoi(w)
+	height, err2 := strconv.Atoi(h)
+	if !ok || err1 != nil || err2 != nil || width < 1 || height < 1 {
+		return 0, 0, fmt.Errorf("invalid size %q, expected WxH, e.g. 640x360", s)
+	}
+	return width, height, nil
+}
+
+func validateGrid(s string) error {
+	if s == gridAuto {
+		return nil
+	}
+	if _, _, err := parseSize(s); err != nil {
+		return errors.New("grid must be auto or columns x rows, e.g. 3x2")
+	}
+	return nil
+}
+
+// gridDims is the columns and rows the grid of n cameras is laid out in: --grid, with rows added when
+// there are more cameras than cells, or the squarest grid that fits.
+func gridDims(n int) (cols, rows int) {
+	n = max(n, 1)
+	if c, r, err := parseSize(config.Grid); err == nil {
+		return c, max(r, (n+c-1)/c)
+	}
+	cols = int(math.Ceil(math.Sqrt(float64(n))))
+	return cols, (n + cols - 1) / cols
+}
+
+// tileSize is the size of one camera in the views and streams, --tile-size or else the capture size.
+func tileSize() (int, int) {
+	if config.TileWidth > 0 {
+		return config.TileWidth, config.TileHeight
+	}
+	return int(config.Width), int(config.Height)
+}
+
+// gridTileSize is the size of a tile in the grid of n cameras: tileSize, scaled down to fit
+// gridMaxWidth x gridMaxHeight unless --tile-size is given.
+func gridTileSize(n int) (int, int) {
+	width, height := tileSize()
+	if config.TileWidth > 0 {
+		return width, height
+	}
+	cols, rows := gridDims(n)
+	scale := min(1, float64(gridMaxWidth)/float64(cols*width), float64(gridMaxHeight)/float64(rows*height))
+	if scale >= 1 {
+		return width, height
+	}
+	// Even sizes keep the encoders of the grid recording and streams happy.
+	return max(2, int(float64(width)*scale)&^1), max(2, int(float64(height)*scale)&^1)
+}
+
+// viewLayout and viewCam are the layout cycled with the v hotkey and the ID of the camera it centres on
+// (-1 for the first). The grid recording follows them too.
+var (
+	viewLayout atomic.Int32
+	viewCam    atomic.Int32
+)
+
+func init() {
+	viewCam.Store(-1)
+}
+
+func cycleLayout() int {
+	next := (int(viewLayout.Load()) + 1) % (len(layoutNames) + len(config.Layouts))
+	setLayout(next)
+	return next
+}
+
+func setLayout(layout int) {
+	viewLayout.Store(int32(layout))
+	name := ""
+	if layout < len(layoutNames) {
+		name = layoutNames[layout]
+	} else {
+		name = config.Layouts[layout-len(layoutNames)].Name
+	}
+	logger.Info(fmt.Sprintf("Layout: %s.", name))
+}
+
+func validateStereo(s string) error {
+	ids, err := parsePriority(s)
+	if err != nil || len(ids) != 2 {
+		return errors.New("stereo must be the left and right camera IDs, e.g. 0,1")
+	}
+	return nil
+}
+
+// stereoCameras are the --stereo pair, or the first two cameras, as indexes in cameras.
+func stereoCameras(cameras []*Camera) (left, right int) {
+	left, right = 0, min(1, len(cameras)-1)
+	if ids, err := parsePriority(config.Stereo); err == nil && len(ids) == 2 {
+		if i := slices.IndexFunc(cameras, func(c *Camera) bool { return c.ID == ids[0] }); i >= 0 {
+			left = i
+		}
+		if i := slices.IndexFunc(cameras, func(c *Camera) bool { return c.ID == ids[1] }); i >= 0 {
+			right = i
+		}
+	}
+	return left, right
+}
+
+// mainCamera is the camera the focus, pair, strip and fullscreen layouts centre on and its index in cameras.
+func mainCamera(cameras []*Camera) int {
+	id := int(viewCam.Load())
+	if i := slices.IndexFunc(cameras, func(c *Camera) bool { return c.ID == id }); i >= 0 {
+		return i
+	}
+	return 0
+}
+
+// composeLayout renders cameras in layout with tiles of tileSize.
+func composeLayout(cameras []*Camera, layout int) gocv.Mat {
+	if layout == layoutGrid || len(cameras) == 0 {
+		tiles := make([]gocv.Mat, 0, len(cameras))
+		for _, cam := range cameras {
+			tiles = append(tiles, cam.tileFrame())
+		}
+		width, height := gridTileSize(len(cameras))
+		grid := tileGrid(tiles, width, height)
+		for _, t := range tiles {
+			_ = t.Close()
+		}
+		return grid
+	}
+
+	width, height := tileSize()
+	main := mainCamera(cameras)
+	switch layout {
+	case layoutFocus:
+		canvas := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), 2*height, 2*width+width/2, gocv.MatTypeCV8UC3)
+		pasteTile(&canvas, cameras[main], image.Rect(0, 0, 2*width, 2*height))
+		n := 0
+		for i, cam := range cameras {
+			if i == main || n == focusThumbs {
+				continue
+			}
+			pasteTile(&canvas, cam, image.Rect(2*width, n*height/2, 2*width+width/2, (n+1)*height/2))
+			n++
+		}
+		return canvas
+	case layoutPair:
+		canvas := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), height, 2*width, gocv.MatTypeCV8UC3)
+		pasteTile(&canvas, cameras[main], image.Rect(0, 0, width, height))
+		if len(cameras) > 1 {
+			pasteTile(&canvas, cameras[(main+1)%len(cameras)], image.Rect(width, 0, 2*width, height))
+		}
+		return canvas
+	case layoutStrip:
+		canvas := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), 2*height+height/2, 2*width, gocv.MatTypeCV8UC3)
+		pasteTile(&canvas, cameras[main], image.Rect(0, 0, 2*width, 2*height))
+		n := 0
+		for i, cam := range cameras {
+			if i == main || n == focusThumbs {
+				continue
+			}
+			pasteTile(&canvas, cam, image.Rect(n*width/2, 2*height, (n+1)*width/2, 2*height+height/2))
+			n++
+		}
+		return canvas
+	case layoutStereo:
+		// Stereo halves are shown without the camera borders so they line up.
+		canvas := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), height, 2*width, gocv.MatTypeCV8UC3)
+		left, right := stereoCameras(cameras)
+		pasteFrame(&canvas, cameras[left], image.Rect(0, 0, width, height))
+		pasteFrame(&canvas, cameras[right], image.Rect(width, 0, 2*width, height))
+		return canvas
+	case layoutFullscreen:
+		return cameras[main].tileFrame()
+	default:
+		return composeCustom(cameras, config.Layouts[layout-len(layoutNames)])
+	}
+}
+
+func pasteTile(canvas *gocv.Mat, cam *Camera, r image.Rectangle) {
+	frame := cam.tileFrame()
+	pasteMat(canvas, frame, cam.ID, r)
+	_ = frame.Close()
+}
+
+func pasteFrame(canvas *gocv.Mat, cam *Camera, r image.Rectangle) {
+	frame := cam.previewFrame()
+	pasteMat(canvas, frame, cam.ID, r)
+	_ = frame.Close()
+}
+
+func pasteMat(canvas *gocv.Mat, frame gocv.Mat, camID int, r image.Rectangle) {
+	tile := fitTile(frame, r.Dx(), r.Dy())
+	region := canvas.Region(r)
+	if err := tile.CopyTo(&region); err != nil {
+		logger.Error(fmt.Sprintf("Failed to place tile of cam %d: %v.", camID, err))
+	}
+	_ = region.Close()
+	_ = tile.Close()
+}
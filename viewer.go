@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// runViewer shows the cameras in the chosen layout until ctx is done or the window is closed. Every key
+// is ignored, so a stray keypress on a wall monitor cannot change what it shows.
+func runViewer(ctx context.Context, window *gocv.Window, throttle *DisplayThrottle, cameras []*Camera) {
+	frameInterval := time.Duration(float64(time.Second) / config.FPS)
+	for ctx.Err() == nil {
+		iterStart := time.Now()
+		loopAt.Store(iterStart.UnixNano())
+		if throttle.Due(iterStart) {
+			output := composeLayout(cameras, int(viewLayout.Load()))
+			shown, scaled := throttle.Fit(output)
+			if err := window.IMShow(shown); err != nil {
+				logger.Error(fmt.Sprintf("Failed to display window: %v.", err))
+			}
+			if scaled {
+				_ = shown.Close()
+			}
+			_ = output.Close()
+		}
+		window.WaitKey(max(1, int((frameInterval - time.Since(iterStart)).Milliseconds())))
+		throttle.Observe(time.Now(), time.Since(iterStart), frameInterval)
+		if window.GetWindowProperty(gocv.WindowPropertyVisible) < 1 {
+			logger.Info("Viewer window closed.")
+			return
+		}
+	}
+	logStopReason(ctx)
+}
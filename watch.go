@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+// watchSettle gives cameras that just appeared time to finish initialising before they are opened.
+const watchSettle = 2 * time.Second
+
+func watchCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "watch",
+		Usage: "Wait until the configured cameras are connected, then record like record",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			if err := setup(cmd); err != nil {
+				return err
+			}
+			ready, err := waitForCameras(ctx)
+			if err != nil || !ready {
+				return err
+			}
+			// Cameras that were missing join the session when they are plugged in.
+			config.Hotplug = true
+			startCapture()
+			return nil
+		},
+	}
+}
+
+// connectedCameras lists which of the cameras watch waits for, the entries of --cameras or
+// camera-settings, are connected, out of how many. Entries with a serial number or USB port are found
+// at any index.
+func connectedCameras() (up []cameraRef, total int) {
+	present, listed := videoDevices()
+	if !listed {
+		present = detectVideoDevices(config.MaxCam)
+	}
+	if config.Devices != "" {
+		for _, part := range strings.Split(config.Devices, ",") {
+			total++
+			// Device paths such as /dev/v4l/by-id links only resolve while the camera is connected.
+			if ids, err := parseCameraList(part); err == nil && slices.Contains(present, ids[0]) {
+				up = append(up, cameraRef{id: ids[0], label: cameraSettings(ids[0]).Name})
+			}
+		}
+		return up, total
+	}
+	for _, c := range config.Cameras {
+		total++
+		if c.Pipeline != "" && c.Serial == "" && c.USBPort == "" {
+			// A pipeline's source cannot be detected; it is counted as up and opened with the rest.
+			up = append(up, cameraRef{id: c.ID, label: cmp.Or(c.Label, c.Name)})
+			continue
+		}
+		if i := slices.IndexFunc(present, c.matches); i >= 0 {
+			up = append(up, cameraRef{id: present[i], label: cmp.Or(c.Label, c.Name)})
+		}
+	}
+	return up, total
+}
+
+// waitForCameras polls until the watched cameras meet --quorum, all of them by default. It returns
+// false if interrupted first.
+func waitForCameras(ctx context.Context) (bool, error) {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ticker := time.NewTicker(hotplugInterval)
+	defer ticker.Stop()
+	policy := cmp.Or(config.Quorum, quorumAll)
+	last := ""
+	for {
+		up, total := connectedCameras()
+		if total == 0 {
+			return false, errors.New("watch needs the cameras to wait for in --cameras or camera-settings")
+		}
+		short := quorumShortfall(policy, up, total)
+		if short == "" {
+			break
+		}
+		if short != last {
+			logger.Info(fmt.Sprintf("Watching for cameras: %s.", short))
+			last = short
+		}
+		select {
+		case <-ctx.Done():
+			logger.Info("Stopped watching for cameras.")
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return false, nil
+	case <-time.After(watchSettle):
+	}
+	logger.Info("Cameras connected, starting the session.")
+	return true, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	queueBlock      = "block"
+	queueDropOldest = "drop-oldest"
+)
+
+func validateWriteQueueFull(s string) error {
+	if s != queueBlock && s != queueDropOldest {
+		return errors.New("write queue policy must be block or drop-oldest")
+	}
+	return nil
+}
+
+type queuedFrame struct {
+	mat     gocv.Mat
+	at      time.Time
+	release func(gocv.Mat)
+}
+
+// QueuedWriter encodes frames on a goroutine of its own, fed by a bounded queue, so a slow encoder
+// doesn't hold up the camera's capture. Frames are handed over rather than copied: the queue owns a
+// frame until it is encoded or dropped, then gives it back through its release func.
+type QueuedWriter struct {
+	writer FrameWriter
+	queue  chan queuedFrame
+	done   chan struct{}
+	// pending counts the frames queued or being encoded.
+	pending atomic.Int64
+
+	// onWritten and onError are called from the encoding goroutine with the capture time of each
+	// frame, once it is in the file or failed; onDrop for every frame drop-oldest discards.
+	onWritten func(at time.Time)
+	onError   func(err error, at time.Time)
+	onDrop    func()
+}
+
+func newQueuedWriter(writer FrameWriter, size int, onWritten func(time.Time), onError func(error, time.Time), onDrop func()) *QueuedWriter {
+	w := &QueuedWriter{
+		writer:    writer,
+		queue:     make(chan queuedFrame, size),
+		done:      make(chan struct{}),
+		onWritten: onWritten,
+		onError:   onError,
+		onDrop:    onDrop,
+	}
+	go w.run()
+	return w
+}
+
+func (w *QueuedWriter) run() {
+	defer close(w.done)
+	for f := range w.queue {
+		if err := w.writer.Write(f.mat); err != nil {
+			w.onError(err, f.at)
+		} else {
+			w.onWritten(f.at)
+		}
+		f.release(f.mat)
+		w.pending.Add(-1)
+	}
+}
+
+// Enqueue hands mat, captured at, to the encoder, which calls release with it once done. With a nil
+// release the caller keeps mat and a clone is queued instead. When the queue is full it waits, or
+// with --write-queue-full drop-oldest discards the oldest queued frame.
+func (w *QueuedWriter) Enqueue(mat gocv.Mat, at time.Time, release func(gocv.Mat)) {
+	if release == nil {
+		mat, release = mat.Clone(), closeMat
+	}
+	f := queuedFrame{mat: mat, at: at, release: release}
+	w.pending.Add(1)
+	if config.WriteQueueFull == queueBlock {
+		w.queue <- f
+		return
+	}
+	for {
+		select {
+		case w.queue <- f:
+			return
+		default:
+		}
+		select {
+		case old := <-w.queue:
+			old.release(old.mat)
+			w.pending.Add(-1)
+			w.onDrop()
+		default:
+		}
+	}
+}
+
+// Write queues a clone of img, stamped with the current time.
+func (w *QueuedWriter) Write(img gocv.Mat) error {
+	w.Enqueue(img, time.Now(), nil)
+	return nil
+}
+
+// Pending is the number of frames queued or being encoded.
+func (w *QueuedWriter) Pending() int64 {
+	return w.pending.Load()
+}
+
+// Close writes what is still queued and closes the underlying writer.
+func (w *QueuedWriter) Close() error {
+	close(w.queue)
+	<-w.done
+	return w.writer.Close()
+}
+
+func closeMat(mat gocv.Mat) {
+	_ = mat.Close()
+}
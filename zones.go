@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+
+	"gocv.io/x/gocv"
+)
+
+// Zone is a polygon of a camera's frame, with points as x,y fractions of its width and height, in which
+// motion and tracked objects count or, for an exclude zone, are ignored.
+type Zone struct {
+	Exclude bool         `yaml:"exclude"`
+	Points  [][2]float64 `yaml:"points"`
+}
+
+func validateZones(zones []Zone) error {
+	for _, z := range zones {
+		if len(z.Points) < 3 {
+			return errors.New("zones need at least 3 points")
+		}
+		for _, p := range z.Points {
+			if p[0] < 0 || p[0] > 1 || p[1] < 0 || p[1] > 1 {
+				return errors.New("zone points are x,y fractions of the frame between 0 and 1")
+			}
+		}
+	}
+	return nil
+}
+
+// contains reports whether the point x,y, as fractions of the frame, lies inside the polygon.
+func (z Zone) contains(x, y float64) bool {
+	inside := false
+	for i, j := 0, len(z.Points)-1; i < len(z.Points); j, i = i, i+1 {
+		a, b := z.Points[i], z.Points[j]
+		if (a[1] > y) != (b[1] > y) && x < (b[0]-a[0])*(y-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// inZones reports whether x,y counts for detection: inside an include zone, or anywhere when there
+// are none, and outside every exclude zone.
+func inZones(zones []Zone, x, y float64) bool {
+	included, hasInclude := false, false
+	for _, z := range zones {
+		if z.Exclude {
+			if z.contains(x, y) {
+				return false
+			}
+			continue
+		}
+		hasInclude = true
+		included = included || z.contains(x, y)
+	}
+	return included || !hasInclude
+}
+
+// zoneMask draws zones into a width x height mask that is 255 where detection counts.
+func zoneMask(zones []Zone, width, height int) gocv.Mat {
+	fill := 255.0
+	for _, z := range zones {
+		if !z.Exclude {
+			fill = 0
+			break
+		}
+	}
+	mask := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(fill, 0, 0, 0), height, width, gocv.MatTypeCV8UC1)
+	// Includes first, so an exclude zone wins where they overlap.
+	for _, exclude := range []bool{false, true} {
+		for _, z := range zones {
+			if z.Exclude != exclude {
+				continue
+			}
+			pts := make([]image.Point, len(z.Points))
+			for i, p := range z.Points {
+				pts[i] = image.Pt(int(p[0]*float64(width)), int(p[1]*float64(height)))
+			}
+			pv := gocv.NewPointsVectorFromPoints([][]image.Point{pts})
+			// A single channel mask takes the first channel, which FillPoly fills from B.
+			c := color.RGBA{B: 255}
+			if exclude {
+				c = color.RGBA{}
+			}
+			if err := gocv.FillPoly(&mask, pv, c); err != nil {
+				logger.Error(err.Error())
+			}
+			pv.Close()
+		}
+	}
+	return mask
+}